@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/masnax/canonical-bookmanager/validate"
+)
+
+// Role grants access to a set of routes, every role is granted what the
+// roles before it are.
+type Role string
+
+const (
+	RoleNone   Role = ""
+	RoleReader Role = "reader"
+	RoleEditor Role = "editor"
+	RoleAdmin  Role = "admin"
+)
+
+// Roles lists the roles in increasing order of access.
+var Roles = []Role{RoleReader, RoleEditor, RoleAdmin}
+
+func ParseRole(s string) (Role, error) {
+	for _, r := range Roles {
+		if string(r) == s {
+			return r, nil
+		}
+	}
+	return RoleNone, errors.New(fmt.Sprintf("unknown role %q, expected one of %v", s, Roles))
+}
+
+// Allows reports whether the role grants access to routes requiring the
+// other role. No role is granted anything.
+func (r Role) Allows(required Role) bool {
+	return r.rank() > 0 && r.rank() >= required.rank()
+}
+
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if role == r {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// MaxLength matches the name column.
+const MaxLength = 255
+
+// TokenPrefix starts every token, so that leaked tokens are easy to search for.
+const TokenPrefix = "bm_"
+
+// Key is an API key. Only the hash of its token is stored, the token itself is
+// shown once when the key is made.
+type Key struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Role    Role   `json:"role"`
+	Hash    string `json:"-"`
+	Created string `json:"created"`
+}
+
+// Validate checks the name and role and returns all failed checks as
+// validate.Errors.
+func (k Key) Validate() error {
+	errs := validate.Errors{}
+	errs.Required("name", k.Name)
+	errs.MaxLength("name", k.Name, MaxLength)
+	if _, err := ParseRole(string(k.Role)); err != nil {
+		errs.Add("role", "%v", err)
+	}
+	return errs.Err()
+}
+
+// NewKey makes a key with a new token, ready to be stored. Tokens carry 256
+// bits of randomness, so a fast hash is enough to store them.
+func NewKey(name string, role Role) (Key, string, error) {
+	k := Key{Name: name, Role: role, Created: time.Now().UTC().Format(time.RFC3339)}
+	if err := k.Validate(); err != nil {
+		return Key{}, "", err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Key{}, "", err
+	}
+	token := TokenPrefix + hex.EncodeToString(b)
+	k.Hash = Hash(token)
+	return k, token, nil
+}
+
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the key a request was made with.
+func NewContext(ctx context.Context, k Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, k)
+}
+
+// FromContext returns the key a request was made with, if any.
+func FromContext(ctx context.Context) (Key, bool) {
+	k, ok := ctx.Value(contextKey{}).(Key)
+	return k, ok
+}
@@ -1,5 +1,15 @@
 package book
 
+import "github.com/masnax/canonical-bookmanager/validate"
+
+// Limits matching the columns of the book table.
+const (
+	MaxLength            = 255
+	MaxDescriptionLength = 65535
+	MinEdition           = 1
+	MaxEdition           = 1000
+)
+
 type Book struct {
 	Id          int    `json:"id"`
 	Title       string `json:"title"`
@@ -8,4 +18,22 @@ type Book struct {
 	Edition     int    `json:"edition"`
 	Description string `json:"description"`
 	Genre       string `json:"genre"`
+	// Version is incremented by the store on every update and is sent as the
+	// ETag of the book rather than in its JSON.
+	Version int `json:"-"`
+}
+
+// Validate checks every field and returns all failed checks as
+// validate.Errors. The id is assigned by the store and is not checked.
+func (b Book) Validate() error {
+	errs := validate.Errors{}
+	errs.Required("title", b.Title)
+	errs.MaxLength("title", b.Title, MaxLength)
+	errs.MaxLength("author", b.Author, MaxLength)
+	errs.Required("published", b.Published)
+	errs.Date("published", b.Published)
+	errs.Range("edition", b.Edition, MinEdition, MaxEdition)
+	errs.MaxBytes("description", b.Description, MaxDescriptionLength)
+	errs.MaxLength("genre", b.Genre, MaxLength)
+	return errs.Err()
 }
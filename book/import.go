@@ -0,0 +1,52 @@
+package book
+
+import "fmt"
+
+// Import modes: a transactional import adds no book unless every row is
+// valid, a best-effort import adds the valid rows and skips the others.
+const (
+	ImportTransactional = "transactional"
+	ImportBestEffort    = "best-effort"
+)
+
+// MaxImportErrors bounds the errors listed in an import report.
+const MaxImportErrors = 100
+
+// ImportError rejects a row of an import, or one of its fields. Rows are
+// numbered from 1, not counting the header of a CSV file.
+type ImportError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Path points at the row, or the field of the row, e.g. rows[3].title.
+func (e ImportError) Path() string {
+	if len(e.Field) == 0 {
+		return fmt.Sprintf("rows[%d]", e.Row)
+	}
+	return fmt.Sprintf("rows[%d].%s", e.Row, e.Field)
+}
+
+// ImportReport is the outcome of an import. Failed counts the rejected rows
+// and Errors lists the first MaxImportErrors reasons they were rejected for.
+type ImportReport struct {
+	Mode       string        `json:"mode"`
+	DryRun     bool          `json:"dry_run"`
+	Collection int           `json:"collection,omitempty"`
+	Rows       int           `json:"rows"`
+	Imported   int           `json:"imported"`
+	Failed     int           `json:"failed"`
+	IDs        []int         `json:"ids"`
+	Errors     []ImportError `json:"errors"`
+}
+
+// Fail records a rejected row, along with the reasons it was rejected for.
+func (r *ImportReport) Fail(errs ...ImportError) {
+	r.Failed++
+	for _, e := range errs {
+		if len(r.Errors) < MaxImportErrors {
+			r.Errors = append(r.Errors, e)
+		}
+	}
+}
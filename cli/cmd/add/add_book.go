@@ -1,26 +1,23 @@
 package add
 
 import (
-	"bytes"
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/masnax/canonical-bookmanager/book"
-	"github.com/masnax/canonical-bookmanager/cli/cmd/rest"
+	"github.com/masnax/canonical-bookmanager/client"
 )
 
-func AddBook(sourceUrl string, path string, args []string) {
-	url := sourceUrl + path
+func AddBook(ctx context.Context, c *client.Client, args []string) error {
 	edition, err := strconv.Atoi(args[3])
 	if err != nil {
-		log.Printf("edition must be integer")
-		return
+		return errors.New("edition must be integer")
 	}
 	if _, err := time.Parse("2006-01-02", args[2]); err != nil {
-		log.Println("published date must be of form Y-M-D")
-		return
+		return errors.New("published date must be of form Y-M-D")
 	}
 	book := book.Book{
 		Title:       args[0],
@@ -31,14 +28,10 @@ func AddBook(sourceUrl string, path string, args []string) {
 		Genre:       args[5],
 	}
 
-	bodyBytes, err := json.Marshal(book)
+	created, err := c.CreateBook(ctx, book)
 	if err != nil {
-		log.Printf("parsing error: %v", err)
-	}
-	reader := bytes.NewReader(bodyBytes)
-
-	_, err = rest.MakeRequest(url, "POST", reader)
-	if err != nil {
-		log.Printf("request error: %v", err)
+		return err
 	}
+	fmt.Printf("added book with id %d\n", created.Id)
+	return nil
 }
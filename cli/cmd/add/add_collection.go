@@ -1,53 +1,32 @@
 package add
 
 import (
-	"bytes"
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"fmt"
 	"strconv"
 
-	"github.com/masnax/canonical-bookmanager/cli/cmd/rest"
-	"github.com/masnax/canonical-bookmanager/collection"
+	"github.com/masnax/canonical-bookmanager/client"
 )
 
-func AddNewCollection(sourceUrl string, path string, args []string) {
-	url := sourceUrl + path + "/"
-	collection := collection.Collection{Collection: args[0]}
-
-	bodyBytes, err := json.Marshal(collection)
+func AddNewCollection(ctx context.Context, c *client.Client, args []string) error {
+	created, err := c.CreateCollection(ctx, args[0])
 	if err != nil {
-		log.Printf("parsing error: %v", err)
-	}
-	reader := bytes.NewReader(bodyBytes)
-
-	_, err = rest.MakeRequest(url, "POST", reader)
-	if err != nil {
-		log.Printf("request error: %v", err)
+		return err
 	}
+	fmt.Printf("added collection with id %d\n", created.ID)
+	return nil
 }
 
-func AddToCollection(sourceUrl string, path string, bookId string, collectionId string) {
-	url := sourceUrl + path + "/"
+func AddToCollection(ctx context.Context, c *client.Client, bookId string, collectionId string) error {
 	bid, err := strconv.Atoi(bookId)
 	if err != nil {
-		log.Printf("expected integer book id")
-		return
+		return errors.New("expected integer book id")
 	}
 	cid, err := strconv.Atoi(collectionId)
 	if err != nil {
-		log.Printf("expected integer collection id")
-		return
+		return errors.New("expected integer collection id")
 	}
-	collection := collection.BookCollectionData{BookID: bid, CollectionID: cid}
 
-	bodyBytes, err := json.Marshal(collection)
-	if err != nil {
-		log.Printf("parsing error: %v", err)
-	}
-	reader := bytes.NewReader(bodyBytes)
-
-	_, err = rest.MakeRequest(url, "POST", reader)
-	if err != nil {
-		log.Printf("request error: %v", err)
-	}
+	return c.AddBookToCollection(ctx, cid, bid)
 }
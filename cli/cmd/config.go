@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/masnax/canonical-bookmanager/cli/cmd/output"
+	"github.com/masnax/canonical-bookmanager/client"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultServer is used when no flag, environment variable or profile names
+// a server.
+const defaultServer = "http://localhost:8080/"
+
+// defaultProfile is used when the config file does not name a current
+// profile.
+const defaultProfile = "default"
+
+// profile holds the settings for one server.
+type profile struct {
+	Server  string        `yaml:"server,omitempty"`
+	Token   string        `yaml:"token,omitempty"`
+	Output  string        `yaml:"output,omitempty"`
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// cliConfig is read from ~/.config/bmc/config.yaml, flags and environment
+// variables take precedence over it.
+type cliConfig struct {
+	CurrentProfile string             `yaml:"current_profile,omitempty"`
+	Profiles       map[string]profile `yaml:"profiles,omitempty"`
+}
+
+// profileKeys are the keys accepted by 'config set', in the order they are
+// listed in its help.
+var profileKeys = []string{"server", "token", "output", "timeout"}
+
+func configPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("unable to find the home directory: %v", err))
+	}
+	return filepath.Join(home, ".config", "bmc", "config.yaml"), nil
+}
+
+// loadConfig reads the config file, a missing file is an empty config.
+func loadConfig() (cliConfig, error) {
+	c := cliConfig{Profiles: map[string]profile{}}
+	path, err := configPath()
+	if err != nil {
+		return c, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, errors.New(fmt.Sprintf("unable to read %s: %v", path, err))
+	}
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return c, errors.New(fmt.Sprintf("unable to parse %s: %v", path, err))
+	}
+	if c.Profiles == nil {
+		c.Profiles = map[string]profile{}
+	}
+	return c, nil
+}
+
+// saveConfig writes the config file, which only its owner may read as it
+// holds tokens. The file is replaced rather than rewritten, so that one
+// created with wider permissions does not stay readable by others.
+func saveConfig(c cliConfig) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.New(fmt.Sprintf("unable to create %s: %v", dir, err))
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return errors.New(fmt.Sprintf("unable to restrict %s: %v", dir, err))
+	}
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	// temporary files are only readable by their owner
+	f, err := ioutil.TempFile(dir, "config-*.yaml")
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to write %s: %v", path, err))
+	}
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return errors.New(fmt.Sprintf("unable to write %s: %v", path, err))
+	}
+	return nil
+}
+
+// profileName picks the profile from the --profile flag, then BMC_PROFILE,
+// then the current profile of the config file. The name is only checked when
+// it was asked for explicitly.
+func profileName(c cliConfig) (string, bool) {
+	if len(profileFlag) > 0 {
+		return profileFlag, true
+	}
+	if name, ok := os.LookupEnv("BMC_PROFILE"); ok && len(name) > 0 {
+		return name, true
+	}
+	if len(c.CurrentProfile) > 0 {
+		return c.CurrentProfile, true
+	}
+	return defaultProfile, false
+}
+
+// settings are what a command runs with.
+type settings struct {
+	server  string
+	token   string
+	output  string
+	timeout time.Duration
+}
+
+// resolveSettings combines, in increasing order of precedence, the defaults,
+// the profile, the BMC_SERVER and BMC_TOKEN environment variables and the
+// flags.
+func resolveSettings(cmd *cobra.Command) (settings, error) {
+	c, err := loadConfig()
+	if err != nil {
+		return settings{}, err
+	}
+	name, explicit := profileName(c)
+	p, ok := c.Profiles[name]
+	if !ok && explicit {
+		return settings{}, errors.New(fmt.Sprintf("no profile named %s, create it with 'bmc config set --profile %s server URL'", name, name))
+	}
+
+	s := settings{server: defaultServer, output: "table", token: p.Token, timeout: p.Timeout}
+	if len(p.Server) > 0 {
+		s.server = p.Server
+	}
+	if len(p.Output) > 0 {
+		s.output = p.Output
+	}
+	if server, ok := os.LookupEnv("BMC_SERVER"); ok && len(server) > 0 {
+		s.server = server
+	}
+	if token, ok := os.LookupEnv("BMC_TOKEN"); ok && len(token) > 0 {
+		s.token = token
+	}
+	if cmd.Flags().Changed("server") {
+		s.server = serverFlag
+	}
+	if cmd.Flags().Changed("token") {
+		s.token = tokenFlag
+	}
+	if cmd.Flags().Changed("output") {
+		s.output = outputFlag
+	}
+	return s, nil
+}
+
+// setup builds the client and output options every command but config runs
+// with.
+func setup(cmd *cobra.Command, args []string) error {
+	s, err := resolveSettings(cmd)
+	if err != nil {
+		return err
+	}
+	outputOptions, err = output.Parse(s.output, noHeadersFlag, columnsFlag)
+	if err != nil {
+		return err
+	}
+	apiClient, err = client.New(s.server)
+	if err != nil {
+		return err
+	}
+	apiClient.Token = s.token
+	// the timeout covers reading the whole response, which would cut short
+	// the files that imports and exports stream
+	if s.timeout > 0 && cmd != cmdImport && cmd != cmdExport {
+		apiClient.HTTPClient = &http.Client{Timeout: s.timeout}
+	}
+	return nil
+}
+
+var cmdConfig = &cobra.Command{
+	Use:   "config [command]",
+	Short: "Manage profiles in ~/.config/bmc/config.yaml",
+	Long: `Manage profiles in ~/.config/bmc/config.yaml:
+	a profile holds the server, token, output format and timeout to use, and
+	the current profile is used unless --profile or BMC_PROFILE names another`,
+	// config commands work without a reachable server or a valid profile
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+}
+
+var cmdConfigView = &cobra.Command{
+	Use:   "view",
+	Short: "Show the config file, with tokens redacted",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if !rawFlag {
+			for name, p := range c.Profiles {
+				if len(p.Token) > 0 {
+					p.Token = "REDACTED"
+				}
+				c.Profiles[name] = p
+			}
+		}
+		b, err := yaml.Marshal(c)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(cmd.OutOrStdout(), string(b))
+		return nil
+	},
+}
+
+var cmdConfigUseProfile = &cobra.Command{
+	Use:   "use-profile name",
+	Short: "Make the named profile the current one",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if _, ok := c.Profiles[args[0]]; !ok {
+			names := []string{}
+			for name := range c.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return errors.New(fmt.Sprintf("no profile named %s, expected one of %v", args[0], names))
+		}
+		c.CurrentProfile = args[0]
+		if err := saveConfig(c); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "switched to profile %s\n", args[0])
+		return nil
+	},
+}
+
+var cmdConfigSet = &cobra.Command{
+	Use:   "set key value",
+	Short: "Set server, token, output or timeout in the current profile, or the one named by --profile",
+	Long: `Set a key in the current profile, or the one named by --profile, which is created if needed:
+	server   URL of the server, e.g. https://books.example.com
+	token    API key to authenticate with
+	output   default output format, see --output
+	timeout  time a request may take, e.g. 30s, 0 for unlimited, imports and exports are exempt
+An empty value unsets the key.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		name, _ := profileName(c)
+		p := c.Profiles[name]
+		key, value := args[0], args[1]
+		switch key {
+		case "server":
+			if len(value) > 0 {
+				if _, err := client.New(value); err != nil {
+					return err
+				}
+			}
+			p.Server = value
+		case "token":
+			p.Token = value
+		case "output":
+			if len(value) > 0 {
+				if _, err := output.Parse(value, false, ""); err != nil {
+					return err
+				}
+			}
+			p.Output = value
+		case "timeout":
+			p.Timeout = 0
+			if len(value) > 0 {
+				if p.Timeout, err = time.ParseDuration(value); err != nil || p.Timeout < 0 {
+					return errors.New(fmt.Sprintf("invalid timeout %q, expected a duration such as 30s", value))
+				}
+			}
+		default:
+			return errors.New(fmt.Sprintf("unknown key %q, expected one of %v", key, profileKeys))
+		}
+		c.Profiles[name] = p
+		if len(c.CurrentProfile) == 0 {
+			c.CurrentProfile = name
+		}
+		if err := saveConfig(c); err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "set %s in profile %s\n", key, name)
+		return nil
+	},
+}
@@ -0,0 +1,321 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// setEnv sets the environment variables for the duration of the test, an
+// empty value unsets the variable.
+func setEnv(t *testing.T, env map[string]string) {
+	for key, value := range env {
+		old, ok := os.LookupEnv(key)
+		if len(value) > 0 {
+			os.Setenv(key, value)
+		} else {
+			os.Unsetenv(key)
+		}
+		key := key
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(key, old)
+			} else {
+				os.Unsetenv(key)
+			}
+		})
+	}
+}
+
+// setHome points the home directory at a new temporary directory, with the
+// given config file if it is not empty, and returns the path of the config
+// file.
+func setHome(t *testing.T, contents string) string {
+	home := t.TempDir()
+	setEnv(t, map[string]string{"HOME": home, "BMC_PROFILE": "", "BMC_SERVER": "", "BMC_TOKEN": ""})
+	path := filepath.Join(home, ".config", "bmc", "config.yaml")
+	if len(contents) == 0 {
+		return path
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	return path
+}
+
+// parseFlags returns a command with the persistent flags of bmc set from args.
+func parseFlags(t *testing.T, args []string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().StringVar(&serverFlag, "server", "", "")
+	cmd.Flags().StringVar(&tokenFlag, "token", "", "")
+	cmd.Flags().StringVar(&profileFlag, "profile", "", "")
+	cmd.Flags().StringVarP(&outputFlag, "output", "o", "", "")
+	if err := cmd.Flags().Parse(args); err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	return cmd
+}
+
+const profilesConfig = `
+current_profile: work
+profiles:
+  work:
+    server: http://work:8080/
+    token: work-token
+    output: yaml
+    timeout: 5s
+  home:
+    server: http://home:8080/
+`
+
+func TestResolveSettings(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		config    string
+		env       map[string]string
+		args      []string
+		expected  settings
+		expectErr bool
+	}{
+		{
+			desc:     "defaults without a config file",
+			expected: settings{server: defaultServer, output: "table"},
+		},
+		{
+			desc:     "defaults without a current profile",
+			config:   "profiles:\n  work:\n    server: http://work:8080/\n",
+			expected: settings{server: defaultServer, output: "table"},
+		},
+		{
+			desc:     "current profile",
+			config:   profilesConfig,
+			expected: settings{server: "http://work:8080/", token: "work-token", output: "yaml", timeout: 5 * time.Second},
+		},
+		{
+			desc:     "defaults for the keys a profile leaves out",
+			config:   profilesConfig,
+			args:     []string{"--profile", "home"},
+			expected: settings{server: "http://home:8080/", output: "table"},
+		},
+		{
+			desc:     "profile from the environment",
+			config:   profilesConfig,
+			env:      map[string]string{"BMC_PROFILE": "home"},
+			expected: settings{server: "http://home:8080/", output: "table"},
+		},
+		{
+			desc:     "profile flag over the environment",
+			config:   profilesConfig,
+			env:      map[string]string{"BMC_PROFILE": "home"},
+			args:     []string{"--profile", "work"},
+			expected: settings{server: "http://work:8080/", token: "work-token", output: "yaml", timeout: 5 * time.Second},
+		},
+		{
+			desc:     "environment over the profile",
+			config:   profilesConfig,
+			env:      map[string]string{"BMC_SERVER": "http://env:8080/", "BMC_TOKEN": "env-token"},
+			expected: settings{server: "http://env:8080/", token: "env-token", output: "yaml", timeout: 5 * time.Second},
+		},
+		{
+			desc:     "flags over the environment",
+			config:   profilesConfig,
+			env:      map[string]string{"BMC_SERVER": "http://env:8080/", "BMC_TOKEN": "env-token"},
+			args:     []string{"--server", "http://flag:8080/", "--token", "flag-token", "-o", "json"},
+			expected: settings{server: "http://flag:8080/", token: "flag-token", output: "json", timeout: 5 * time.Second},
+		},
+		{
+			desc:     "empty token flag over the profile",
+			config:   profilesConfig,
+			args:     []string{"--token", ""},
+			expected: settings{server: "http://work:8080/", output: "yaml", timeout: 5 * time.Second},
+		},
+		{
+			desc:      "unknown profile flag",
+			config:    profilesConfig,
+			args:      []string{"--profile", "school"},
+			expectErr: true,
+		},
+		{
+			desc:      "unknown profile in the environment",
+			env:       map[string]string{"BMC_PROFILE": "school"},
+			expectErr: true,
+		},
+		{
+			desc:      "unknown key in the config file",
+			config:    "profiles:\n  work:\n    url: http://work:8080/\n",
+			expectErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			setHome(t, tc.config)
+			setEnv(t, tc.env)
+			s, err := resolveSettings(parseFlags(t, tc.args))
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got [%+v]", s)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if s != tc.expected {
+				t.Fatalf("expected %+v, got [%+v]", tc.expected, s)
+			}
+		})
+	}
+}
+
+func TestConfigCommands(t *testing.T) {
+	path := setHome(t, "")
+	// the steps run in order against the same config file
+	testCases := []struct {
+		desc      string
+		cmd       *cobra.Command
+		args      []string
+		profile   string
+		raw       bool
+		expected  string
+		expectErr bool
+	}{
+		{desc: "view without a config file", cmd: cmdConfigView, expected: "{}\n"},
+		{desc: "set creates the default profile", cmd: cmdConfigSet, args: []string{"server", "http://home:8080/"},
+			expected: "set server in profile default\n"},
+		{desc: "set in another profile", cmd: cmdConfigSet, args: []string{"token", "secret"}, profile: "work",
+			expected: "set token in profile work\n"},
+		{desc: "set a timeout", cmd: cmdConfigSet, args: []string{"timeout", "30s"}, profile: "work",
+			expected: "set timeout in profile work\n"},
+		{desc: "set an invalid server", cmd: cmdConfigSet, args: []string{"server", "ftp://home"}, expectErr: true},
+		{desc: "set an invalid output", cmd: cmdConfigSet, args: []string{"output", "xml"}, expectErr: true},
+		{desc: "set an invalid timeout", cmd: cmdConfigSet, args: []string{"timeout", "-1s"}, expectErr: true},
+		{desc: "set an unknown key", cmd: cmdConfigSet, args: []string{"url", "http://home:8080/"}, expectErr: true},
+		{desc: "use an unknown profile", cmd: cmdConfigUseProfile, args: []string{"school"}, expectErr: true},
+		{desc: "use a profile", cmd: cmdConfigUseProfile, args: []string{"work"},
+			expected: "switched to profile work\n"},
+		{desc: "view redacts tokens", cmd: cmdConfigView, expected: `current_profile: work
+profiles:
+  default:
+    server: http://home:8080/
+  work:
+    token: REDACTED
+    timeout: 30s
+`},
+		{desc: "view raw", cmd: cmdConfigView, raw: true, expected: `current_profile: work
+profiles:
+  default:
+    server: http://home:8080/
+  work:
+    token: secret
+    timeout: 30s
+`},
+		{desc: "set unsets with an empty value", cmd: cmdConfigSet, args: []string{"timeout", ""},
+			expected: "set timeout in profile work\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			profileFlag, rawFlag = tc.profile, tc.raw
+			defer func() { profileFlag, rawFlag = "", false }()
+			var out bytes.Buffer
+			tc.cmd.SetOut(&out)
+			defer tc.cmd.SetOut(nil)
+			err := tc.cmd.RunE(tc.cmd, tc.args)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got [%s]", out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if out.String() != tc.expected {
+				t.Fatalf("expected\n%s\ngot\n[%s]", tc.expected, out.String())
+			}
+		})
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	expected := "current_profile: work\nprofiles:\n  default:\n    server: http://home:8080/\n  work:\n    token: secret\n"
+	if string(b) != expected {
+		t.Fatalf("expected\n%s\ngot\n[%s]", expected, string(b))
+	}
+}
+
+func TestSaveConfigPermissions(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		config string
+	}{
+		{desc: "new file", config: ""},
+		{desc: "existing file readable by others", config: "current_profile: work\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			path := setHome(t, tc.config)
+			if err := saveConfig(cliConfig{CurrentProfile: "home"}); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			for file, mode := range map[string]os.FileMode{path: 0600, filepath.Dir(path): 0700 | os.ModeDir} {
+				info, err := os.Stat(file)
+				if err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+				if info.Mode() != mode {
+					t.Fatalf("expected %s to have mode %v, got [%v]", file, mode, info.Mode())
+				}
+			}
+			c, err := loadConfig()
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if c.CurrentProfile != "home" {
+				t.Fatalf("expected the current profile to be home, got [%s]", c.CurrentProfile)
+			}
+			files, err := ioutil.ReadDir(filepath.Dir(path))
+			if err != nil || len(files) != 1 {
+				t.Fatalf("expected only the config file to be left, got [%v] [%v]", files, err)
+			}
+		})
+	}
+}
+
+func TestSetupTimeout(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		cmd     *cobra.Command
+		timeout time.Duration
+	}{
+		{desc: "list", cmd: cmdListBooks, timeout: 5 * time.Second},
+		{desc: "import streams", cmd: cmdImport, timeout: 0},
+		{desc: "export streams", cmd: cmdExport, timeout: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			setHome(t, profilesConfig)
+			profileFlag = ""
+			if err := setup(tc.cmd, nil); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			var timeout time.Duration
+			if apiClient.HTTPClient != nil {
+				timeout = apiClient.HTTPClient.Timeout
+			}
+			if timeout != tc.timeout {
+				t.Fatalf("expected timeout %v, got [%v]", tc.timeout, timeout)
+			}
+		})
+	}
+}
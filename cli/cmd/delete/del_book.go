@@ -1,21 +1,17 @@
 package delete
 
 import (
-	"log"
+	"context"
+	"errors"
 	"strconv"
 
-	"github.com/masnax/canonical-bookmanager/cli/cmd/rest"
+	"github.com/masnax/canonical-bookmanager/client"
 )
 
-func DelBook(sourceUrl string, path string, args []string) {
-	url := sourceUrl + path
-	if _, err := strconv.Atoi(args[0]); err != nil {
-		log.Printf("expected numerical id as input")
-		return
-	}
-	url += "/" + args[0]
-	_, err := rest.MakeRequest(url, "DELETE", nil)
+func DelBook(ctx context.Context, c *client.Client, args []string) error {
+	id, err := strconv.Atoi(args[0])
 	if err != nil {
-		log.Printf("error from request: %v", err)
+		return errors.New("expected numerical id as input")
 	}
+	return c.DeleteBook(ctx, id, 0)
 }
@@ -1,51 +1,30 @@
 package delete
 
 import (
-	"bytes"
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
 	"strconv"
 
-	"github.com/masnax/canonical-bookmanager/cli/cmd/rest"
-	"github.com/masnax/canonical-bookmanager/collection"
+	"github.com/masnax/canonical-bookmanager/client"
 )
 
-func DelCollection(sourceUrl string, path string, args []string) {
-	url := sourceUrl + path
-	if _, err := strconv.Atoi(args[0]); err != nil {
-		log.Printf("expected numerical id as input")
-		return
-	}
-	url += "/" + args[0]
-	_, err := rest.MakeRequest(url, "DELETE", nil)
+func DelCollection(ctx context.Context, c *client.Client, args []string) error {
+	id, err := strconv.Atoi(args[0])
 	if err != nil {
-		log.Printf("error from request: %v", err)
+		return errors.New("expected numerical id as input")
 	}
+	return c.DeleteCollection(ctx, id, 0)
 }
 
-func RemoveFromCollection(sourceUrl string, path string, bookId string, collectionId string) {
-	url := sourceUrl + path + "/"
+func RemoveFromCollection(ctx context.Context, c *client.Client, bookId string, collectionId string) error {
 	bid, err := strconv.Atoi(bookId)
 	if err != nil {
-
-		log.Printf("expected integer book id")
-		return
+		return errors.New("expected integer book id")
 	}
 	cid, err := strconv.Atoi(collectionId)
 	if err != nil {
-		log.Printf("expected integer collection id")
-		return
+		return errors.New("expected integer collection id")
 	}
-	collection := collection.BookCollectionData{BookID: bid, CollectionID: cid}
 
-	bodyBytes, err := json.Marshal(collection)
-	if err != nil {
-		log.Printf("parsing error: %v", err)
-	}
-	reader := bytes.NewReader(bodyBytes)
-
-	_, err = rest.MakeRequest(url, "DELETE", reader)
-	if err != nil {
-		log.Printf("request error: %v", err)
-	}
+	return c.RemoveBookFromCollection(ctx, cid, bid)
 }
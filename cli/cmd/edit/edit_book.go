@@ -1,40 +1,28 @@
 package edit
 
 import (
-	"bytes"
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"strconv"
 	"time"
 
-	"github.com/masnax/canonical-bookmanager/book"
-	"github.com/masnax/canonical-bookmanager/cli/cmd/rest"
+	"github.com/masnax/canonical-bookmanager/client"
 )
 
-func EditBook(sourceUrl string, path string, argPath string, title string,
-	author string, date string, edition int, description string, genre string) {
-	url := sourceUrl + path + "/" + argPath
-
-	if _, err := time.Parse("2006-01-02", date); err != nil {
-		log.Println("published date must be of form Y-M-D")
-		return
-	}
-	book := book.Book{
-		Title:       title,
-		Author:      author,
-		Published:   date,
-		Edition:     edition,
-		Description: description,
-		Genre:       genre,
-	}
-
-	bodyBytes, err := json.Marshal(book)
+// EditBook sends only the given changes, keyed by book field, so the fields
+// left out keep their current values.
+func EditBook(ctx context.Context, c *client.Client, argPath string, changes map[string]interface{}) error {
+	id, err := strconv.Atoi(argPath)
 	if err != nil {
-		log.Printf("parsing error: %v", err)
+		return errors.New("expected numerical id as input")
 	}
-	reader := bytes.NewReader(bodyBytes)
 
-	_, err = rest.MakeRequest(url, "PUT", reader)
-	if err != nil {
-		log.Printf("request error: %v", err)
+	if date, ok := changes["published"].(string); ok {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return errors.New("published date must be of form Y-M-D")
+		}
 	}
+
+	_, err = c.PatchBook(ctx, id, 0, changes)
+	return err
 }
@@ -1,26 +1,19 @@
 package edit
 
 import (
-	"bytes"
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
+	"strconv"
 
-	"github.com/masnax/canonical-bookmanager/cli/cmd/rest"
+	"github.com/masnax/canonical-bookmanager/client"
 	"github.com/masnax/canonical-bookmanager/collection"
 )
 
-func EditCollection(sourceUrl string, path string, argPath string, name string) {
-	url := sourceUrl + path + "/" + argPath
-	collection := collection.Collection{Collection: name}
-
-	bodyBytes, err := json.Marshal(collection)
-	if err != nil {
-		log.Printf("parsing error: %v", err)
-	}
-	reader := bytes.NewReader(bodyBytes)
-
-	_, err = rest.MakeRequest(url, "PUT", reader)
+func EditCollection(ctx context.Context, c *client.Client, argPath string, name string) error {
+	id, err := strconv.Atoi(argPath)
 	if err != nil {
-		log.Printf("request error: %v", err)
+		return errors.New("expected numerical id as input")
 	}
+	_, err = c.UpdateCollection(ctx, collection.Collection{ID: id, Collection: name})
+	return err
 }
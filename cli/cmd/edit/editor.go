@@ -0,0 +1,360 @@
+package edit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/client"
+	"github.com/masnax/canonical-bookmanager/patch"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"github.com/masnax/canonical-bookmanager/validate"
+	"gopkg.in/yaml.v2"
+)
+
+// editorFields are the book fields shown in the editor, in order.
+var editorFields = []string{"title", "author", "published", "edition", "description", "genre"}
+
+const errorPrefix = "# error: "
+
+// maxRetries bounds how often changes are sent again on top of a newer
+// version of the book before the conflict is left to the user.
+const maxRetries = 3
+
+// EditBookInEditor opens the book in $VISUAL or $EDITOR as YAML and sends the
+// fields that were changed, on condition that the book has not changed since
+// it was fetched. If someone else changed other fields in the meantime the
+// changes are sent again on top of theirs. If they changed the same fields, or
+// the changes are rejected, the editor is opened again with the errors as
+// comments above the fields they are about.
+func EditBookInEditor(ctx context.Context, c *client.Client, argPath string) error {
+	id, err := strconv.Atoi(argPath)
+	if err != nil {
+		return errors.New("expected numerical id as input")
+	}
+
+	original, doc, err := fetchBook(ctx, c, id)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile("", "bmc-book-*.yaml")
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to create temporary file: %v", err))
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	header := []string{
+		fmt.Sprintf("# Editing book %s. Lines starting with '#' are ignored.", argPath),
+		"# Save the file empty to cancel.",
+	}
+	content, err := renderDoc(doc)
+	if err != nil {
+		return err
+	}
+	fieldErrs := validate.Errors{}
+	retries := 0
+	for {
+		if retries == 0 {
+			edited, err := runEditor(file.Name(), annotate(header, content, fieldErrs))
+			if err != nil {
+				return err
+			}
+			if len(strings.TrimSpace(stripComments(edited))) == 0 {
+				log.Println("edit cancelled")
+				return nil
+			}
+			content = stripErrors(edited)
+		}
+
+		changes, errs := bookChanges(original, content)
+		if len(errs) == 0 && len(changes) == 0 {
+			log.Println("no changes made")
+			return nil
+		}
+		if len(errs) == 0 {
+			errs = checkChanges(doc, changes)
+		}
+		if len(errs) == 0 {
+			errs, err = sendChanges(ctx, c, original, changes)
+			if client.IsCode(err, problem.CodePreconditionFailed) {
+				latest, latestDoc, err := fetchBook(ctx, c, id)
+				if err != nil {
+					return err
+				}
+				errs = conflicts(original, latest, changes)
+				// the changes are carried over to the latest version, so that
+				// they are all that differs from it
+				if content, err = rebase(latestDoc, changes); err != nil {
+					return err
+				}
+				original, doc = latest, latestDoc
+				if len(errs) == 0 && retries < maxRetries {
+					retries++
+					continue
+				}
+				if len(errs) == 0 {
+					errs.Add("", "the book keeps being changed by someone else, save again to retry")
+				}
+			} else if err != nil {
+				return err
+			}
+		}
+		if len(errs) == 0 {
+			return nil
+		}
+		fieldErrs = errs
+		retries = 0
+	}
+}
+
+// fetchBook gets the book along with its JSON, its Version names the version
+// that was fetched.
+func fetchBook(ctx context.Context, c *client.Client, id int) (book.Book, []byte, error) {
+	b, err := c.GetBook(ctx, id)
+	if err != nil {
+		return book.Book{}, nil, err
+	}
+	doc, err := json.Marshal(b)
+	if err != nil {
+		return book.Book{}, nil, err
+	}
+	return b, doc, nil
+}
+
+// rebase renders the book in doc with the changes applied.
+func rebase(doc []byte, changes map[string]interface{}) (string, error) {
+	p, err := json.Marshal(changes)
+	if err != nil {
+		return "", err
+	}
+	merged, err := patch.Merge(doc, p)
+	if err != nil {
+		return "", err
+	}
+	return renderDoc(merged)
+}
+
+// conflicts reports the changed fields that someone else has also changed
+// since the book was fetched.
+func conflicts(original book.Book, latest book.Book, changes map[string]interface{}) validate.Errors {
+	before, _ := json.Marshal(original)
+	after, _ := json.Marshal(latest)
+	var was, now map[string]json.RawMessage
+	json.Unmarshal(before, &was)
+	json.Unmarshal(after, &now)
+
+	errs := validate.Errors{}
+	for _, name := range editorFields {
+		if _, ok := changes[name]; ok && !bytes.Equal(was[name], now[name]) {
+			errs.Add(name, "was changed to %s by someone else since the book was opened, "+
+				"save again to overwrite it", now[name])
+		}
+	}
+	return errs
+}
+
+// renderDoc writes the fields of a JSON book as YAML, editorFields first and
+// in order. The id is left out, as it cannot be edited.
+func renderDoc(doc []byte) (string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return "", err
+	}
+	out := yaml.MapSlice{}
+	for _, name := range editorFields {
+		if value, ok := fields[name]; ok {
+			out = append(out, yaml.MapItem{Key: name, Value: value})
+			delete(fields, name)
+		}
+	}
+	delete(fields, "id")
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out = append(out, yaml.MapItem{Key: name, Value: fields[name]})
+	}
+	rendered, err := yaml.Marshal(out)
+	return string(rendered), err
+}
+
+// runEditor opens content in the editor and returns what was saved, tests
+// replace it to script the edits.
+var runEditor = execEditor
+
+// execEditor writes content to file, waits for the editor to exit and returns
+// what it saved. The editor command may carry arguments, e.g. "code --wait".
+func execEditor(file string, content string) (string, error) {
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		return "", errors.New(fmt.Sprintf("unable to write temporary file: %v", err))
+	}
+	editor := os.Getenv("VISUAL")
+	if len(editor) == 0 {
+		editor = os.Getenv("EDITOR")
+	}
+	if len(editor) == 0 {
+		editor = "vi"
+	}
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], file)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.New(fmt.Sprintf("editor %s failed: %v", editor, err))
+	}
+	edited, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("unable to read temporary file: %v", err))
+	}
+	return string(edited), nil
+}
+
+// bookChanges compares the edited YAML with the original book and returns
+// the changes as a merge patch, in which removed fields are null.
+func bookChanges(original book.Book, content string) (map[string]interface{}, validate.Errors) {
+	errs := validate.Errors{}
+	var edited map[string]interface{}
+	if err := yaml.Unmarshal([]byte(content), &edited); err != nil {
+		errs.Add("", "invalid YAML: %v", err)
+		return nil, errs
+	}
+	current, _ := json.Marshal(original)
+	var fields map[string]json.RawMessage
+	json.Unmarshal(current, &fields)
+
+	changes := map[string]interface{}{}
+	for name, value := range edited {
+		switch value.(type) {
+		case map[interface{}]interface{}, []interface{}:
+			errs.Add(name, "expected a single value")
+			continue
+		}
+		was, ok := fields[name]
+		if value == nil && ok && (string(was) == `""` || string(was) == "0") {
+			continue
+		}
+		if now, _ := json.Marshal(value); ok && bytes.Equal(now, was) {
+			continue
+		}
+		changes[name] = value
+	}
+	for _, name := range editorFields {
+		if _, ok := edited[name]; !ok {
+			changes[name] = nil
+		}
+	}
+	return changes, errs
+}
+
+// checkChanges applies the changes locally and checks the result, so that
+// mistakes the server would reject are reported without a round trip. Values
+// of the wrong type and unknown fields are left for the server to report.
+func checkChanges(doc []byte, changes map[string]interface{}) validate.Errors {
+	p, err := json.Marshal(changes)
+	if err != nil {
+		return nil
+	}
+	patched, err := patch.Merge(doc, p)
+	if err != nil {
+		return nil
+	}
+	var b book.Book
+	if err := json.Unmarshal(patched, &b); err != nil {
+		return nil
+	}
+	errs, _ := b.Validate().(validate.Errors)
+	return errs
+}
+
+// sendChanges sends the changes on condition that the book is still at the
+// version that was fetched. Rejected changes are returned as errors to show in
+// the editor and any other failure as err.
+func sendChanges(ctx context.Context, c *client.Client, original book.Book, changes map[string]interface{}) (validate.Errors, error) {
+	_, err := c.PatchBook(ctx, original.Id, original.Version, changes)
+	clientErr, ok := err.(*client.Error)
+	if !ok || (clientErr.Status != http.StatusBadRequest && clientErr.Status != http.StatusConflict &&
+		clientErr.Status != http.StatusUnprocessableEntity) {
+		return nil, err
+	}
+	errs := validate.Errors{}
+	for _, f := range clientErr.Errors {
+		errs.Add(f.Field, "%s", f.Message)
+	}
+	if len(errs) == 0 {
+		errs.Add("", "%s", clientErr.Problem.Error())
+	}
+	return errs, nil
+}
+
+// annotate puts the header and the errors not about a known line at the top
+// and every other error as a comment above the line of its field.
+func annotate(header []string, content string, errs validate.Errors) string {
+	lines := strings.Split(content, "\n")
+	placed := map[int]bool{}
+	byLine := map[int][]string{}
+	for i, f := range errs {
+		for n, line := range lines {
+			if len(f.Field) > 0 && strings.HasPrefix(line, f.Field+":") {
+				byLine[n] = append(byLine[n], errorPrefix+f.Message)
+				placed[i] = true
+				break
+			}
+		}
+	}
+	out := append([]string{}, header...)
+	for i, f := range errs {
+		if placed[i] {
+			continue
+		}
+		if len(f.Field) > 0 {
+			out = append(out, errorPrefix+f.Field+": "+f.Message)
+		} else {
+			out = append(out, errorPrefix+f.Message)
+		}
+	}
+	for n, line := range lines {
+		out = append(out, byLine[n]...)
+		out = append(out, line)
+	}
+	return strings.Join(out, "\n")
+}
+
+// stripErrors removes the header and the error comments added by annotate,
+// leaving any comments of the user's own.
+func stripErrors(content string) string {
+	lines := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, errorPrefix) || strings.HasPrefix(line, "# Editing book ") ||
+			strings.HasPrefix(line, "# Save the file empty") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func stripComments(content string) string {
+	lines := []string{}
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,175 @@
+package edit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/client"
+	"github.com/masnax/canonical-bookmanager/internal/testserver"
+)
+
+// newBook serves the API and returns a client for it, along with the id of a
+// book it holds.
+func newBook(t *testing.T) (*client.Client, int) {
+	c := testserver.New(t, nil)
+	b, err := c.CreateBook(context.Background(), book.Book{Title: "Dune", Author: "Frank Herbert",
+		Published: "1965-08-01", Edition: 1, Genre: "scifi"})
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	return c, b.Id
+}
+
+// edit is one session in the editor: it gets what the editor was opened with
+// and returns what is saved.
+type edit func(t *testing.T, c *client.Client, id int, content string) string
+
+// unchanged saves the content as it is.
+func unchanged(t *testing.T, c *client.Client, id int, content string) string {
+	return content
+}
+
+// cancel saves the file with only comments left.
+func cancel(t *testing.T, c *client.Client, id int, content string) string {
+	return strings.Replace(content, "\n", "\n# ", -1)
+}
+
+// replace saves the content with every old replaced by its new, in pairs.
+func replace(oldnew ...string) edit {
+	return func(t *testing.T, c *client.Client, id int, content string) string {
+		return strings.NewReplacer(oldnew...).Replace(content)
+	}
+}
+
+// changeBook has someone else change the book while it is being edited, then
+// makes the edit.
+func changeBook(changes map[string]interface{}, then edit) edit {
+	return func(t *testing.T, c *client.Client, id int, content string) string {
+		if _, err := c.PatchBook(context.Background(), id, 0, changes); err != nil {
+			t.Fatalf("expected no error, got [%v]", err)
+		}
+		return then(t, c, id, content)
+	}
+}
+
+func TestEditBookInEditor(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		edits     []edit
+		expected  string
+		annotated []string
+	}{
+		{
+			desc:     "no changes",
+			edits:    []edit{unchanged},
+			expected: "Dune|Frank Herbert|1|scifi",
+		},
+		{
+			desc:     "cancelled",
+			edits:    []edit{cancel},
+			expected: "Dune|Frank Herbert|1|scifi",
+		},
+		{
+			desc:     "changed and removed fields",
+			edits:    []edit{replace("title: Dune", "title: Emma", "genre: scifi\n", "")},
+			expected: "Emma|Frank Herbert|1|",
+		},
+		{
+			desc:      "validation error is annotated and the editor opened again",
+			edits:     []edit{replace("edition: 1", "edition: 0"), replace("edition: 0", "edition: 2")},
+			expected:  "Dune|Frank Herbert|2|scifi",
+			annotated: []string{"# error: ", "\nedition: 0"},
+		},
+		{
+			desc:      "error rejected by the server is annotated",
+			edits:     []edit{replace("title: Dune", "title: Emma\nisbn: 123"), replace("isbn: 123\n", "")},
+			expected:  "Emma|Frank Herbert|1|scifi",
+			annotated: []string{"# error: ", "\nisbn: 123"},
+		},
+		{
+			desc:      "invalid yaml is annotated",
+			edits:     []edit{replace("title: Dune", "title: [Emma"), replace("title: [Emma", "title: Emma")},
+			expected:  "Emma|Frank Herbert|1|scifi",
+			annotated: []string{"# error: invalid YAML"},
+		},
+		{
+			desc: "changes are rebased on changes to other fields",
+			edits: []edit{changeBook(map[string]interface{}{"author": "F. Herbert"},
+				replace("title: Dune", "title: Emma"))},
+			expected: "Emma|F. Herbert|1|scifi",
+		},
+		{
+			desc: "conflicting changes are annotated and saved again",
+			edits: []edit{changeBook(map[string]interface{}{"title": "Dune Messiah", "genre": "fantasy"},
+				replace("title: Dune", "title: Emma")), unchanged},
+			expected:  "Emma|Frank Herbert|1|fantasy",
+			annotated: []string{"# error: was changed to \"Dune Messiah\" by someone else", "\ntitle: Emma", "\ngenre: fantasy"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			ctx := context.Background()
+			c, id := newBook(t)
+			opened := []string{}
+			runEditor = func(file string, content string) (string, error) {
+				if len(opened) == len(tc.edits) {
+					return "", errors.New(fmt.Sprintf("expected the editor to be opened %d times", len(tc.edits)))
+				}
+				opened = append(opened, content)
+				return tc.edits[len(opened)-1](t, c, id, content), nil
+			}
+			defer func() { runEditor = execEditor }()
+
+			err := EditBookInEditor(ctx, c, fmt.Sprintf("%d", id))
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if len(opened) != len(tc.edits) {
+				t.Fatalf("expected the editor to be opened %d times, got [%d]", len(tc.edits), len(opened))
+			}
+			if !strings.HasPrefix(opened[0], "# Editing book ") || strings.Contains(opened[0], "# error: ") {
+				t.Fatalf("expected the book without errors, got [%s]", opened[0])
+			}
+			for _, s := range tc.annotated {
+				if !strings.Contains(opened[1], s) {
+					t.Fatalf("expected the editor to be opened again with %q, got [%s]", s, opened[1])
+				}
+			}
+			b, err := c.GetBook(ctx, id)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			got := fmt.Sprintf("%s|%s|%d|%s", b.Title, b.Author, b.Edition, b.Genre)
+			if got != tc.expected {
+				t.Fatalf("expected %s, got [%s]", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestEditBookInEditorErrors(t *testing.T) {
+	testCases := []struct {
+		desc string
+		id   string
+	}{
+		{desc: "invalid id", id: "one"},
+		{desc: "missing book", id: "9999"},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			c, _ := newBook(t)
+			runEditor = func(file string, content string) (string, error) {
+				t.Fatalf("expected the editor not to be opened")
+				return "", nil
+			}
+			defer func() { runEditor = execEditor }()
+			if err := EditBookInEditor(context.Background(), c, tc.id); err == nil {
+				t.Fatalf("expected an error, got none")
+			}
+		})
+	}
+}
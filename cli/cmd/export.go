@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+
+	"github.com/masnax/canonical-bookmanager/cli/cmd/transfer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	formatFlag  string
+	archiveFlag bool
+)
+
+var cmdExport = &cobra.Command{
+	Use:   "export [file|-]",
+	Short: "Export books to a JSON Lines, CSV or YAML file, or to standard output",
+	Long: `Export the books matching --filter, in the order of --sort, to a file or
+to standard output, as JSON Lines, CSV or YAML. Every format can be read
+back with 'bmc import'.
+
+--archive exports the books along with every collection and the books it
+holds into a gzipped tar archive, which 'bmc import' restores into another
+server: the books get new ids and are added to collections of the same
+name, which are created if needed.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if archiveFlag && cmd.Flags().Changed("format") {
+			return errors.New("--format does not apply to archives, which hold JSON Lines")
+		}
+		opts, err := listOptions(cmd)
+		if err != nil {
+			return err
+		}
+		var out io.Writer = os.Stdout
+		if len(args) > 0 && args[0] != "-" {
+			f, err := os.Create(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+
+		if archiveFlag {
+			var books, collections int
+			books, collections, err = transfer.ExportArchive(cmd.Context(), apiClient, out, opts)
+			if err == nil {
+				log.Printf("exported %d book(s) and %d collection(s)", books, collections)
+			}
+		} else {
+			err = transfer.ExportBooks(cmd.Context(), apiClient, out, formatFlag, opts)
+		}
+		// a partial export is not left behind
+		if err != nil && out != os.Stdout {
+			os.Remove(args[0])
+		}
+		return err
+	},
+}
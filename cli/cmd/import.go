@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/cli/cmd/output"
+	"github.com/masnax/canonical-bookmanager/cli/cmd/transfer"
+	"github.com/masnax/canonical-bookmanager/client"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mapFlags       []string
+	dryRunFlag     bool
+	bestEffortFlag bool
+)
+
+var importErrorColumns = output.Columns(book.ImportError{})
+
+var rejectedFieldColumns = output.Columns(problem.FieldError{})
+
+var membershipColumns = output.Columns(transfer.Membership{})
+
+var cmdImport = &cobra.Command{
+	Use:   "import file|-",
+	Short: "Import books from a CSV, JSON or YAML file, or from standard input with -",
+	Long: `Import books from a CSV file with a header row, a JSON array of books,
+JSON books one per line or a YAML sequence of books, read from a file or
+from standard input with -. Columns and fields are named as in
+'bmc list -o json', other names can be mapped to them with --map, e.g.
+--map "Book Title=title" --map isbn=-.
+
+Nothing is imported unless every row is valid, or with --best-effort the
+valid rows are imported and the others are reported. --dry-run only checks
+the rows.
+
+An archive written by 'bmc export --archive' is imported as a whole, then
+its books are added to collections of the same name as in the archive,
+which are created if needed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mapping, err := transfer.ParseMapping(mapFlags)
+		if err != nil {
+			return err
+		}
+		var in io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+		opts := transfer.ImportOptions{Mapping: mapping, BestEffort: bestEffortFlag, DryRun: dryRunFlag}
+		if len(collectionFlag) > 0 {
+			if opts.CollectionID, err = importCollection(cmd.Context(), collectionFlag); err != nil {
+				return err
+			}
+		}
+
+		report, err := transfer.ImportBooks(cmd.Context(), apiClient, in, opts)
+		if err != nil && report.Archive && report.Imported > 0 {
+			if len(report.Missing) > 0 {
+				if err := render(report.Missing, membershipColumns, nil); err != nil {
+					log.Print(err)
+				}
+			}
+			return errors.New(fmt.Sprintf("%v, the books were imported with ids %v", err, report.IDs))
+		}
+		if e, ok := err.(*client.Error); ok && e.Code == problem.CodeValidationFailed {
+			render(e.Errors, rejectedFieldColumns, nil)
+			return errors.New(fmt.Sprintf("%s, rerun with --best-effort to import the valid rows", e.Detail))
+		}
+		if err != nil {
+			return err
+		}
+		if len(report.Errors) > 0 {
+			if err := render(report.Errors, importErrorColumns, nil); err != nil {
+				return err
+			}
+		}
+		switch {
+		case report.DryRun:
+			log.Printf("dry run: %d of %d row(s) are valid", report.Rows-report.Failed, report.Rows)
+			if report.Archive {
+				log.Printf("dry run: %d book(s) would be added to %d collection(s)", report.Members, report.Collections)
+			}
+		case report.Archive:
+			log.Printf("imported %d book(s) and added %d of them to %d collection(s)",
+				report.Imported, report.Members, report.Collections)
+		case report.Failed > 0:
+			log.Printf("imported %d of %d row(s), %d rejected", report.Imported, report.Rows, report.Failed)
+		default:
+			log.Printf("imported %d book(s)", report.Imported)
+		}
+		if len(report.Errors) >= book.MaxImportErrors {
+			log.Printf("the server lists at most %d errors, fix them and rerun with --dry-run to see more", book.MaxImportErrors)
+		}
+		return nil
+	},
+}
+
+// importCollection returns the id of the named collection, which is created
+// if needed, unless this is a dry run.
+func importCollection(ctx context.Context, name string) (int, error) {
+	if dryRunFlag {
+		found, err := apiClient.FindCollection(ctx, name)
+		if client.IsCode(err, problem.CodeNotFound) {
+			log.Printf("collection %s does not exist and would be created", name)
+			return 0, nil
+		}
+		return found.ID, err
+	}
+	id, created, err := transfer.FindOrCreateCollection(ctx, apiClient, name)
+	if created {
+		log.Printf("created collection %s with id %d", name, id)
+	}
+	return id, err
+}
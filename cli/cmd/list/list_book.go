@@ -1,40 +1,34 @@
 package list
 
 import (
-	"fmt"
-	"log"
-	"reflect"
+	"context"
 
 	"github.com/masnax/canonical-bookmanager/book"
-	"github.com/masnax/canonical-bookmanager/cli/cmd/rest"
-	"github.com/mitchellh/mapstructure"
+	"github.com/masnax/canonical-bookmanager/cli/cmd/output"
+	"github.com/masnax/canonical-bookmanager/client"
 )
 
-func GetBookList(sourceUrl string, path string, argPath string) ([]string, [][]string) {
-	url := sourceUrl + path + argPath
-	data := []book.Book{}
-	res, err := rest.MakeRequest(url, "GET", nil)
-	if err != nil {
-		log.Print(err)
-	}
-	err = mapstructure.Decode(res, &data)
-	if err != nil {
-		log.Print(err)
-	}
+// BookColumns are the fields of a book, the description is only shown in wide
+// output as it tends to be long.
+var BookColumns = output.Columns(book.Book{}, "description")
 
-	out := [][]string{}
-	keys := []string{}
-	r := reflect.ValueOf(book.Book{})
-	for i := 0; i < r.NumField(); i++ {
-		keys = append(keys, r.Type().Field(i).Name)
-	}
-	for _, b := range data {
-		r := reflect.ValueOf(b)
-		row := []string{}
-		for i := 0; i < r.NumField(); i++ {
-			row = append(row, fmt.Sprint(r.Field(i).Interface()))
-		}
-		out = append(out, row)
+// GetBookList lists the books in the collection with the given id, or every
+// book when it is 0, along with the token of the next page.
+func GetBookList(ctx context.Context, c *client.Client, collectionID int, opts client.ListOptions,
+	page PageOptions) ([]book.Book, string, error) {
+	opts = page.apply(opts)
+	var data []book.Book
+	var info client.Page
+	var err error
+	switch {
+	case collectionID > 0 && page.All:
+		data, err = c.ListCollectionBooks(ctx, collectionID, opts)
+	case collectionID > 0:
+		data, info, err = c.ListCollectionBooksPage(ctx, collectionID, opts)
+	case page.All:
+		data, err = c.ListBooks(ctx, opts)
+	default:
+		data, info, err = c.ListBooksPage(ctx, opts)
 	}
-	return keys, out
+	return data, info.NextPageToken, err
 }
@@ -1,73 +1,27 @@
 package list
 
 import (
-	"fmt"
-	"log"
-	"reflect"
+	"context"
 
-	"github.com/masnax/canonical-bookmanager/cli/cmd/rest"
+	"github.com/masnax/canonical-bookmanager/cli/cmd/output"
+	"github.com/masnax/canonical-bookmanager/client"
 	"github.com/masnax/canonical-bookmanager/collection"
-	"github.com/mitchellh/mapstructure"
 )
 
-func GetCollectionStatList(sourceUrl string, path string, argPath string) ([]string, [][]string) {
-	url := sourceUrl + path + argPath
-	data := []collection.BookCollection{}
-	res, err := rest.MakeRequest(url, "GET", nil)
-	if err != nil {
-		log.Print(err)
-		return nil, nil
-	}
-	err = mapstructure.Decode(res, &data)
-	if err != nil {
-		log.Printf("unable to parse request with error: %v", err)
-		return nil, nil
-	}
-
-	out := [][]string{}
-	keys := []string{}
-	r := reflect.ValueOf(collection.BookCollection{})
-	for i := 0; i < r.NumField(); i++ {
-		keys = append(keys, r.Type().Field(i).Name)
-	}
-	for _, b := range data {
-		r := reflect.ValueOf(b)
-		row := []string{}
-		for i := 0; i < r.NumField(); i++ {
-			row = append(row, fmt.Sprint(r.Field(i).Interface()))
-		}
-		out = append(out, row)
-	}
-	return keys, out
-}
-
-func GetCollectionList(sourceUrl string, path string, argPath string) ([]string, [][]string) {
-	url := sourceUrl + path + argPath
-	data := []collection.Collection{}
-	res, err := rest.MakeRequest(url, "GET", nil)
-	if err != nil {
-		log.Print(err)
-		return nil, nil
-	}
-	err = mapstructure.Decode(res, &data)
-	if err != nil {
-		log.Printf("unable to parse request with error: %v", err)
-		return nil, nil
-	}
+var (
+	CollectionColumns     = output.Columns(collection.Collection{})
+	CollectionStatColumns = output.Columns(collection.BookCollection{})
+)
 
-	out := [][]string{}
-	keys := []string{}
-	r := reflect.ValueOf(collection.Collection{})
-	for i := 0; i < r.NumField(); i++ {
-		keys = append(keys, r.Type().Field(i).Name)
-	}
-	for _, b := range data {
-		r := reflect.ValueOf(b)
-		row := []string{}
-		for i := 0; i < r.NumField(); i++ {
-			row = append(row, fmt.Sprint(r.Field(i).Interface()))
-		}
-		out = append(out, row)
-	}
-	return keys, out
+// GetCollectionStatList lists collections with the number of books in each,
+// along with the token of the next page.
+func GetCollectionStatList(ctx context.Context, c *client.Client, opts client.ListOptions,
+	page PageOptions) ([]collection.BookCollection, string, error) {
+	opts = page.apply(opts)
+	if page.All {
+		data, err := c.ListCollections(ctx, opts)
+		return data, "", err
+	}
+	data, info, err := c.ListCollectionsPage(ctx, opts)
+	return data, info.NextPageToken, err
 }
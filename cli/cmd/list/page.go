@@ -0,0 +1,17 @@
+package list
+
+import "github.com/masnax/canonical-bookmanager/client"
+
+// PageOptions selects the page of a listing to fetch. With All set, every
+// page from Token onwards is fetched and combined.
+type PageOptions struct {
+	Limit int
+	Token string
+	All   bool
+}
+
+func (o PageOptions) apply(opts client.ListOptions) client.ListOptions {
+	opts.Limit = o.Limit
+	opts.PageToken = o.Token
+	return opts
+}
@@ -0,0 +1,232 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// jsonPathNode is a piece of a JSONPath template: text printed as it is, a
+// quoted literal, a path whose values are printed, or the start or end of a
+// range over the values of a path.
+type jsonPathNode struct {
+	kind  string
+	value string
+}
+
+// JSONPath prints data through a template in the style of kubectl, e.g.
+// {range [*]}{.id}{"\t"}{.title}{"\n"}{end}. Paths are made of .field, [n]
+// and [*] steps, relative to the value being ranged over, or to the root when
+// they start with $. A path with several values prints them separated by
+// spaces.
+func JSONPath(w io.Writer, tmpl string, data interface{}) error {
+	nodes, err := parseJSONPath(tmpl)
+	if err != nil {
+		return errors.New(fmt.Sprintf("invalid jsonpath %q: %v", tmpl, err))
+	}
+	return execJSONPath(w, nodes, data, data)
+}
+
+func parseJSONPath(tmpl string) ([]jsonPathNode, error) {
+	nodes := []jsonPathNode{}
+	depth := 0
+	for len(tmpl) > 0 {
+		start := strings.Index(tmpl, "{")
+		if start < 0 {
+			nodes = append(nodes, jsonPathNode{kind: "text", value: tmpl})
+			break
+		}
+		if start > 0 {
+			nodes = append(nodes, jsonPathNode{kind: "text", value: tmpl[:start]})
+		}
+		end := closingBrace(tmpl, start)
+		if end < 0 {
+			return nil, errors.New("unclosed {")
+		}
+		expr := strings.TrimSpace(tmpl[start+1 : end])
+		tmpl = tmpl[end+1:]
+		switch {
+		case strings.HasPrefix(expr, `"`):
+			text, err := strconv.Unquote(expr)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid literal %s", expr))
+			}
+			nodes = append(nodes, jsonPathNode{kind: "text", value: text})
+		case strings.HasPrefix(expr, "range "):
+			depth++
+			nodes = append(nodes, jsonPathNode{kind: "range", value: strings.TrimSpace(expr[len("range "):])})
+		case expr == "end":
+			if depth == 0 {
+				return nil, errors.New("{end} without {range}")
+			}
+			depth--
+			nodes = append(nodes, jsonPathNode{kind: "end"})
+		default:
+			nodes = append(nodes, jsonPathNode{kind: "path", value: expr})
+		}
+	}
+	if depth > 0 {
+		return nil, errors.New("{range} without {end}")
+	}
+	return nodes, nil
+}
+
+// closingBrace returns the index of the brace closing the one at start,
+// skipping braces in quoted literals.
+func closingBrace(tmpl string, start int) int {
+	quoted := false
+	for i := start + 1; i < len(tmpl); i++ {
+		switch {
+		case tmpl[i] == '\\' && quoted:
+			i++
+		case tmpl[i] == '"':
+			quoted = !quoted
+		case tmpl[i] == '}' && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+// execJSONPath prints nodes, with relative paths evaluated against current.
+func execJSONPath(w io.Writer, nodes []jsonPathNode, root interface{}, current interface{}) error {
+	for i := 0; i < len(nodes); i++ {
+		n := nodes[i]
+		switch n.kind {
+		case "text":
+			io.WriteString(w, n.value)
+		case "path":
+			values, err := evalPath(n.value, root, current)
+			if err != nil {
+				return err
+			}
+			printed := []string{}
+			for _, v := range values {
+				printed = append(printed, format(v))
+			}
+			io.WriteString(w, strings.Join(printed, " "))
+		case "range":
+			values, err := evalPath(n.value, root, current)
+			if err != nil {
+				return err
+			}
+			end := matchingEnd(nodes, i)
+			for _, v := range values {
+				if err := execJSONPath(w, nodes[i+1:end], root, v); err != nil {
+					return err
+				}
+			}
+			i = end
+		}
+	}
+	return nil
+}
+
+// matchingEnd returns the index of the end of the range starting at start,
+// parseJSONPath has checked that there is one.
+func matchingEnd(nodes []jsonPathNode, start int) int {
+	depth := 0
+	for i := start; i < len(nodes); i++ {
+		switch nodes[i].kind {
+		case "range":
+			depth++
+		case "end":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(nodes)
+}
+
+// evalPath returns the values a path leads to.
+func evalPath(path string, root interface{}, current interface{}) ([]interface{}, error) {
+	values := []interface{}{current}
+	if strings.HasPrefix(path, "$") {
+		values, path = []interface{}{root}, path[1:]
+	} else if strings.HasPrefix(path, "@") {
+		path = path[1:]
+	}
+	for len(path) > 0 {
+		next := []interface{}{}
+		switch {
+		case path == ".":
+			path = ""
+			continue
+		case strings.HasPrefix(path, ".["):
+			path = path[1:]
+			continue
+		case strings.HasPrefix(path, "."):
+			end := strings.IndexAny(path[1:], ".[")
+			if end < 0 {
+				end = len(path) - 1
+			}
+			key := path[1 : end+1]
+			path = path[end+1:]
+			for _, v := range values {
+				fields, ok := v.(map[string]interface{})
+				if !ok {
+					return nil, errors.New(fmt.Sprintf("cannot look up .%s in %s", key, kind(v)))
+				}
+				value, ok := fields[key]
+				if !ok {
+					return nil, errors.New(fmt.Sprintf(".%s is not found", key))
+				}
+				next = append(next, value)
+			}
+		case strings.HasPrefix(path, "["):
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, errors.New("unclosed [")
+			}
+			index := path[1:end]
+			path = path[end+1:]
+			for _, v := range values {
+				items, ok := v.([]interface{})
+				if !ok {
+					return nil, errors.New(fmt.Sprintf("cannot index [%s] into %s", index, kind(v)))
+				}
+				if index == "*" {
+					next = append(next, items...)
+					continue
+				}
+				n, err := strconv.Atoi(index)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("invalid index [%s]", index))
+				}
+				if n < 0 {
+					n += len(items)
+				}
+				if n < 0 || n >= len(items) {
+					return nil, errors.New(fmt.Sprintf("index [%s] is out of range", index))
+				}
+				next = append(next, items[n])
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("unexpected %q, expected .field, [n] or [*]", path))
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// kind names the JSON type of a value for errors.
+func kind(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case nil:
+		return "null"
+	default:
+		return "a number"
+	}
+}
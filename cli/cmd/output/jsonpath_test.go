@@ -0,0 +1,70 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestJSONPath(t *testing.T) {
+	data, err := normalize([]map[string]interface{}{
+		{"id": 1, "title": "Dune", "tags": []string{"scifi", "classic"}, "series": map[string]interface{}{"name": "Dune", "part": 1}},
+		{"id": 2, "title": "Emma", "tags": []string{}, "series": nil},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	testCases := []struct {
+		desc      string
+		tmpl      string
+		expected  string
+		expectErr bool
+	}{
+		{desc: "text only", tmpl: "books", expected: "books"},
+		{desc: "index", tmpl: "{[0].title}", expected: "Dune"},
+		{desc: "negative index", tmpl: "{[-1].title}", expected: "Emma"},
+		{desc: "root", tmpl: "{$[1].id}", expected: "2"},
+		{desc: "current", tmpl: "{@[1].id}", expected: "2"},
+		{desc: "dot before an index", tmpl: "{.[0].id}", expected: "1"},
+		{desc: "wildcard", tmpl: "{[*].title}", expected: "Dune Emma"},
+		{desc: "nested wildcards", tmpl: "{[*].tags[*]}", expected: "scifi classic"},
+		{desc: "nested field", tmpl: "{[0].series.name}-{[0].series.part}", expected: "Dune-1"},
+		{desc: "nested value as json", tmpl: "{[0].series}", expected: `{"name":"Dune","part":1}`},
+		{desc: "null", tmpl: "{[1].series}", expected: ""},
+		{desc: "range", tmpl: `{range [*]}{.id}{"\t"}{.title}{"\n"}{end}`, expected: "1\tDune\n2\tEmma\n"},
+		{desc: "nested ranges", tmpl: `{range [*]}{.id}:{range .tags[*]}<{@}>{end};{end}`,
+			expected: "1:<scifi><classic>;2:;"},
+		{desc: "root inside a range", tmpl: `{range [*]}{$[0].id}{end}`, expected: "11"},
+		{desc: "literal with braces", tmpl: `{"{}"}{[0].id}`, expected: "{}1"},
+		{desc: "literal with an escaped quote", tmpl: `{"\"}"}`, expected: `"}`},
+		{desc: "unclosed brace", tmpl: "{[0].id", expectErr: true},
+		{desc: "unclosed index", tmpl: "{[0.id}", expectErr: true},
+		{desc: "invalid index", tmpl: "{[first]}", expectErr: true},
+		{desc: "index out of range", tmpl: "{[2]}", expectErr: true},
+		{desc: "missing field", tmpl: "{[0].isbn}", expectErr: true},
+		{desc: "field of an array", tmpl: "{.id}", expectErr: true},
+		{desc: "index into an object", tmpl: "{[0][0]}", expectErr: true},
+		{desc: "end without range", tmpl: "{end}", expectErr: true},
+		{desc: "range without end", tmpl: "{range [*]}{.id}", expectErr: true},
+		{desc: "invalid literal", tmpl: `{"\q"}`, expectErr: true},
+		{desc: "unexpected step", tmpl: "{[0]title}", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			var out bytes.Buffer
+			err := JSONPath(&out, tc.tmpl, data)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got [%s]", out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if out.String() != tc.expected {
+				t.Fatalf("expected %q, got [%q]", tc.expected, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+// Package output prints the records fetched by the CLI in the format chosen
+// with --output.
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/yaml.v2"
+)
+
+// Formats lists the formats accepted by Parse, go-template and jsonpath are
+// followed by =template.
+var Formats = []string{"table", "wide", "json", "yaml", "csv", "tsv", "go-template", "jsonpath"}
+
+// Options selects how records are printed. Columns, named by their JSON
+// field, apply to the table, wide, csv and tsv formats.
+type Options struct {
+	Format    string
+	Template  string
+	NoHeaders bool
+	Columns   []string
+}
+
+// Parse reads the --output, --no-headers and --columns flags.
+func Parse(format string, noHeaders bool, columns string) (Options, error) {
+	opts := Options{Format: format, NoHeaders: noHeaders}
+	if i := strings.Index(format, "="); i >= 0 {
+		opts.Format, opts.Template = format[:i], format[i+1:]
+	}
+	switch opts.Format {
+	case "table", "wide", "json", "yaml", "csv", "tsv":
+		if len(opts.Template) > 0 {
+			return opts, errors.New(fmt.Sprintf("output format %s takes no template", opts.Format))
+		}
+	case "go-template", "jsonpath":
+		if len(opts.Template) == 0 {
+			return opts, errors.New(fmt.Sprintf("output format %s needs a template, e.g. -o %s=...", opts.Format, opts.Format))
+		}
+	default:
+		return opts, errors.New(fmt.Sprintf("unknown output format %q, expected one of %v", format, Formats))
+	}
+	for _, c := range strings.Split(columns, ",") {
+		if c = strings.TrimSpace(c); len(c) > 0 {
+			opts.Columns = append(opts.Columns, c)
+		}
+	}
+	return opts, nil
+}
+
+// Column is a field of the records, named by its JSON field. Wide columns are
+// left out of the table format unless asked for.
+type Column struct {
+	Name string
+	Wide bool
+}
+
+// Columns lists the JSON fields of the struct v in order, the ones named in
+// wide are marked as wide.
+func Columns(v interface{}, wide ...string) []Column {
+	columns := []Column{}
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = t.Field(i).Name
+		}
+		c := Column{Name: name}
+		for _, w := range wide {
+			c.Wide = c.Wide || w == name
+		}
+		columns = append(columns, c)
+	}
+	return columns
+}
+
+// Write prints records, which is either a slice of structs or a single struct,
+// whose fields are described by columns.
+func Write(w io.Writer, opts Options, records interface{}, columns []Column) error {
+	data, err := normalize(records)
+	if err != nil {
+		return err
+	}
+	rows, ok := data.([]interface{})
+	if !ok {
+		rows = []interface{}{data}
+	}
+
+	switch opts.Format {
+	case "json":
+		out, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", out)
+		return err
+	case "yaml":
+		var out []byte
+		if _, ok := data.([]interface{}); ok {
+			ordered := []yaml.MapSlice{}
+			for _, row := range rows {
+				ordered = append(ordered, orderedRow(row, columns))
+			}
+			out, err = yaml.Marshal(ordered)
+		} else {
+			out, err = yaml.Marshal(orderedRow(data, columns))
+		}
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	case "go-template":
+		t, err := template.New("output").Option("missingkey=error").Parse(opts.Template)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid go-template: %v", err))
+		}
+		return t.Execute(w, data)
+	case "jsonpath":
+		return JSONPath(w, opts.Template, data)
+	}
+
+	selected, err := selectColumns(columns, opts)
+	if err != nil {
+		return err
+	}
+	table := [][]string{}
+	for _, row := range rows {
+		fields, _ := row.(map[string]interface{})
+		line := []string{}
+		for _, c := range selected {
+			line = append(line, format(fields[c]))
+		}
+		table = append(table, line)
+	}
+
+	switch opts.Format {
+	case "csv", "tsv":
+		cw := csv.NewWriter(w)
+		if opts.Format == "tsv" {
+			cw.Comma = '\t'
+		}
+		if !opts.NoHeaders {
+			cw.Write(selected)
+		}
+		cw.WriteAll(table)
+		return cw.Error()
+	default:
+		tw := tablewriter.NewWriter(w)
+		tw.SetAutoWrapText(false)
+		tw.SetAlignment(tablewriter.ALIGN_LEFT)
+		tw.SetRowLine(true)
+		if !opts.NoHeaders {
+			tw.SetHeader(selected)
+		}
+		tw.AppendBulk(table)
+		tw.Render()
+		return nil
+	}
+}
+
+// selectColumns returns the names of the columns to print, the columns asked
+// for or else every column but the wide ones, which the wide, csv and tsv
+// formats include.
+func selectColumns(columns []Column, opts Options) ([]string, error) {
+	names := []string{}
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+	if len(opts.Columns) > 0 {
+		for _, name := range opts.Columns {
+			if !contains(names, name) {
+				return nil, errors.New(fmt.Sprintf("unknown column %q, expected any of %s", name, strings.Join(names, ",")))
+			}
+		}
+		return opts.Columns, nil
+	}
+	selected := []string{}
+	for _, c := range columns {
+		if !c.Wide || opts.Format != "table" {
+			selected = append(selected, c.Name)
+		}
+	}
+	return selected, nil
+}
+
+// normalize turns records into the values their JSON decodes to, so that
+// templates see the same field names as JSON output. Whole numbers are kept
+// as int64, so that they do not print in exponent form.
+func normalize(records interface{}) (interface{}, error) {
+	b, err := json.Marshal(records)
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var data interface{}
+	if err := d.Decode(&data); err != nil {
+		return nil, err
+	}
+	return numbers(data), nil
+}
+
+func numbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = numbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = numbers(e)
+		}
+	}
+	return v
+}
+
+// orderedRow keeps the fields of a record in the order of its columns.
+func orderedRow(row interface{}, columns []Column) yaml.MapSlice {
+	fields, _ := row.(map[string]interface{})
+	out := yaml.MapSlice{}
+	for _, c := range columns {
+		if v, ok := fields[c.Name]; ok {
+			out = append(out, yaml.MapItem{Key: c.Name, Value: v})
+		}
+	}
+	return out
+}
+
+// format prints a value as it appears in a table cell, nested values as JSON.
+func format(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type record struct {
+	ID     int      `json:"id"`
+	Title  string   `json:"title"`
+	Tags   []string `json:"tags"`
+	Note   string   `json:"note"`
+	Hidden string   `json:"-"`
+}
+
+var (
+	recordColumns = Columns(record{}, "note")
+	records       = []record{
+		{ID: 1, Title: "Dune", Tags: []string{"scifi"}, Note: "first, of many"},
+		{ID: 2, Title: "Emma", Note: `"quoted"`},
+	}
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		format    string
+		columns   string
+		expected  Options
+		expectErr bool
+	}{
+		{desc: "table", format: "table", expected: Options{Format: "table"}},
+		{desc: "csv with columns", format: "csv", columns: " id, ,title ",
+			expected: Options{Format: "csv", Columns: []string{"id", "title"}}},
+		{desc: "go-template", format: "go-template={{.id}}", expected: Options{Format: "go-template", Template: "{{.id}}"}},
+		{desc: "jsonpath with = in the template", format: `jsonpath={"a=b"}`,
+			expected: Options{Format: "jsonpath", Template: `{"a=b"}`}},
+		{desc: "template without a template", format: "go-template", expectErr: true},
+		{desc: "template with an empty template", format: "jsonpath=", expectErr: true},
+		{desc: "json with a template", format: "json={{.id}}", expectErr: true},
+		{desc: "unknown format", format: "xml", expectErr: true},
+		{desc: "empty format", format: "", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			opts, err := Parse(tc.format, false, tc.columns)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got [%+v]", opts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if fmt.Sprintf("%+v", opts) != fmt.Sprintf("%+v", tc.expected) {
+				t.Fatalf("expected %+v, got [%+v]", tc.expected, opts)
+			}
+		})
+	}
+}
+
+func TestColumns(t *testing.T) {
+	expected := "[{Name:id Wide:false} {Name:title Wide:false} {Name:tags Wide:false} {Name:note Wide:true}]"
+	if got := fmt.Sprintf("%+v", recordColumns); got != expected {
+		t.Fatalf("expected %s, got [%s]", expected, got)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		format    string
+		noHeaders bool
+		columns   string
+		records   interface{}
+		expected  string
+		expectErr bool
+	}{
+		{desc: "table leaves out wide columns", format: "table", records: records, expected: `
++----+-------+-----------+
+| ID | TITLE |   TAGS    |
++----+-------+-----------+
+| 1  | Dune  | ["scifi"] |
++----+-------+-----------+
+| 2  | Emma  |           |
++----+-------+-----------+
+`},
+		{desc: "wide", format: "wide", noHeaders: true, records: records[:1], expected: `
++---+------+-----------+----------------+
+| 1 | Dune | ["scifi"] | first, of many |
++---+------+-----------+----------------+
+`},
+		{desc: "json", format: "json", records: records[1], expected: `
+{
+  "id": 2,
+  "title": "Emma",
+  "tags": null,
+  "note": "\"quoted\""
+}
+`},
+		{desc: "yaml keeps the column order", format: "yaml", records: records, expected: `
+- id: 1
+  title: Dune
+  tags:
+  - scifi
+  note: first, of many
+- id: 2
+  title: Emma
+  tags: null
+  note: '"quoted"'
+`},
+		{desc: "yaml of a single record", format: "yaml", records: records[1], expected: `
+id: 2
+title: Emma
+tags: null
+note: '"quoted"'
+`},
+		{desc: "csv quotes fields and includes wide columns", format: "csv", records: records, expected: `
+id,title,tags,note
+1,Dune,"[""scifi""]","first, of many"
+2,Emma,,"""quoted"""
+`},
+		{desc: "tsv without headers", format: "tsv", noHeaders: true, records: records, expected: `
+1	Dune	"[""scifi""]"	first, of many
+2	Emma		"""quoted"""
+`},
+		{desc: "selected columns in their order", format: "csv", columns: "title,id", records: records, expected: `
+title,id
+Dune,1
+Emma,2
+`},
+		{desc: "selected wide column in a table", format: "table", columns: "note", records: records[:1], expected: `
++----------------+
+|      NOTE      |
++----------------+
+| first, of many |
++----------------+
+`},
+		{desc: "unknown column", format: "csv", columns: "id,isbn", records: records, expectErr: true},
+		{desc: "hidden fields are not columns", format: "csv", columns: "Hidden", records: records, expectErr: true},
+		{desc: "go-template", format: "go-template={{range .}}{{.id}}:{{.title}} {{end}}", records: records,
+			expected: "1:Dune 2:Emma "},
+		{desc: "go-template with a large id", format: "go-template={{.id}}", records: record{ID: 10000000},
+			expected: "10000000"},
+		{desc: "go-template with a missing key", format: "go-template={{.isbn}}", records: records[0], expectErr: true},
+		{desc: "malformed go-template", format: "go-template={{.id", records: records[0], expectErr: true},
+		{desc: "jsonpath", format: `jsonpath={range [*]}{.id}{"\t"}{.title}{"\n"}{end}`, records: records,
+			expected: "1\tDune\n2\tEmma\n"},
+		{desc: "empty table", format: "csv", records: []record{}, expected: "\nid,title,tags,note\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			opts, err := Parse(tc.format, tc.noHeaders, tc.columns)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			var out bytes.Buffer
+			err = Write(&out, opts, tc.records, recordColumns)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got [%s]", out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			expected := strings.TrimPrefix(tc.expected, "\n")
+			if strings.HasPrefix(tc.format, "go-template") || strings.HasPrefix(tc.format, "jsonpath") {
+				expected = tc.expected
+			}
+			if out.String() != expected {
+				t.Fatalf("expected\n%s\ngot\n[%s]", expected, out.String())
+			}
+		})
+	}
+}
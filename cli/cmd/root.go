@@ -1,19 +1,25 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
-	"strings"
+	"strconv"
 
 	"github.com/masnax/canonical-bookmanager/cli/cmd/add"
 	"github.com/masnax/canonical-bookmanager/cli/cmd/delete"
 	"github.com/masnax/canonical-bookmanager/cli/cmd/edit"
 	"github.com/masnax/canonical-bookmanager/cli/cmd/list"
-	"github.com/olekukonko/tablewriter"
+	"github.com/masnax/canonical-bookmanager/cli/cmd/output"
+	"github.com/masnax/canonical-bookmanager/client"
+	"github.com/masnax/canonical-bookmanager/filter"
 	"github.com/spf13/cobra"
 )
 
-const URL string = "http://localhost:8080/"
+const filterUsage = `'--filter' format: "key [eq,ne,lt,gt,le,ge] value", combined with and, or, not and parentheses
+	e.g. "genre eq fantasy and (published ge 2000-01-01 or not author eq 'max asna')"`
 
 //flags
 var (
@@ -26,26 +32,57 @@ var (
 	editionFlag     int
 	descriptionFlag string
 	genreFlag       string
+	limitFlag       int
+	pageFlag        string
+	sortFlag        string
+	tokenFlag       string
+	serverFlag      string
+	profileFlag     string
+	rawFlag         bool
+	outputFlag      string
+	noHeadersFlag   bool
+	columnsFlag     string
 )
 
+// outputOptions is parsed from the output flags before any command runs.
+var outputOptions output.Options
+
+// apiClient is set up from the flags before any command runs.
+var apiClient *client.Client
+
 var rootCmd = &cobra.Command{
-	Use:   "bmc",
-	Short: "bmc - book manager",
-	Long:  "bmc is a book manager for managing books and collections of books",
+	Use:               "bmc",
+	Short:             "bmc - book manager",
+	Long:              "bmc is a book manager for managing books and collections of books",
+	PersistentPreRunE: setup,
+	// errors are about the request rather than how the command was used
+	SilenceUsage: true,
 }
 
 var cmdListBooks = &cobra.Command{
 	Use:     "list [id] [flags]",
 	Aliases: []string{"ls"},
 	Short:   "List books",
-	Run: func(cmd *cobra.Command, args []string) {
-		argPath := parseArgs(args)
-		filter, ok := parseFilter(cmd, filterFlag)
-		if ok {
-			argPath += filter
-			header, data := list.GetBookList(URL, "books", argPath)
-			renderTable(header, data)
+	Args:    cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			id, err := strconv.Atoi(args[0])
+			if err != nil {
+				return errors.New("expected numerical id as input")
+			}
+			b, err := apiClient.GetBook(cmd.Context(), id)
+			return render(b, list.BookColumns, err)
 		}
+		opts, err := listOptions(cmd)
+		if err != nil {
+			return err
+		}
+		books, next, err := list.GetBookList(cmd.Context(), apiClient, 0, opts, pageOptions(cmd))
+		if err := render(books, list.BookColumns, err); err != nil {
+			return err
+		}
+		printNextPage(next)
+		return nil
 	},
 }
 
@@ -53,8 +90,8 @@ var cmdAddBook = &cobra.Command{
 	Use:   "add title author published edition description genre",
 	Short: "Add a new book with the given attributes",
 	Args:  cobra.ExactArgs(6),
-	Run: func(cmd *cobra.Command, args []string) {
-		add.AddBook(URL, "books", args)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return add.AddBook(cmd.Context(), apiClient, args)
 	},
 }
 
@@ -63,18 +100,34 @@ var cmdDelBook = &cobra.Command{
 	Aliases: []string{"rm"},
 	Short:   "Delete book with id",
 	Args:    cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		delete.DelBook(URL, "books", args)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return delete.DelBook(cmd.Context(), apiClient, args)
 	},
 }
 
 var cmdEditBook = &cobra.Command{
 	Use:   "edit id",
-	Short: "Update book with id",
+	Short: "Update the given fields of book with id, or edit it in $EDITOR without flags",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		edit.EditBook(URL, "books", args[0], titleFlag, authorFlag, dateFlag,
-			editionFlag, descriptionFlag, genreFlag)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		changes := map[string]interface{}{}
+		flags := map[string]interface{}{
+			"title":       titleFlag,
+			"author":      authorFlag,
+			"published":   dateFlag,
+			"edition":     editionFlag,
+			"description": descriptionFlag,
+			"genre":       genreFlag,
+		}
+		for name, value := range flags {
+			if cmd.Flags().Changed(name) {
+				changes[name] = value
+			}
+		}
+		if len(changes) == 0 {
+			return edit.EditBookInEditor(cmd.Context(), apiClient, args[0])
+		}
+		return edit.EditBook(cmd.Context(), apiClient, args[0], changes)
 	},
 }
 
@@ -87,27 +140,44 @@ var cmdCollections = &cobra.Command{
 }
 
 var cmdListCollections = &cobra.Command{
-	Use:     "list [command]",
+	Use:     "list [flags]",
 	Aliases: []string{"ls"},
 	Short:   "List collections and their books",
-	Run: func(cmd *cobra.Command, args []string) {
-		argPath := parseArgs(args)
-		var header []string
-		var data [][]string
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cmd.Flags().Changed("filter") && len(collectionFlag) == 0 {
+			return errors.New("--filter only applies to the books of a collection, use it with --name")
+		}
 		if len(collectionFlag) > 0 {
-			argPath += "/collection/" + collectionFlag
-			filter, ok := parseFilter(cmd, filterFlag)
-			if ok {
-				argPath += filter
-				header, data = list.GetBookList(URL, "collections", argPath)
+			found, err := apiClient.FindCollection(cmd.Context(), collectionFlag)
+			if err != nil {
+				return err
+			}
+			opts, err := listOptions(cmd)
+			if err != nil {
+				return err
 			}
+			books, next, err := list.GetBookList(cmd.Context(), apiClient, found.ID, opts, pageOptions(cmd))
+			if err := render(books, list.BookColumns, err); err != nil {
+				return err
+			}
+			printNextPage(next)
 		} else if len(bookFlag) > 0 {
-			argPath += "/book/" + bookFlag
-			header, data = list.GetCollectionList(URL, "collections", argPath)
+			id, err := strconv.Atoi(bookFlag)
+			if err != nil {
+				return errors.New("expected numerical book id")
+			}
+			collections, err := apiClient.ListBookCollections(cmd.Context(), id)
+			return render(collections, list.CollectionColumns, err)
 		} else {
-			header, data = list.GetCollectionStatList(URL, "collections", argPath)
+			opts := client.ListOptions{Sort: sortFlag}
+			collections, next, err := list.GetCollectionStatList(cmd.Context(), apiClient, opts, pageOptions(cmd))
+			if err := render(collections, list.CollectionStatColumns, err); err != nil {
+				return err
+			}
+			printNextPage(next)
 		}
-		renderTable(header, data)
+		return nil
 	},
 }
 
@@ -115,8 +185,8 @@ var cmdAddCollection = &cobra.Command{
 	Use:   "new name",
 	Short: "Add a new collection",
 	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		add.AddNewCollection(URL, "collections/manage", args)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return add.AddNewCollection(cmd.Context(), apiClient, args)
 	},
 }
 
@@ -124,8 +194,8 @@ var cmdEditCollection = &cobra.Command{
 	Use:   "edit id name",
 	Short: "Update collection name",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		edit.EditCollection(URL, "collections/manage", args[0], args[1])
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return edit.EditCollection(cmd.Context(), apiClient, args[0], args[1])
 	},
 }
 
@@ -134,8 +204,8 @@ var cmdDelCollection = &cobra.Command{
 	Aliases: []string{"rm"},
 	Short:   "Delete collection with id",
 	Args:    cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		delete.DelBook(URL, "collections/manage", args)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return delete.DelCollection(cmd.Context(), apiClient, args)
 	},
 }
 
@@ -143,8 +213,8 @@ var cmdAddToCollection = &cobra.Command{
 	Use:   "add book_id collection_id",
 	Short: "Add a book to a collection",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		add.AddToCollection(URL, "collections", args[0], args[1])
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return add.AddToCollection(cmd.Context(), apiClient, args[0], args[1])
 	},
 }
 
@@ -152,45 +222,65 @@ var cmdRemoveFromCollection = &cobra.Command{
 	Use:   "drop book_id collection_id",
 	Short: "Drop a book from a collection",
 	Args:  cobra.ExactArgs(2),
-	Run: func(cmd *cobra.Command, args []string) {
-		delete.RemoveFromCollection(URL, "collections", args[0], args[1])
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return delete.RemoveFromCollection(cmd.Context(), apiClient, args[0], args[1])
 	},
 }
 
-func parseArgs(args []string) string {
-	argPath := ""
-	for _, a := range args {
-		argPath += "/" + a
+// listOptions reads the filter and sort flags of a book listing, the filter is
+// checked before it is sent so that its usage can be shown.
+func listOptions(cmd *cobra.Command) (client.ListOptions, error) {
+	opts := client.ListOptions{Filter: filterFlag, Sort: sortFlag}
+	if len(filterFlag) == 0 {
+		return opts, nil
 	}
-	return argPath
+	if _, err := filter.Parse(filterFlag); err != nil {
+		return opts, errors.New(fmt.Sprintf("%v\n%s", err, cmd.Flag("filter").Usage))
+	}
+	return opts, nil
 }
 
-func parseFilter(cmd *cobra.Command, filter string) (string, bool) {
-	if len(filter) == 0 {
-		return "", true
+// pageOptions fetches every page unless a specific page was asked for.
+func pageOptions(cmd *cobra.Command) list.PageOptions {
+	return list.PageOptions{
+		Limit: limitFlag,
+		Token: pageFlag,
+		All:   !cmd.Flags().Changed("limit") && !cmd.Flags().Changed("page"),
 	}
-	parts := strings.Split(filter, " ")
-	out := "?filter="
-	if len(parts) < 3 {
-		log.Println(cmd.Flag("filter").Usage)
-		return "", false
+}
+
+func printNextPage(next string) {
+	if len(next) > 0 {
+		log.Printf("more results available, use '--page %s' to see the next page", next)
 	}
-	out += strings.ReplaceAll(filter, " ", "+")
-	return out, true
 }
 
-func renderTable(header []string, data [][]string) {
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetAutoWrapText(false)
-	table.SetAlignment(tablewriter.ALIGN_LEFT)
-	table.SetRowLine(true)
-	table.SetHeader(header)
-	table.AppendBulk(data)
-	table.Render()
+// render prints the records fetched by a command in the chosen output format,
+// or returns the error that fetching them failed with.
+func render(records interface{}, columns []output.Column, err error) error {
+	if err != nil {
+		return err
+	}
+	return output.Write(os.Stdout, outputOptions, records, columns)
 }
 
+// Execute runs the command line, errors are printed by cobra and only
+// returned for the exit status.
 func Execute() error {
 	//var rootCmd = &cobra.Command{Use: "bmc"}
+	rootCmd.PersistentFlags().StringVar(&serverFlag, "server", "",
+		"URL of the server, defaults to $BMC_SERVER, the server of the profile or "+defaultServer)
+	rootCmd.PersistentFlags().StringVar(&tokenFlag, "token", "",
+		"API key to authenticate with, defaults to $BMC_TOKEN or the token of the profile")
+	rootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "",
+		"profile of ~/.config/bmc/config.yaml to use, defaults to $BMC_PROFILE or the current profile")
+	rootCmd.PersistentFlags().StringVarP(&outputFlag, "output", "o", "",
+		"output format: table, wide, json, yaml, csv, tsv, go-template=TEMPLATE or jsonpath=TEMPLATE, "+
+			"defaults to the output of the profile or table")
+	rootCmd.PersistentFlags().BoolVar(&noHeadersFlag, "no-headers", false,
+		"leave the header row out of table, wide, csv and tsv output")
+	rootCmd.PersistentFlags().StringVar(&columnsFlag, "columns", "",
+		"comma separated fields to show in table, wide, csv and tsv output, e.g. id,title,author")
 	cmdListCollections.Flags().StringVar(&collectionFlag, "name", "",
 		"shows all books for a given collection name")
 	cmdListCollections.Flags().StringVar(&bookFlag, "bid", "",
@@ -202,10 +292,28 @@ func Execute() error {
 	cmdEditBook.Flags().StringVar(&descriptionFlag, "description", "", "book description")
 	cmdEditBook.Flags().StringVar(&genreFlag, "genre", "", "book genre")
 
-	cmdListCollections.Flags().StringVarP(&filterFlag, "filter", "f", "",
-		"'--filter' format: \"key [eq,ne,lt,gt,le,ge] value\"")
-	cmdListBooks.Flags().StringVarP(&filterFlag, "filter", "f", "",
-		"'--filter' format: \"key [eq,ne,lt,gt,le,ge] value\"")
+	cmdListCollections.Flags().StringVarP(&filterFlag, "filter", "f", "", filterUsage)
+	cmdListBooks.Flags().StringVarP(&filterFlag, "filter", "f", "", filterUsage)
+	cmdExport.Flags().StringVarP(&filterFlag, "filter", "f", "", filterUsage)
+	for _, c := range []*cobra.Command{cmdListBooks, cmdListCollections} {
+		c.Flags().IntVar(&limitFlag, "limit", 0, "number of results per page, shows a single page")
+		c.Flags().StringVar(&pageFlag, "page", "", "page token from a previous listing, shows a single page")
+	}
+	for _, c := range []*cobra.Command{cmdListBooks, cmdListCollections, cmdExport} {
+		c.Flags().StringVar(&sortFlag, "sort", "",
+			"comma separated fields to sort by, prefix a field with '-' for descending order, e.g. author,-published")
+	}
+
+	cmdImport.Flags().StringArrayVar(&mapFlags, "map", nil,
+		"rename a column or field of the file to a field of a book, or drop it with column=-, may be repeated")
+	cmdImport.Flags().BoolVar(&dryRunFlag, "dry-run", false, "only check the rows, import nothing")
+	cmdImport.Flags().BoolVar(&bestEffortFlag, "best-effort", false,
+		"import the valid rows even if some are rejected")
+	cmdImport.Flags().StringVar(&collectionFlag, "collection", "",
+		"add the imported books to the named collection, which is created if needed")
+	cmdExport.Flags().StringVar(&formatFlag, "format", "jsonl", "format of the export: jsonl, csv or yaml")
+	cmdExport.Flags().BoolVar(&archiveFlag, "archive", false,
+		"export the books and the collections holding them into a gzipped tar archive")
 
 	rootCmd.AddCommand(cmdCollections)
 	cmdCollections.AddCommand(cmdListCollections)
@@ -215,10 +323,18 @@ func Execute() error {
 	cmdCollections.AddCommand(cmdRemoveFromCollection)
 	cmdCollections.AddCommand(cmdAddToCollection)
 
+	cmdConfigView.Flags().BoolVar(&rawFlag, "raw", false, "show tokens")
+	rootCmd.AddCommand(cmdConfig)
+	cmdConfig.AddCommand(cmdConfigView)
+	cmdConfig.AddCommand(cmdConfigUseProfile)
+	cmdConfig.AddCommand(cmdConfigSet)
+
 	rootCmd.AddCommand(cmdListBooks)
 	rootCmd.AddCommand(cmdAddBook)
 	rootCmd.AddCommand(cmdDelBook)
 	rootCmd.AddCommand(cmdEditBook)
+	rootCmd.AddCommand(cmdImport)
+	rootCmd.AddCommand(cmdExport)
 
-	return rootCmd.Execute()
+	return rootCmd.ExecuteContext(context.Background())
 }
@@ -0,0 +1,134 @@
+package transfer
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/masnax/canonical-bookmanager/client"
+)
+
+// Files of an archive: the books as JSON Lines, as they are exported, and
+// the collections, one per line with the ids the books have in the archive.
+const (
+	archiveBooks       = "books.jsonl"
+	archiveCollections = "collections.jsonl"
+)
+
+// archiveCollection is a line of the collections of an archive.
+type archiveCollection struct {
+	Collection string `json:"collection"`
+	Books      []int  `json:"books"`
+}
+
+// ExportBooks copies the books matching opts to out, in the given format.
+func ExportBooks(ctx context.Context, c *client.Client, out io.Writer, format string, opts client.ListOptions) error {
+	body, err := c.ExportBooks(ctx, format, opts)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	_, err = io.Copy(out, body)
+	return err
+}
+
+// ExportArchive writes a gzipped tar archive of the books matching opts and
+// of every collection, with those of its books that are in the archive. It
+// returns the number of books and collections archived. The books are kept
+// in a temporary file until they are all exported, since tar needs the size
+// of a file before its content.
+func ExportArchive(ctx context.Context, c *client.Client, out io.Writer, opts client.ListOptions) (int, int, error) {
+	tmp, err := ioutil.TempFile("", "bmc-export-*.jsonl")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	body, err := c.ExportBooks(ctx, "jsonl", opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer body.Close()
+	exported := map[int]bool{}
+	r := bufio.NewReader(body)
+	for {
+		line, err := r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var b struct {
+				Id int `json:"id"`
+			}
+			if err := json.Unmarshal(line, &b); err != nil {
+				return 0, 0, err
+			}
+			exported[b.Id] = true
+			if _, err := tmp.Write(append(line, '\n')); err != nil {
+				return 0, 0, err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	var collections bytes.Buffer
+	stats, err := c.ListCollections(ctx, client.ListOptions{Sort: "id"})
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, stat := range stats {
+		books, err := c.ListCollectionBooks(ctx, stat.ID, client.ListOptions{Sort: "id"})
+		if err != nil {
+			return 0, 0, err
+		}
+		line := archiveCollection{Collection: stat.Collection, Books: []int{}}
+		for _, b := range books {
+			if exported[b.Id] {
+				line.Books = append(line.Books, b.Id)
+			}
+		}
+		encoded, err := json.Marshal(line)
+		if err != nil {
+			return 0, 0, err
+		}
+		collections.Write(append(encoded, '\n'))
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	if err := tw.WriteHeader(&tar.Header{Name: archiveBooks, Mode: 0644, Size: size, ModTime: now}); err != nil {
+		return 0, 0, err
+	}
+	if _, err := io.Copy(tw, tmp); err != nil {
+		return 0, 0, err
+	}
+	header := &tar.Header{Name: archiveCollections, Mode: 0644, Size: int64(collections.Len()), ModTime: now}
+	if err := tw.WriteHeader(header); err != nil {
+		return 0, 0, err
+	}
+	if _, err := io.Copy(tw, &collections); err != nil {
+		return 0, 0, err
+	}
+	if err := tw.Close(); err != nil {
+		return 0, 0, err
+	}
+	return len(exported), len(stats), gz.Close()
+}
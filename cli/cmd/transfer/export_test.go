@@ -0,0 +1,197 @@
+package transfer
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/client"
+	"github.com/masnax/canonical-bookmanager/handler"
+	"github.com/masnax/canonical-bookmanager/internal/testserver"
+)
+
+// memberships lists the titles of the books of every collection of the
+// server, by collection name.
+func memberships(t *testing.T, c *client.Client) string {
+	ctx := context.Background()
+	collections, err := c.ListCollections(ctx, client.ListOptions{Sort: "collection"})
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	out := []string{}
+	for _, col := range collections {
+		books, err := c.ListCollectionBooks(ctx, col.ID, client.ListOptions{Sort: "title"})
+		if err != nil {
+			t.Fatalf("expected no error, got [%v]", err)
+		}
+		names := []string{}
+		for _, b := range books {
+			names = append(names, b.Title)
+		}
+		out = append(out, fmt.Sprintf("%s:%s", col.Collection, strings.Join(names, ",")))
+	}
+	return strings.Join(out, " ")
+}
+
+// archiveFiles reads the files of an archive, by name.
+func archiveFiles(t *testing.T, archive []byte) map[string]string {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		b, _ := ioutil.ReadAll(tr)
+		files[header.Name] = string(b)
+	}
+	return files
+}
+
+func TestExportArchive(t *testing.T) {
+	ctx := context.Background()
+	source := testserver.New(t, nil)
+	for _, b := range []book.Book{
+		{Title: "Dune", Author: "Frank Herbert", Published: "1965-08-01", Edition: 1, Genre: "scifi"},
+		{Title: "Emma", Author: "Jane Austen", Published: "1815-12-23", Edition: 2},
+		{Title: "Ulysses", Author: "James Joyce", Published: "1922-02-02", Edition: 1, Description: "Dublin, 1904"},
+	} {
+		if _, err := source.CreateBook(ctx, b); err != nil {
+			t.Fatalf("expected no error, got [%v]", err)
+		}
+	}
+	for name, ids := range map[string][]int{"classics": {2, 3}, "favourites": {1, 3}, "empty": {}} {
+		col, err := source.CreateCollection(ctx, name)
+		if err != nil {
+			t.Fatalf("expected no error, got [%v]", err)
+		}
+		for _, id := range ids {
+			if err := source.AddBookToCollection(ctx, col.ID, id); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+		}
+	}
+
+	testCases := []struct {
+		desc        string
+		opts        client.ListOptions
+		books       int
+		titles      string
+		memberships string
+	}{
+		{desc: "every book", books: 3, titles: "Present,Dune,Emma,Ulysses",
+			memberships: "classics:Emma,Ulysses empty: favourites:Dune,Present,Ulysses"},
+		{desc: "filtered books", opts: client.ListOptions{Filter: "edition eq 1", Sort: "-title"}, books: 2,
+			titles: "Present,Ulysses,Dune", memberships: "classics:Ulysses empty: favourites:Dune,Present,Ulysses"},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			var archive bytes.Buffer
+			books, collections, err := ExportArchive(ctx, source, &archive, tc.opts)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if books != tc.books || collections != 3 {
+				t.Fatalf("expected %d books and 3 collections, got [%d] [%d]", tc.books, books, collections)
+			}
+			files := archiveFiles(t, archive.Bytes())
+			if lines := strings.Count(files[archiveBooks], "\n"); lines != tc.books {
+				t.Fatalf("expected %d books in the archive, got [%d]: %s", tc.books, lines, files[archiveBooks])
+			}
+			if lines := strings.Count(files[archiveCollections], "\n"); lines != 3 {
+				t.Fatalf("expected 3 collections in the archive, got [%d]: %s", lines, files[archiveCollections])
+			}
+
+			// the target already has a book in a collection of the same name, so
+			// that the archived books get other ids and are added to it
+			target := testserver.New(t, nil)
+			present, err := target.CreateBook(ctx, book.Book{Title: "Present", Published: "2000-01-01", Edition: 1})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			favourites, err := target.CreateCollection(ctx, "favourites")
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if err := target.AddBookToCollection(ctx, favourites.ID, present.Id); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+
+			report, err := ImportBooks(ctx, target, bytes.NewReader(archive.Bytes()), ImportOptions{})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if !report.Archive || report.Imported != tc.books || report.Collections != 3 || len(report.Missing) > 0 {
+				t.Fatalf("expected %d books imported from an archive, got [%+v]", tc.books, report)
+			}
+			if got := titles(t, target); got != tc.titles {
+				t.Fatalf("expected books %q, got [%q]", tc.titles, got)
+			}
+			if got := memberships(t, target); got != tc.memberships {
+				t.Fatalf("expected collections %q, got [%q]", tc.memberships, got)
+			}
+
+			// the books keep their fields, but not their ids
+			exported, err := source.ListBooks(ctx, tc.opts)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			imported := map[string]book.Book{}
+			for _, id := range report.IDs {
+				b, err := target.GetBook(ctx, id)
+				if err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+				imported[b.Title] = b
+			}
+			ids := []int{}
+			for _, b := range exported {
+				got, ok := imported[b.Title]
+				if !ok || got.Author != b.Author || got.Published != b.Published || got.Edition != b.Edition ||
+					got.Description != b.Description || got.Genre != b.Genre {
+					t.Fatalf("expected %+v to be imported, got [%+v]", b, got)
+				}
+				ids = append(ids, got.Id)
+			}
+			sort.Ints(ids)
+			if ids[0] == 1 {
+				t.Fatalf("expected the imported books to get new ids, got [%v]", ids)
+			}
+		})
+	}
+}
+
+func TestExportArchiveCutShort(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", handler.NDJSONType)
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, `{"id":1,"title":"Dune","published":"1965-08-01","edition":1}`)
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer server.Close()
+	c, err := client.New(server.URL + "/")
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	var archive bytes.Buffer
+	if _, _, err := ExportArchive(context.Background(), c, &archive, client.ListOptions{}); err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+	if archive.Len() > 0 {
+		t.Fatalf("expected nothing to be written, got [%d] bytes", archive.Len())
+	}
+}
@@ -0,0 +1,400 @@
+// Package transfer moves books between files and the server in bulk.
+package transfer
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/client"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"gopkg.in/yaml.v2"
+)
+
+// ImportOptions are the flags of an import. Mapping renames the columns of a
+// CSV file, or the fields of JSON books, to the JSON fields of a book, and
+// drops the ones mapped to "-".
+type ImportOptions struct {
+	Mapping      map[string]string
+	BestEffort   bool
+	DryRun       bool
+	CollectionID int
+}
+
+// ParseMapping reads --map flags of the form column=field.
+func ParseMapping(flags []string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, f := range flags {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 || len(strings.TrimSpace(parts[1])) == 0 {
+			return nil, errors.New(fmt.Sprintf("invalid mapping %q, expected column=field", f))
+		}
+		mapping[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return mapping, nil
+}
+
+// Report is the outcome of an import. Collections, Members and Missing are
+// only set for archives, they count the collections of the archive and the
+// books added to them, and list the books that could not be added.
+type Report struct {
+	book.ImportReport
+	Archive     bool
+	Collections int
+	Members     int
+	Missing     []Membership
+}
+
+// Membership is a book of an archive, by its imported id, that belongs in a
+// collection.
+type Membership struct {
+	Collection string `json:"collection"`
+	BookID     int    `json:"book_id"`
+	Error      string `json:"error"`
+}
+
+// converter turns a file into the rows an import sends.
+type converter func(in *bufio.Reader, out io.Writer, mapping map[string]string) error
+
+// ImportBooks streams the books of in to the server. A file starting with [
+// or { is read as a JSON array of books or as JSON books one after the
+// other, one starting with - as a YAML sequence of books, a gzipped file as
+// an archive written by ExportArchive, and anything else as CSV with a
+// header row. Rows are sent as they are read, so they are numbered in the
+// report as they are in the file.
+func ImportBooks(ctx context.Context, c *client.Client, in io.Reader, opts ImportOptions) (Report, error) {
+	r := bufio.NewReader(in)
+	if magic, _ := r.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return importArchive(ctx, c, r, opts)
+	}
+	contentType := "text/csv"
+	convert := converter(mapCSV)
+	if first, err := peek(r); err == nil {
+		switch first {
+		case '[', '{':
+			contentType, convert = "application/x-ndjson", mapJSON
+		case '-':
+			contentType, convert = "application/x-ndjson", mapYAML
+		}
+	}
+	report, err := send(ctx, c, r, contentType, convert, opts)
+	return Report{ImportReport: report}, err
+}
+
+// send streams the rows converted from in to the server. Once the import
+// has succeeded, the server has read every row and the conversion is done.
+func send(ctx context.Context, c *client.Client, in *bufio.Reader, contentType string, convert converter,
+	opts ImportOptions) (book.ImportReport, error) {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		pw.CloseWithError(convert(in, pw, opts.Mapping))
+		close(done)
+	}()
+	report, err := c.ImportBooks(ctx, pr, contentType, client.ImportOptions{
+		BestEffort:   opts.BestEffort,
+		DryRun:       opts.DryRun,
+		CollectionID: opts.CollectionID,
+	})
+	// stops the conversion if the request failed before reading all of it
+	pr.Close()
+	if err == nil {
+		<-done
+	}
+	return report, err
+}
+
+// importArchive imports the books of an archive as a whole, then adds them
+// to the collections of the archive, which are created if needed. The books
+// stay imported if some of them cannot be added to their collections, those
+// are listed in the report as Missing, with the error they failed with, so
+// that they can be added by hand.
+func importArchive(ctx context.Context, c *client.Client, in io.Reader, opts ImportOptions) (Report, error) {
+	report := Report{Archive: true}
+	if opts.BestEffort || len(opts.Mapping) > 0 {
+		return report, errors.New("--best-effort and --map do not apply to archives, which are imported as a whole")
+	}
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return report, errors.New(fmt.Sprintf("unable to read the archive: %v", err))
+	}
+	tr := tar.NewReader(gz)
+	ids := []int{}
+	collections := []archiveCollection{}
+	imported := false
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, errors.New(fmt.Sprintf("unable to read the archive: %v", err))
+		}
+		switch header.Name {
+		case archiveBooks:
+			record := func(in *bufio.Reader, out io.Writer, mapping map[string]string) error {
+				return recordIDs(in, out, &ids)
+			}
+			report.ImportReport, err = send(ctx, c, bufio.NewReader(tr), "application/x-ndjson", record, opts)
+			if err != nil {
+				return report, err
+			}
+			imported = true
+		case archiveCollections:
+			d := json.NewDecoder(tr)
+			for {
+				var col archiveCollection
+				err := d.Decode(&col)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return report, errors.New(fmt.Sprintf("unable to read %s: %v", archiveCollections, err))
+				}
+				collections = append(collections, col)
+			}
+		}
+	}
+	if !imported {
+		return report, errors.New(fmt.Sprintf("%s is missing from the archive", archiveBooks))
+	}
+	report.Collections = len(collections)
+	if opts.DryRun {
+		for _, col := range collections {
+			report.Members += len(col.Books)
+		}
+		return report, nil
+	}
+
+	if len(ids) != len(report.IDs) {
+		return report, errors.New(fmt.Sprintf("the archive holds %d books but %d were imported", len(ids), len(report.IDs)))
+	}
+	imports := map[int]int{}
+	for i, id := range ids {
+		imports[id] = report.IDs[i]
+	}
+	var first error
+	for _, col := range collections {
+		id, _, colErr := FindOrCreateCollection(ctx, c, col.Collection)
+		for _, archived := range col.Books {
+			bookID, ok := imports[archived]
+			if !ok {
+				continue
+			}
+			err := colErr
+			if err == nil {
+				err = c.AddBookToCollection(ctx, id, bookID)
+			}
+			if err != nil {
+				report.Missing = append(report.Missing, Membership{Collection: col.Collection, BookID: bookID, Error: err.Error()})
+				if first == nil {
+					first = err
+				}
+				continue
+			}
+			report.Members++
+		}
+	}
+	if first != nil {
+		return report, errors.New(fmt.Sprintf("%d book(s) could not be added to their collections: %v", len(report.Missing), first))
+	}
+	return report, nil
+}
+
+// FindOrCreateCollection returns the id of the named collection, and whether
+// it had to be created.
+func FindOrCreateCollection(ctx context.Context, c *client.Client, name string) (int, bool, error) {
+	found, err := c.FindCollection(ctx, name)
+	if err == nil {
+		return found.ID, false, nil
+	}
+	if !client.IsCode(err, problem.CodeNotFound) {
+		return 0, false, err
+	}
+	created, err := c.CreateCollection(ctx, name)
+	if err != nil {
+		return 0, false, err
+	}
+	return created.ID, true, nil
+}
+
+// recordIDs copies the books of an archive, one per line, and notes the ids
+// they have in the archive.
+func recordIDs(in *bufio.Reader, out io.Writer, ids *[]int) error {
+	for {
+		line, err := in.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var b struct {
+				Id int `json:"id"`
+			}
+			if err := json.Unmarshal(line, &b); err != nil {
+				return errors.New(fmt.Sprintf("unable to read %s: %v", archiveBooks, err))
+			}
+			*ids = append(*ids, b.Id)
+			if _, err := out.Write(append(line, '\n')); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// peek returns the first byte of r that is not white space, without
+// consuming it.
+func peek(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			return b, r.UnreadByte()
+		}
+	}
+}
+
+// mapCSV copies a CSV file with the columns of its header renamed.
+func mapCSV(in *bufio.Reader, out io.Writer, mapping map[string]string) error {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	// malformed rows are passed on for the server to report
+	r.LazyQuotes = true
+	w := csv.NewWriter(out)
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to read the CSV header: %v", err))
+	}
+	keep := []int{}
+	columns := []string{}
+	for i, column := range header {
+		if i == 0 {
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+		column = strings.TrimSpace(column)
+		if field, ok := mapping[column]; ok {
+			column = field
+		}
+		if column != "-" {
+			keep = append(keep, i)
+			columns = append(columns, column)
+		}
+	}
+	w.Write(columns)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.New(fmt.Sprintf("unable to read CSV: %v", err))
+		}
+		row := []string{}
+		for _, i := range keep {
+			if i < len(record) {
+				row = append(row, record[i])
+			}
+		}
+		w.Write(row)
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// mapJSON writes the books of a JSON array, or of a stream of JSON values,
+// one per line with their fields renamed. Values that are not objects are
+// passed on for the server to report.
+func mapJSON(in *bufio.Reader, out io.Writer, mapping map[string]string) error {
+	first, err := peek(in)
+	if err != nil {
+		return nil
+	}
+	d := json.NewDecoder(in)
+	if first == '[' {
+		d.Token()
+	}
+	for first != '[' || d.More() {
+		var raw json.RawMessage
+		err := d.Decode(&raw)
+		if err == io.EOF && first != '[' {
+			return nil
+		}
+		if err != nil {
+			return errors.New(fmt.Sprintf("unable to read JSON: %v", err))
+		}
+		var line bytes.Buffer
+		if err := json.Compact(&line, renameFields(raw, mapping)); err != nil {
+			return err
+		}
+		line.WriteByte('\n')
+		if _, err := out.Write(line.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renameFields(raw json.RawMessage, mapping map[string]string) json.RawMessage {
+	var fields map[string]json.RawMessage
+	if len(mapping) == 0 || json.Unmarshal(raw, &fields) != nil || fields == nil {
+		return raw
+	}
+	renamed := map[string]json.RawMessage{}
+	for name, value := range fields {
+		if field, ok := mapping[name]; ok {
+			name = field
+		}
+		if name != "-" {
+			renamed[name] = value
+		}
+	}
+	b, err := json.Marshal(renamed)
+	if err != nil {
+		return raw
+	}
+	return b
+}
+
+// mapYAML writes the books of a YAML sequence, as exported, one per line
+// with their fields renamed. The sequence is read as a whole.
+func mapYAML(in *bufio.Reader, out io.Writer, mapping map[string]string) error {
+	b, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	rows := []map[string]interface{}{}
+	if err := yaml.Unmarshal(b, &rows); err != nil {
+		return errors.New(fmt.Sprintf("unable to read YAML: %v", err))
+	}
+	for i, row := range rows {
+		encoded, err := json.Marshal(row)
+		if err != nil {
+			return errors.New(fmt.Sprintf("unable to read book %d of the YAML sequence: %v", i+1, err))
+		}
+		if _, err := out.Write(append(renameFields(encoded, mapping), '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package transfer
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/client"
+	"github.com/masnax/canonical-bookmanager/internal/testserver"
+)
+
+// titles lists the titles of the books of the server, by id.
+func titles(t *testing.T, c *client.Client) string {
+	books, err := c.ListBooks(context.Background(), client.ListOptions{Sort: "id"})
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	out := []string{}
+	for _, b := range books {
+		out = append(out, b.Title)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestParseMapping(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		flags     []string
+		expected  map[string]string
+		expectErr bool
+	}{
+		{desc: "no flags", expected: map[string]string{}},
+		{desc: "renames and drops", flags: []string{" Book Title = title", "isbn=-"},
+			expected: map[string]string{"Book Title": "title", "isbn": "-"}},
+		{desc: "= in the field", flags: []string{"a=b=c"}, expected: map[string]string{"a": "b=c"}},
+		{desc: "no =", flags: []string{"title"}, expectErr: true},
+		{desc: "no column", flags: []string{" =title"}, expectErr: true},
+		{desc: "no field", flags: []string{"title= "}, expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			mapping, err := ParseMapping(tc.flags)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got [%v]", mapping)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if fmt.Sprint(mapping) != fmt.Sprint(tc.expected) {
+				t.Fatalf("expected %v, got [%v]", tc.expected, mapping)
+			}
+		})
+	}
+}
+
+func TestConverters(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		convert   converter
+		in        string
+		mapping   map[string]string
+		expected  string
+		expectErr bool
+	}{
+		{desc: "csv as it is", convert: mapCSV, in: "title,edition\nDune,1\n", expected: "title,edition\nDune,1\n"},
+		{desc: "csv header with a BOM and white space", convert: mapCSV, in: "\ufeff Book Title ,edition\nDune,1\n",
+			mapping: map[string]string{"Book Title": "title"}, expected: "title,edition\nDune,1\n"},
+		{desc: "csv dropped column", convert: mapCSV, in: "title,isbn,edition\nDune,123,1\n\"Emma, 1\",456,2\n",
+			mapping: map[string]string{"isbn": "-"}, expected: "title,edition\nDune,1\n\"Emma, 1\",2\n"},
+		{desc: "csv short row is passed on", convert: mapCSV, in: "title,isbn,edition\nDune\n",
+			mapping: map[string]string{"isbn": "-"}, expected: "title,edition\nDune\n"},
+		{desc: "empty csv", convert: mapCSV, in: "", expected: ""},
+		{desc: "json array", convert: mapJSON, in: ` [ {"title": "Dune"}, {"title": "Emma", "isbn": "1"} ] `,
+			mapping: map[string]string{"isbn": "-"}, expected: "{\"title\":\"Dune\"}\n{\"title\":\"Emma\"}\n"},
+		{desc: "empty json array", convert: mapJSON, in: "[]", expected: ""},
+		{desc: "ndjson", convert: mapJSON, in: "{\"name\": \"Dune\"}\n\n{\"name\": \"Emma\"}\n",
+			mapping: map[string]string{"name": "title"}, expected: "{\"title\":\"Dune\"}\n{\"title\":\"Emma\"}\n"},
+		{desc: "json values on one line", convert: mapJSON, in: `{"title": "Dune"} {"title": "Emma"}`,
+			expected: "{\"title\":\"Dune\"}\n{\"title\":\"Emma\"}\n"},
+		{desc: "json value that is not an object is passed on", convert: mapJSON, in: `[1, "Dune"]`,
+			mapping: map[string]string{"name": "title"}, expected: "1\n\"Dune\"\n"},
+		{desc: "malformed json", convert: mapJSON, in: `[{"title": "Dune"}, {"title"}]`, expectErr: true},
+		{desc: "unclosed json array", convert: mapJSON, in: `[{"title": "Dune"}`, expectErr: true},
+		{desc: "yaml sequence", convert: mapYAML,
+			in:       "- id: 1\n  title: Dune\n  published: \"1965-08-01\"\n  edition: 1\n- name: Emma\n  published: 1815-12-23\n",
+			mapping:  map[string]string{"name": "title"},
+			expected: "{\"edition\":1,\"id\":1,\"published\":\"1965-08-01\",\"title\":\"Dune\"}\n{\"published\":\"1815-12-23\",\"title\":\"Emma\"}\n"},
+		{desc: "empty yaml sequence", convert: mapYAML, in: "[]\n", expected: ""},
+		{desc: "yaml that is not a sequence", convert: mapYAML, in: "title: Dune\n", expectErr: true},
+		{desc: "yaml nested value is passed on", convert: mapYAML, in: "- title:\n    name: Dune\n",
+			expected: "{\"title\":{\"name\":\"Dune\"}}\n"},
+		{desc: "malformed yaml", convert: mapYAML, in: "- title: [Dune\n", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			var out bytes.Buffer
+			err := tc.convert(bufio.NewReader(strings.NewReader(tc.in)), &out, tc.mapping)
+			if tc.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got [%s]", out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if out.String() != tc.expected {
+				t.Fatalf("expected %q, got [%q]", tc.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestRecordIDs(t *testing.T) {
+	ids := []int{}
+	var out bytes.Buffer
+	in := " {\"id\": 7, \"title\": \"Dune\"}\n\n{\"title\": \"Emma\"}\n{\"id\": 3}"
+	if err := recordIDs(bufio.NewReader(strings.NewReader(in)), &out, &ids); err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if fmt.Sprint(ids) != "[7 0 3]" {
+		t.Fatalf("expected ids [7 0 3], got [%v]", ids)
+	}
+	if expected := "{\"id\": 7, \"title\": \"Dune\"}\n{\"title\": \"Emma\"}\n{\"id\": 3}\n"; out.String() != expected {
+		t.Fatalf("expected %q, got [%q]", expected, out.String())
+	}
+	if err := recordIDs(bufio.NewReader(strings.NewReader("not json\n")), &out, &ids); err == nil {
+		t.Fatalf("expected an error for a line that is not JSON")
+	}
+}
+
+func TestImportBooks(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		in        string
+		opts      ImportOptions
+		titles    string
+		expectErr bool
+	}{
+		{desc: "csv", in: "\ufefftitle,published,edition\nDune,1965-08-01,1\n", titles: "Dune"},
+		{desc: "csv with a mapping", in: "Name,published,edition,isbn\nDune,1965-08-01,1,123\n",
+			opts: ImportOptions{Mapping: map[string]string{"Name": "title", "isbn": "-"}}, titles: "Dune"},
+		{desc: "json array", in: "\n [{\"title\": \"Dune\", \"published\": \"1965-08-01\", \"edition\": 1}]", titles: "Dune"},
+		{desc: "ndjson", in: "{\"title\": \"Dune\", \"published\": \"1965-08-01\", \"edition\": 1}\n" +
+			"{\"title\": \"Emma\", \"published\": \"1815-12-23\", \"edition\": 1}\n", titles: "Dune,Emma"},
+		{desc: "yaml", in: "- title: Dune\n  published: \"1965-08-01\"\n  edition: 1\n", titles: "Dune"},
+		{desc: "dry run", in: "title,published,edition\nDune,1965-08-01,1\n", opts: ImportOptions{DryRun: true}},
+		{desc: "invalid row", in: "title,published,edition\nDune,1965,1\n", expectErr: true},
+		{desc: "malformed json", in: "[{\"title\": \"Dune\"", expectErr: true},
+		{desc: "archive with best effort", in: "\x1f\x8b", opts: ImportOptions{BestEffort: true}, expectErr: true},
+		{desc: "archive with a mapping", in: "\x1f\x8b", opts: ImportOptions{Mapping: map[string]string{"a": "b"}},
+			expectErr: true},
+		{desc: "malformed archive", in: "\x1f\x8bnot gzip", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			c := testserver.New(t, nil)
+			_, err := ImportBooks(context.Background(), c, strings.NewReader(tc.in), tc.opts)
+			if tc.expectErr && err == nil {
+				t.Fatalf("expected an error")
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if got := titles(t, c); got != tc.titles {
+				t.Fatalf("expected books %q, got [%q]", tc.titles, got)
+			}
+		})
+	}
+}
+
+// writeArchive builds an archive holding the given files, by name.
+func writeArchive(t *testing.T, files ...string) []byte {
+	var out bytes.Buffer
+	gz := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gz)
+	for i := 0; i+1 < len(files); i += 2 {
+		if err := tw.WriteHeader(&tar.Header{Name: files[i], Mode: 0644, Size: int64(len(files[i+1]))}); err != nil {
+			t.Fatalf("expected no error, got [%v]", err)
+		}
+		tw.Write([]byte(files[i+1]))
+	}
+	tw.Close()
+	gz.Close()
+	return out.Bytes()
+}
+
+func TestImportArchive(t *testing.T) {
+	const books = `{"id": 4, "title": "Dune", "published": "1965-08-01", "edition": 1}
+{"id": 9, "title": "Emma", "published": "1815-12-23", "edition": 1}
+`
+	const collections = `{"collection": "scifi", "books": [4]}
+{"collection": "classics", "books": [9, 4, 12]}
+`
+	testCases := []struct {
+		desc      string
+		archive   []byte
+		opts      ImportOptions
+		fail      func(r *http.Request) bool
+		members   int
+		missing   string
+		titles    string
+		expectErr bool
+	}{
+		{desc: "books and collections", archive: writeArchive(t, archiveBooks, books, archiveCollections, collections),
+			members: 3, titles: "Dune,Emma"},
+		{desc: "dry run", archive: writeArchive(t, archiveBooks, books, archiveCollections, collections),
+			opts: ImportOptions{DryRun: true}, members: 4},
+		{desc: "no books", archive: writeArchive(t, archiveCollections, collections), expectErr: true},
+		{desc: "invalid book", archive: writeArchive(t, archiveBooks, `{"id": 1, "title": ""}`), expectErr: true},
+		{desc: "malformed collections", archive: writeArchive(t, archiveBooks, books, archiveCollections, "{"),
+			titles: "Dune,Emma", expectErr: true},
+		{desc: "a membership fails", archive: writeArchive(t, archiveBooks, books, archiveCollections, collections),
+			fail: func(r *http.Request) bool {
+				return r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/books/2")
+			},
+			members: 2, missing: "[{classics 2 server error: failed}]", titles: "Dune,Emma", expectErr: true},
+		{desc: "a collection cannot be created", archive: writeArchive(t, archiveBooks, books, archiveCollections, collections),
+			fail: func(r *http.Request) bool {
+				return r.Method == "POST" && r.URL.Path == "/collections"
+			},
+			missing: "[{scifi 1 server error: failed} {classics 2 server error: failed} {classics 1 server error: failed}]",
+			titles:  "Dune,Emma", expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			c := testserver.New(t, tc.fail)
+			report, err := ImportBooks(context.Background(), c, bytes.NewReader(tc.archive), tc.opts)
+			if tc.expectErr && err == nil {
+				t.Fatalf("expected an error, got [%+v]", report)
+			}
+			if !tc.expectErr && err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if !report.Archive || report.Members != tc.members {
+				t.Fatalf("expected an archive with %d members, got [%+v]", tc.members, report)
+			}
+			missing := []string{}
+			for _, m := range report.Missing {
+				missing = append(missing, fmt.Sprintf("{%s %d %s}", m.Collection, m.BookID, strings.Split(m.Error, " (")[0]))
+			}
+			if fmt.Sprintf("%v", missing) != tc.missing && (len(missing) > 0 || len(tc.missing) > 0) {
+				t.Fatalf("expected missing memberships %s, got [%v]", tc.missing, missing)
+			}
+			if got := titles(t, c); got != tc.titles {
+				t.Fatalf("expected books %q, got [%q]", tc.titles, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/collection"
+	"github.com/masnax/canonical-bookmanager/patch"
+)
+
+// ListBooks returns every book matching the options, fetching the pages from
+// opts.PageToken onwards, opts.Limit books at a time.
+func (c *Client) ListBooks(ctx context.Context, opts ListOptions) ([]book.Book, error) {
+	return c.allBooks(ctx, "/books", opts)
+}
+
+// ListBooksPage returns a single page of the books matching the options.
+func (c *Client) ListBooksPage(ctx context.Context, opts ListOptions) ([]book.Book, Page, error) {
+	return c.listBooks(ctx, "/books", opts)
+}
+
+// GetBook returns the book with the given id, with its Version set from the
+// ETag of the response.
+func (c *Client) GetBook(ctx context.Context, id int) (book.Book, error) {
+	var b book.Book
+	res, err := c.do(ctx, "GET", fmt.Sprintf("/books/%d", id), nil, http.Header{}, nil, &b)
+	if err != nil {
+		return book.Book{}, err
+	}
+	b.Version = version(res.header)
+	return b, nil
+}
+
+// CreateBook adds the book and returns it as stored, with its id and Version.
+func (c *Client) CreateBook(ctx context.Context, b book.Book) (book.Book, error) {
+	return c.writeBook(ctx, "POST", "/books", 0, b)
+}
+
+// UpdateBook replaces every field of the book with the id of b. When
+// b.Version is set the update fails with a precondition_failed error if the
+// book has changed since that version.
+func (c *Client) UpdateBook(ctx context.Context, b book.Book) (book.Book, error) {
+	return c.writeBook(ctx, "PUT", fmt.Sprintf("/books/%d", b.Id), b.Version, b)
+}
+
+// PatchBook changes only the given fields of the book, keyed by their JSON
+// names, a nil value clears the field. When v is set the patch fails with a
+// precondition_failed error if the book has changed since that version.
+func (c *Client) PatchBook(ctx context.Context, id int, v int, changes map[string]interface{}) (book.Book, error) {
+	header := ifMatch(v)
+	header.Set("Content-Type", patch.MergePatchType)
+	var b book.Book
+	res, err := c.do(ctx, "PATCH", fmt.Sprintf("/books/%d", id), nil, header, changes, &b)
+	if err != nil {
+		return book.Book{}, err
+	}
+	b.Version = version(res.header)
+	return b, nil
+}
+
+// DeleteBook deletes the book, unconditionally when v is 0.
+func (c *Client) DeleteBook(ctx context.Context, id int, v int) error {
+	_, err := c.do(ctx, "DELETE", fmt.Sprintf("/books/%d", id), nil, ifMatch(v), nil, nil)
+	return repeated(err, http.StatusNotFound)
+}
+
+// ListBookCollections returns the collections the book is in.
+func (c *Client) ListBookCollections(ctx context.Context, id int) ([]collection.Collection, error) {
+	collections := []collection.Collection{}
+	_, err := c.do(ctx, "GET", fmt.Sprintf("/books/%d/collections", id), nil, http.Header{}, nil, &collections)
+	if err != nil {
+		return nil, err
+	}
+	return collections, nil
+}
+
+// ImportOptions are the query parameters of ImportBooks. CollectionID, if
+// set, is the collection the imported books are added to.
+type ImportOptions struct {
+	BestEffort   bool
+	DryRun       bool
+	CollectionID int
+}
+
+// ImportBooks streams the books read from r to the server, which takes them
+// as one JSON object per line with the contentType "application/x-ndjson",
+// or as a CSV file whose header names the JSON fields of a book with
+// "text/csv". A transactional import with invalid rows fails with a
+// validation_failed error listing them, otherwise the report lists the
+// rejected rows.
+func (c *Client) ImportBooks(ctx context.Context, r io.Reader, contentType string, opts ImportOptions) (book.ImportReport, error) {
+	q := url.Values{}
+	if opts.BestEffort {
+		q.Set("mode", book.ImportBestEffort)
+	}
+	if opts.DryRun {
+		q.Set("dry_run", "true")
+	}
+	if opts.CollectionID > 0 {
+		q.Set("collection", strconv.Itoa(opts.CollectionID))
+	}
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	var report book.ImportReport
+	_, err := c.do(ctx, "POST", "/books:import", q, header, r, &report)
+	return report, err
+}
+
+// ExportBooks returns the books matching the filter, in the sort order of
+// opts, as a stream in the given format, "jsonl", "csv" or "yaml". The
+// Limit and PageToken of opts are ignored, and the caller must close the
+// stream.
+func (c *Client) ExportBooks(ctx context.Context, format string, opts ListOptions) (io.ReadCloser, error) {
+	q := opts.values()
+	q.Del("limit")
+	q.Del("page_token")
+	q.Set("format", format)
+	res, err := c.send(ctx, "GET", "/books/export", q, http.Header{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (c *Client) listBooks(ctx context.Context, path string, opts ListOptions) ([]book.Book, Page, error) {
+	books := []book.Book{}
+	res, err := c.do(ctx, "GET", path, opts.values(), http.Header{}, nil, &books)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	return books, res.page, nil
+}
+
+func (c *Client) allBooks(ctx context.Context, path string, opts ListOptions) ([]book.Book, error) {
+	books := []book.Book{}
+	for {
+		page, info, err := c.listBooks(ctx, path, opts)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, page...)
+		if len(info.NextPageToken) == 0 {
+			return books, nil
+		}
+		opts.PageToken = info.NextPageToken
+	}
+}
+
+func (c *Client) writeBook(ctx context.Context, method string, path string, v int, b book.Book) (book.Book, error) {
+	var out book.Book
+	res, err := c.do(ctx, method, path, nil, ifMatch(v), b, &out)
+	if err != nil {
+		return book.Book{}, err
+	}
+	out.Version = version(res.header)
+	return out, nil
+}
@@ -0,0 +1,340 @@
+// Package client is a typed Go client for the bookmanager REST API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/masnax/canonical-bookmanager/problem"
+)
+
+// Client talks to a bookmanager server. Its fields may be changed after New
+// but not while requests are being made.
+type Client struct {
+	// BaseURL is the URL the API paths are resolved against, it may carry a
+	// path prefix, e.g. https://example.com/bookmanager.
+	BaseURL string
+	// HTTPClient sends the requests, http.DefaultClient when nil.
+	HTTPClient *http.Client
+	// Token is the API key sent as a bearer token, none is sent when empty.
+	Token string
+	// Retries is how often a request that may safely be repeated is sent
+	// again after a network error or a 502, 503 or 504 response. Requests
+	// conditional on a version are not, since a repeat of one that succeeded
+	// would fail as if someone else had changed the record.
+	Retries int
+	// RetryWait is the wait before the first retry, it doubles on every
+	// retry after that.
+	RetryWait time.Duration
+}
+
+// New returns a client for the server at baseURL, which retries twice.
+func New(baseURL string) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid server URL %q: %v", baseURL, err))
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return nil, errors.New(fmt.Sprintf("invalid server URL %q: expected http://host[:port] or https://host[:port]", baseURL))
+	}
+	return &Client{
+		BaseURL:   baseURL,
+		Retries:   2,
+		RetryWait: 200 * time.Millisecond,
+	}, nil
+}
+
+// ListOptions narrows down and pages a listing. Filter and Sort are passed on
+// as the filter and sort query parameters, and Name only applies to
+// collections.
+type ListOptions struct {
+	Filter    string
+	Sort      string
+	Name      string
+	Limit     int
+	PageToken string
+}
+
+func (o ListOptions) values() url.Values {
+	q := url.Values{}
+	if len(o.Filter) > 0 {
+		q.Set("filter", o.Filter)
+	}
+	if len(o.Sort) > 0 {
+		q.Set("sort", o.Sort)
+	}
+	if len(o.Name) > 0 {
+		q.Set("name", o.Name)
+	}
+	if o.Limit > 0 {
+		q.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if len(o.PageToken) > 0 {
+		q.Set("page_token", o.PageToken)
+	}
+	return q
+}
+
+// Page describes the page a listing returned. NextPageToken is empty on the
+// last page.
+type Page struct {
+	Total         int
+	NextPageToken string
+}
+
+// statusMessages explains the error statuses the server answers with.
+var statusMessages = map[int]string{
+	http.StatusBadRequest:           "invalid request",
+	http.StatusUnauthorized:         "not authenticated",
+	http.StatusForbidden:            "not allowed",
+	http.StatusNotFound:             "not found",
+	http.StatusMethodNotAllowed:     "operation not supported by the server",
+	http.StatusConflict:             "conflict",
+	http.StatusPreconditionFailed:   "modified by someone else",
+	http.StatusUnsupportedMediaType: "request format not supported by the server",
+	http.StatusUnprocessableEntity:  "invalid fields",
+	http.StatusInternalServerError:  "server error",
+	http.StatusServiceUnavailable:   "server unavailable",
+}
+
+// Error is an error response from the server. Code is stable and may be
+// branched on, the rest of the problem is meant for people.
+type Error struct {
+	problem.Problem
+	// Retried is set when the request was sent more than once, an earlier
+	// attempt may then have succeeded without its response making it back.
+	Retried bool
+}
+
+func (e *Error) Error() string {
+	msg, ok := statusMessages[e.Status]
+	if !ok {
+		msg = "got an error response from server"
+	}
+	msg = fmt.Sprintf("%s: %s", msg, e.Problem.Error())
+	details := []string{}
+	if len(e.Code) > 0 {
+		details = append(details, "code: "+string(e.Code))
+	}
+	if len(e.RequestID) > 0 {
+		details = append(details, "request id: "+e.RequestID)
+	}
+	if len(details) > 0 {
+		msg += " (" + strings.Join(details, ", ") + ")"
+	}
+	return msg
+}
+
+// IsCode reports whether err is an error response with the given code.
+func IsCode(err error, code problem.Code) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == code
+}
+
+// response is what is left of a successful response once its data has been
+// decoded.
+type response struct {
+	header http.Header
+	page   Page
+}
+
+// envelope is the JSON every successful response is wrapped in.
+type envelope struct {
+	Data          json.RawMessage `json:"data"`
+	StatusCode    int             `json:"status-code"`
+	Total         int             `json:"total"`
+	NextPageToken string          `json:"next_page_token"`
+}
+
+// do sends a request with in, if not nil, as its JSON body and decodes the
+// data of the response into out, if not nil. A null data leaves out as it is.
+// An in that is an io.Reader is streamed as it is, and the request is then
+// never retried since the body cannot be read twice.
+func (c *Client) do(ctx context.Context, method string, path string, q url.Values, header http.Header,
+	in interface{}, out interface{}) (response, error) {
+	res, err := c.send(ctx, method, path, q, header, in)
+	if err != nil {
+		return response{}, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return response{}, errors.New(fmt.Sprintf("unable to read response body: %v", err))
+	}
+	return decodeResponse(res, body, out)
+}
+
+// send sends a request as do does and returns the response, whose body the
+// caller must close, unless it is an error response.
+func (c *Client) send(ctx context.Context, method string, path string, q url.Values, header http.Header,
+	in interface{}) (*http.Response, error) {
+	target := strings.TrimRight(c.BaseURL, "/") + path
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+	var body []byte
+	stream, streamed := in.(io.Reader)
+	if in != nil && !streamed {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to encode request body: %v", err))
+		}
+		if len(header.Get("Content-Type")) == 0 {
+			header.Set("Content-Type", "application/json")
+		}
+	}
+	// the id is sent so that a failure can be found in the server logs even
+	// when no response makes it back, and is kept across retries
+	requestID := newRequestID()
+	header.Set("X-Request-ID", requestID)
+	if len(c.Token) > 0 {
+		header.Set("Authorization", "Bearer "+c.Token)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	wait := c.RetryWait
+	for attempt := 0; ; attempt++ {
+		reader := stream
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, target, reader)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		res, err := httpClient.Do(req)
+		retry := attempt < c.Retries && idempotent(method) && len(header.Get("If-Match")) == 0 && !streamed && ctx.Err() == nil &&
+			(err != nil || res.StatusCode == http.StatusBadGateway ||
+				res.StatusCode == http.StatusServiceUnavailable || res.StatusCode == http.StatusGatewayTimeout)
+		if retry {
+			if res != nil {
+				res.Body.Close()
+			}
+			select {
+			case <-time.After(wait):
+				wait *= 2
+				continue
+			case <-ctx.Done():
+				return nil, errors.New(fmt.Sprintf("unable to send request %s: %v", requestID, ctx.Err()))
+			}
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to send request %s: %v", requestID, err))
+		}
+		if res.StatusCode >= 400 {
+			defer res.Body.Close()
+			responseBytes, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("unable to read response body: %v", err))
+			}
+			err = decodeError(res, responseBytes, requestID)
+			err.(*Error).Retried = attempt > 0
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+// repeated drops the error a retried request got because an earlier attempt
+// succeeded: deleting again finds nothing and adding a book to a collection
+// again finds it there, either way the request had the effect asked for.
+func repeated(err error, status int) error {
+	if e, ok := err.(*Error); ok && e.Retried && e.Status == status {
+		return nil
+	}
+	return err
+}
+
+// idempotent methods may be sent again without changing their effect.
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+func decodeResponse(res *http.Response, body []byte, out interface{}) (response, error) {
+	var env envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return response{}, errors.New(fmt.Sprintf("unable to parse json response: %v", err))
+	}
+	if env.StatusCode == 0 {
+		return response{}, errors.New("malformed response from request")
+	}
+	if out != nil && len(env.Data) > 0 && string(env.Data) != "null" {
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			return response{}, errors.New(fmt.Sprintf("unable to parse response data: %v", err))
+		}
+	}
+	return response{
+		header: res.Header,
+		page:   Page{Total: env.Total, NextPageToken: env.NextPageToken},
+	}, nil
+}
+
+// decodeError reads a problem from an error response. Responses that are not
+// problems, e.g. from a proxy, keep their status and body as the detail, and
+// the request id echoed by the server or else the one that was sent.
+func decodeError(res *http.Response, body []byte, requestID string) error {
+	e := &Error{}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType != problem.ContentType || json.Unmarshal(body, &e.Problem) != nil {
+		e.Problem = *problem.New(res.StatusCode, "", strings.TrimSpace(string(body)))
+	}
+	if e.Status == 0 {
+		e.Status = res.StatusCode
+	}
+	if len(e.RequestID) == 0 {
+		e.RequestID = res.Header.Get("X-Request-ID")
+	}
+	if len(e.RequestID) == 0 {
+		e.RequestID = requestID
+	}
+	return e
+}
+
+// version reads the version of a record from the ETag of a response, or 0
+// when there is none.
+func version(header http.Header) int {
+	tag := strings.TrimPrefix(header.Get("ETag"), "W/")
+	v, err := strconv.Atoi(strings.Trim(tag, `"`))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// ifMatch makes a write conditional on the version, if it is set.
+func ifMatch(v int) http.Header {
+	header := http.Header{}
+	if v > 0 {
+		header.Set("If-Match", fmt.Sprintf(`"%d"`, v))
+	}
+	return header
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
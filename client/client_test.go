@@ -0,0 +1,328 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/client"
+	"github.com/masnax/canonical-bookmanager/internal/testserver"
+	"github.com/masnax/canonical-bookmanager/problem"
+)
+
+func TestClient(t *testing.T) {
+	c := testserver.NewWithKey(t)
+	ctx := context.Background()
+
+	books, err := c.ListBooks(ctx, client.ListOptions{})
+	if err != nil || books == nil || len(books) != 0 {
+		t.Fatalf("expected an empty list, got [%v] [%v]", books, err)
+	}
+	for i, title := range []string{"Dune", "Emma", "Ulysses"} {
+		b, err := c.CreateBook(ctx, book.Book{Title: title, Author: "someone", Published: "1965-08-01", Edition: i + 1})
+		if err != nil {
+			t.Fatalf("expected no error, got [%v]", err)
+		}
+		if b.Id != i+1 || b.Title != title || b.Version != 1 {
+			t.Fatalf("expected book %d %s at version 1, got [%+v]", i+1, title, b)
+		}
+	}
+
+	books, err = c.ListBooks(ctx, client.ListOptions{Limit: 2, Sort: "-title"})
+	if err != nil || len(books) != 3 || books[0].Title != "Ulysses" {
+		t.Fatalf("expected every book sorted by title, got [%v] [%v]", books, err)
+	}
+	books, page, err := c.ListBooksPage(ctx, client.ListOptions{Limit: 2})
+	if err != nil || len(books) != 2 || page.Total != 3 || len(page.NextPageToken) == 0 {
+		t.Fatalf("expected a page of 2 of 3 books, got [%v] [%+v] [%v]", books, page, err)
+	}
+	books, err = c.ListBooks(ctx, client.ListOptions{Filter: "title eq Emma"})
+	if err != nil || len(books) != 1 || books[0].Id != 2 {
+		t.Fatalf("expected the filtered book, got [%v] [%v]", books, err)
+	}
+
+	b, err := c.GetBook(ctx, 1)
+	if err != nil || b.Title != "Dune" || b.Version != 1 {
+		t.Fatalf("expected book 1 at version 1, got [%+v] [%v]", b, err)
+	}
+	b, err = c.PatchBook(ctx, 1, b.Version, map[string]interface{}{"genre": "scifi"})
+	if err != nil || b.Genre != "scifi" || b.Version != 2 {
+		t.Fatalf("expected the patched book at version 2, got [%+v] [%v]", b, err)
+	}
+	b.Version = 1
+	if _, err := c.UpdateBook(ctx, b); !client.IsCode(err, problem.CodePreconditionFailed) {
+		t.Fatalf("expected a precondition_failed error, got [%v]", err)
+	}
+	if _, err := c.GetBook(ctx, 9); !client.IsCode(err, problem.CodeNotFound) {
+		t.Fatalf("expected a not_found error, got [%v]", err)
+	}
+
+	col, err := c.CreateCollection(ctx, "classics")
+	if err != nil || col.ID != 1 || col.Version != 1 {
+		t.Fatalf("expected collection 1 at version 1, got [%+v] [%v]", col, err)
+	}
+	if err := c.AddBookToCollection(ctx, col.ID, 2); err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if err := c.AddBookToCollection(ctx, col.ID, 2); !client.IsCode(err, problem.CodeConflict) {
+		t.Fatalf("expected a conflict error, got [%v]", err)
+	}
+	found, err := c.FindCollection(ctx, "classics")
+	if err != nil || found.ID != col.ID || found.Size != 1 {
+		t.Fatalf("expected collection 1 with one book, got [%+v] [%v]", found, err)
+	}
+	if _, err := c.FindCollection(ctx, "missing"); !client.IsCode(err, problem.CodeNotFound) {
+		t.Fatalf("expected a not_found error, got [%v]", err)
+	}
+	books, err = c.ListCollectionBooks(ctx, col.ID, client.ListOptions{})
+	if err != nil || len(books) != 1 || books[0].Id != 2 {
+		t.Fatalf("expected book 2 in the collection, got [%v] [%v]", books, err)
+	}
+	collections, err := c.ListBookCollections(ctx, 2)
+	if err != nil || len(collections) != 1 || collections[0].Collection != "classics" {
+		t.Fatalf("expected book 2 to be in classics, got [%v] [%v]", collections, err)
+	}
+	if err := c.RemoveBookFromCollection(ctx, col.ID, 2); err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if err := c.DeleteCollection(ctx, col.ID, col.Version); err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if err := c.DeleteBook(ctx, 3, 0); err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+
+	rows := "title,published,edition\nDune,1965-08-01,1\nEmma,1815-12-23,2\n"
+	report, err := c.ImportBooks(ctx, strings.NewReader(rows), "text/csv", client.ImportOptions{})
+	if err != nil || report.Imported != 2 || len(report.IDs) != 2 || report.IDs[0] != 4 {
+		t.Fatalf("expected books 4 and 5 to be imported, got [%+v] [%v]", report, err)
+	}
+	rows = `{"title": "Dune", "published": "1965-08-01", "edition": 1}` + "\n" + `{"title": "Emma"}`
+	if _, err := c.ImportBooks(ctx, strings.NewReader(rows), "application/x-ndjson", client.ImportOptions{}); !client.IsCode(err, problem.CodeValidationFailed) {
+		t.Fatalf("expected a validation_failed error, got [%v]", err)
+	}
+	report, err = c.ImportBooks(ctx, strings.NewReader(rows), "application/x-ndjson", client.ImportOptions{BestEffort: true, DryRun: true})
+	if err != nil || report.Rows != 2 || report.Failed != 1 || report.Imported != 0 {
+		t.Fatalf("expected a dry run with one invalid row, got [%+v] [%v]", report, err)
+	}
+	export, err := c.ExportBooks(ctx, "csv", client.ListOptions{Filter: "id ge 4", Sort: "-id", Limit: 1})
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	exported, err := ioutil.ReadAll(export)
+	export.Close()
+	if err != nil || !strings.HasPrefix(string(exported), "id,title") || strings.Count(string(exported), "\n") != 3 ||
+		!strings.Contains(string(exported), "\n5,Emma") {
+		t.Fatalf("expected books 5 and 4 as CSV, got [%s] [%v]", exported, err)
+	}
+	if _, err := c.ExportBooks(ctx, "xml", client.ListOptions{}); !client.IsCode(err, problem.CodeInvalidParam) {
+		t.Fatalf("expected an invalid_param error, got [%v]", err)
+	}
+
+	key, token, err := c.CreateKey(ctx, "ci", auth.RoleReader)
+	if err != nil || key.ID == 0 || key.Role != auth.RoleReader || len(token) == 0 {
+		t.Fatalf("expected a reader key with a token, got [%+v] [%s] [%v]", key, token, err)
+	}
+	reader := *c
+	reader.Token = token
+	if _, err := reader.CreateBook(ctx, book.Book{Title: "Emma", Published: "1815-12-23", Edition: 1}); !client.IsCode(err, problem.CodeForbidden) {
+		t.Fatalf("expected a forbidden error, got [%v]", err)
+	}
+	if err := c.RevokeKey(ctx, key.ID); err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if _, err := reader.ListBooks(ctx, client.ListOptions{}); !client.IsCode(err, problem.CodeUnauthorized) {
+		t.Fatalf("expected an unauthorized error, got [%v]", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	c := testserver.NewWithKey(t)
+	col, err := c.CreateCollection(context.Background(), "favourites")
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+
+	testCases := []struct {
+		desc     string
+		method   string
+		failures int32
+		version  bool
+		retries  int
+		calls    int32
+		ok       bool
+	}{
+		{desc: "no failures", method: "GET", failures: 0, retries: 2, calls: 1, ok: true},
+		{desc: "recovers", method: "GET", failures: 2, retries: 2, calls: 3, ok: true},
+		{desc: "gives up", method: "GET", failures: 3, retries: 2, calls: 3, ok: false},
+		{desc: "no retries", method: "GET", failures: 1, retries: 0, calls: 1, ok: false},
+		{desc: "post is not retried", method: "POST", failures: 1, retries: 2, calls: 1, ok: false},
+		{desc: "put recovers", method: "PUT", failures: 1, retries: 2, calls: 2, ok: true},
+		{desc: "put with a version is not retried", method: "PUT", version: true, failures: 1, retries: 2, calls: 1, ok: false},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			var calls int32
+			target := strings.TrimRight(c.BaseURL, "/")
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) <= tc.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				forward(w, r, target)
+			}))
+			defer proxy.Close()
+
+			retrying := *c
+			retrying.BaseURL = proxy.URL
+			retrying.Retries = tc.retries
+			retrying.RetryWait = time.Millisecond
+			var err error
+			if tc.method == "POST" {
+				_, err = retrying.CreateCollection(context.Background(), tc.desc)
+			} else if tc.method == "PUT" {
+				current, getErr := c.GetCollection(context.Background(), col.ID)
+				if getErr != nil {
+					t.Fatalf("expected no error, got [%v]", getErr)
+				}
+				if !tc.version {
+					current.Version = 0
+				}
+				_, err = retrying.UpdateCollection(context.Background(), current)
+			} else {
+				_, err = retrying.ListBooks(context.Background(), client.ListOptions{})
+			}
+			if (err == nil) != tc.ok {
+				t.Fatalf("expected success to be %v, got [%v]", tc.ok, err)
+			}
+			if calls != tc.calls {
+				t.Fatalf("expected %d calls, got [%d]", tc.calls, calls)
+			}
+		})
+	}
+}
+
+func TestRetriedAfterSuccess(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		desc    string
+		lost    bool
+		retries int
+		call    func(c *client.Client, bookID int, otherID int, colID int) error
+		ok      bool
+	}{
+		{desc: "delete book", lost: true, retries: 2, ok: true,
+			call: func(c *client.Client, bookID int, otherID int, colID int) error { return c.DeleteBook(ctx, bookID, 0) }},
+		{desc: "delete collection", lost: true, retries: 2, ok: true,
+			call: func(c *client.Client, bookID int, otherID int, colID int) error {
+				return c.DeleteCollection(ctx, colID, 0)
+			}},
+		{desc: "add book to collection", lost: true, retries: 2, ok: true,
+			call: func(c *client.Client, bookID int, otherID int, colID int) error {
+				return c.AddBookToCollection(ctx, colID, otherID)
+			}},
+		{desc: "remove book from collection", lost: true, retries: 2, ok: true,
+			call: func(c *client.Client, bookID int, otherID int, colID int) error {
+				return c.RemoveBookFromCollection(ctx, colID, bookID)
+			}},
+		{desc: "delete book without retries", lost: true, retries: 0, ok: false,
+			call: func(c *client.Client, bookID int, otherID int, colID int) error { return c.DeleteBook(ctx, bookID, 0) }},
+		{desc: "delete missing book", retries: 2, ok: false,
+			call: func(c *client.Client, bookID int, otherID int, colID int) error { return c.DeleteBook(ctx, 9999, 0) }},
+		{desc: "add book already in collection", retries: 2, ok: false,
+			call: func(c *client.Client, bookID int, otherID int, colID int) error {
+				return c.AddBookToCollection(ctx, colID, bookID)
+			}},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			c := testserver.NewWithKey(t)
+			b, err := c.CreateBook(ctx, book.Book{Title: "Dune", Published: "1965-08-01", Edition: 1})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			other, err := c.CreateBook(ctx, book.Book{Title: "Emma", Published: "1815-12-23", Edition: 1})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			col, err := c.CreateCollection(ctx, "favourites")
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if err := c.AddBookToCollection(ctx, col.ID, b.Id); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+
+			// the first request reaches the server, but its response is lost
+			var calls int32
+			target := strings.TrimRight(c.BaseURL, "/")
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) == 1 && tc.lost {
+					forward(httptest.NewRecorder(), r, target)
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				forward(w, r, target)
+			}))
+			defer proxy.Close()
+
+			retrying := *c
+			retrying.BaseURL = proxy.URL
+			retrying.Retries = tc.retries
+			retrying.RetryWait = time.Millisecond
+			err = tc.call(&retrying, b.Id, other.Id, col.ID)
+			if (err == nil) != tc.ok {
+				t.Fatalf("expected success to be %v, got [%v]", tc.ok, err)
+			}
+		})
+	}
+}
+
+// forward sends the request on to the server at target and copies back its
+// response.
+func forward(w http.ResponseWriter, r *http.Request, target string) {
+	req, _ := http.NewRequest(r.Method, target+r.URL.RequestURI(), r.Body)
+	req.Header = r.Header
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	defer res.Body.Close()
+	for name, values := range res.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(res.StatusCode)
+	io.Copy(w, res.Body)
+}
+
+func TestNew(t *testing.T) {
+	testCases := []struct {
+		desc string
+		url  string
+		ok   bool
+	}{
+		{desc: "http", url: "http://localhost:8080/", ok: true},
+		{desc: "https with a path", url: "https://example.com/bookmanager", ok: true},
+		{desc: "no scheme", url: "localhost:8080", ok: false},
+		{desc: "no host", url: "http://", ok: false},
+		{desc: "unparsable", url: "http://%zz", ok: false},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			_, err := client.New(tc.url)
+			if (err == nil) != tc.ok {
+				t.Fatalf("expected success to be %v, got [%v]", tc.ok, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/collection"
+	"github.com/masnax/canonical-bookmanager/problem"
+)
+
+// ListCollections returns every collection matching the options with the
+// number of books in it, fetching the pages from opts.PageToken onwards.
+func (c *Client) ListCollections(ctx context.Context, opts ListOptions) ([]collection.BookCollection, error) {
+	collections := []collection.BookCollection{}
+	for {
+		page, info, err := c.ListCollectionsPage(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, page...)
+		if len(info.NextPageToken) == 0 {
+			return collections, nil
+		}
+		opts.PageToken = info.NextPageToken
+	}
+}
+
+// ListCollectionsPage returns a single page of the collections matching the
+// options. Filter does not apply to collections.
+func (c *Client) ListCollectionsPage(ctx context.Context, opts ListOptions) ([]collection.BookCollection, Page, error) {
+	collections := []collection.BookCollection{}
+	res, err := c.do(ctx, "GET", "/collections", opts.values(), http.Header{}, nil, &collections)
+	if err != nil {
+		return nil, Page{}, err
+	}
+	return collections, res.page, nil
+}
+
+// FindCollection returns the collection with the given name, or a not_found
+// error if there is none.
+func (c *Client) FindCollection(ctx context.Context, name string) (collection.BookCollection, error) {
+	collections, _, err := c.ListCollectionsPage(ctx, ListOptions{Name: name})
+	if err != nil {
+		return collection.BookCollection{}, err
+	}
+	for _, col := range collections {
+		if col.Collection == name {
+			return col, nil
+		}
+	}
+	return collection.BookCollection{}, &Error{Problem: *problem.New(http.StatusNotFound, problem.CodeNotFound,
+		fmt.Sprintf("No collection named %s", name))}
+}
+
+// GetCollection returns the collection with the given id, with its Version
+// set from the ETag of the response.
+func (c *Client) GetCollection(ctx context.Context, id int) (collection.Collection, error) {
+	var col collection.Collection
+	res, err := c.do(ctx, "GET", fmt.Sprintf("/collections/%d", id), nil, http.Header{}, nil, &col)
+	if err != nil {
+		return collection.Collection{}, err
+	}
+	col.Version = version(res.header)
+	return col, nil
+}
+
+// CreateCollection adds an empty collection with the given name.
+func (c *Client) CreateCollection(ctx context.Context, name string) (collection.Collection, error) {
+	return c.writeCollection(ctx, "POST", "/collections", 0, collection.Collection{Collection: name})
+}
+
+// UpdateCollection renames the collection with the id of col. When
+// col.Version is set the update fails with a precondition_failed error if the
+// collection has changed since that version.
+func (c *Client) UpdateCollection(ctx context.Context, col collection.Collection) (collection.Collection, error) {
+	return c.writeCollection(ctx, "PUT", fmt.Sprintf("/collections/%d", col.ID), col.Version, col)
+}
+
+// DeleteCollection deletes the collection, unconditionally when v is 0. The
+// books in it are kept.
+func (c *Client) DeleteCollection(ctx context.Context, id int, v int) error {
+	_, err := c.do(ctx, "DELETE", fmt.Sprintf("/collections/%d", id), nil, ifMatch(v), nil, nil)
+	return repeated(err, http.StatusNotFound)
+}
+
+// ListCollectionBooks returns every book in the collection matching the
+// options, fetching the pages from opts.PageToken onwards.
+func (c *Client) ListCollectionBooks(ctx context.Context, id int, opts ListOptions) ([]book.Book, error) {
+	return c.allBooks(ctx, fmt.Sprintf("/collections/%d/books", id), opts)
+}
+
+// ListCollectionBooksPage returns a single page of the books in the
+// collection matching the options.
+func (c *Client) ListCollectionBooksPage(ctx context.Context, id int, opts ListOptions) ([]book.Book, Page, error) {
+	return c.listBooks(ctx, fmt.Sprintf("/collections/%d/books", id), opts)
+}
+
+// AddBookToCollection adds the book to the collection, or fails with a
+// conflict error if it is already in it.
+func (c *Client) AddBookToCollection(ctx context.Context, collectionID int, bookID int) error {
+	_, err := c.do(ctx, "PUT", fmt.Sprintf("/collections/%d/books/%d", collectionID, bookID), nil, http.Header{}, nil, nil)
+	return repeated(err, http.StatusConflict)
+}
+
+// RemoveBookFromCollection removes the book from the collection, the book
+// itself is kept.
+func (c *Client) RemoveBookFromCollection(ctx context.Context, collectionID int, bookID int) error {
+	_, err := c.do(ctx, "DELETE", fmt.Sprintf("/collections/%d/books/%d", collectionID, bookID), nil, http.Header{}, nil, nil)
+	return repeated(err, http.StatusNotFound)
+}
+
+func (c *Client) writeCollection(ctx context.Context, method string, path string, v int,
+	col collection.Collection) (collection.Collection, error) {
+	var out collection.Collection
+	res, err := c.do(ctx, method, path, nil, ifMatch(v), col, &out)
+	if err != nil {
+		return collection.Collection{}, err
+	}
+	out.Version = version(res.header)
+	return out, nil
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+)
+
+// ListKeys returns every API key, without its token. It needs the admin role.
+func (c *Client) ListKeys(ctx context.Context) ([]auth.Key, error) {
+	keys := []auth.Key{}
+	_, err := c.do(ctx, "GET", "/apikeys", nil, http.Header{}, nil, &keys)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// CreateKey mints an API key and returns it with its token, which the server
+// does not keep and cannot send again. It needs the admin role.
+func (c *Client) CreateKey(ctx context.Context, name string, role auth.Role) (auth.Key, string, error) {
+	var out struct {
+		auth.Key
+		Token string `json:"token"`
+	}
+	_, err := c.do(ctx, "POST", "/apikeys", nil, http.Header{}, auth.Key{Name: name, Role: role}, &out)
+	if err != nil {
+		return auth.Key{}, "", err
+	}
+	return out.Key, out.Token, nil
+}
+
+// RevokeKey revokes the API key, requests made with its token are rejected
+// from then on. It needs the admin role.
+func (c *Client) RevokeKey(ctx context.Context, id int) error {
+	_, err := c.do(ctx, "DELETE", fmt.Sprintf("/apikeys/%d", id), nil, http.Header{}, nil, nil)
+	return repeated(err, http.StatusNotFound)
+}
@@ -1,6 +1,22 @@
 package collection
 
+import "github.com/masnax/canonical-bookmanager/validate"
+
+// MaxLength matches the collection column.
+const MaxLength = 255
+
 type Collection struct {
 	ID         int    `json:"id"`
 	Collection string `json:"collection"`
+	// Version is incremented by the store on every update and is sent as the
+	// ETag of the collection rather than in its JSON.
+	Version int `json:"-"`
+}
+
+// Validate checks the name and returns all failed checks as validate.Errors.
+func (c Collection) Validate() error {
+	errs := validate.Errors{}
+	errs.Required("collection", c.Collection)
+	errs.MaxLength("collection", c.Collection, MaxLength)
+	return errs.Err()
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/config"
+	"github.com/masnax/canonical-bookmanager/db"
+	"github.com/masnax/canonical-bookmanager/migrate"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+const migrateUsage = "usage: migrate up | down [steps|all] | status"
+
+const apikeyUsage = "usage: apikey create <name> <reader|editor|admin> | list | revoke <id>"
+
+func runCommand(cfg config.Config, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return migrateCommand(cfg.Database, args[1:])
+	case "apikey":
+		return apikeyCommand(cfg.Database, args[1:])
+	default:
+		return errors.New(fmt.Sprintf("unknown command: %s", args[0]))
+	}
+}
+
+func migrateCommand(cfg config.Database, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	if cfg.Driver == "memory" {
+		return errors.New("the memory driver has no schema to migrate")
+	}
+	database, err := db.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrate.Up(database, cfg.Driver)
+		for _, m := range applied {
+			fmt.Printf("applied V%d__%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if args[1] == "all" {
+				steps = math.MaxInt32
+			} else if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		reverted, err := migrate.Down(database, cfg.Driver, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted V%d__%s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrate.GetStatus(database, cfg.Driver)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			at := "pending"
+			if s.Applied {
+				at = s.AppliedAt
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, at)
+		}
+		return w.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+// apikeyCommand manages API keys directly in the database, which is how the
+// first admin key is made.
+func apikeyCommand(cfg config.Database, args []string) error {
+	if len(args) == 0 {
+		return errors.New(apikeyUsage)
+	}
+	if cfg.Driver == "memory" {
+		return errors.New("keys in the memory driver do not outlive the command, use -anonymous-role instead")
+	}
+	s, err := store.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	switch args[0] {
+	case "create":
+		if len(args) != 3 {
+			return errors.New(apikeyUsage)
+		}
+		key, token, err := auth.NewKey(args[1], auth.Role(args[2]))
+		if err != nil {
+			return err
+		}
+		if key.ID, err = s.AddKey(ctx, key); err == store.ErrConflict {
+			return errors.New(fmt.Sprintf("API key %s already exists", key.Name))
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("created API key %d %s with the %s role, its token is only shown once:\n%s\n", key.ID, key.Name, key.Role, token)
+		return nil
+	case "list":
+		keys, err := s.ListKeys(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tROLE\tCREATED")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", k.ID, k.Name, k.Role, k.Created)
+		}
+		return w.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(apikeyUsage)
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			return errors.New(apikeyUsage)
+		}
+		if err := s.RevokeKey(ctx, id); err == store.ErrNotFound {
+			return errors.New(fmt.Sprintf("no API key with id: %d", id))
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("revoked API key %d\n", id)
+		return nil
+	default:
+		return errors.New(apikeyUsage)
+	}
+}
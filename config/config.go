@@ -0,0 +1,245 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix is prepended to the upper-cased flag name to get the environment
+// variable for a setting, e.g. -read-timeout is BOOKMANAGER_READ_TIMEOUT.
+const EnvPrefix = "BOOKMANAGER_"
+
+type Config struct {
+	Listen   string   `yaml:"listen"`
+	LogLevel string   `yaml:"log_level"`
+	Timeouts Timeouts `yaml:"timeouts"`
+	TLS      TLS      `yaml:"tls"`
+	Auth     Auth     `yaml:"auth"`
+	Database Database `yaml:"database"`
+}
+
+// Timeouts of the server. Request bounds the time a handler may spend on a
+// request, including its database queries, and must leave time to write the
+// response within Write. Once the server is asked to stop, it keeps serving
+// for Drain while failing its readiness check, so that load balancers stop
+// sending it requests, and then gives the requests in flight at most Shutdown
+// to finish.
+type Timeouts struct {
+	Read     time.Duration `yaml:"read"`
+	Write    time.Duration `yaml:"write"`
+	Idle     time.Duration `yaml:"idle"`
+	Request  time.Duration `yaml:"request"`
+	Drain    time.Duration `yaml:"drain"`
+	Shutdown time.Duration `yaml:"shutdown"`
+}
+
+type TLS struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+// Auth of the server. Requests without an API key are given AnonymousRole,
+// and are rejected when it is empty.
+type Auth struct {
+	AnonymousRole string `yaml:"anonymous_role"`
+}
+
+type Database struct {
+	Driver          string        `yaml:"driver"`
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	AutoMigrate     bool          `yaml:"auto_migrate"`
+}
+
+// ValidationError holds every problem found with a configuration.
+type ValidationError []string
+
+func (v ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(v, "\n  ")
+}
+
+var validDrivers = []string{"mysql", "sqlite3", "memory"}
+var validLogLevels = []string{"debug", "info", "warn", "error"}
+var validRoles = []string{"reader", "editor", "admin"}
+
+func Default() Config {
+	return Config{
+		Listen:   ":8080",
+		LogLevel: "info",
+		Timeouts: Timeouts{
+			Read:     10 * time.Second,
+			Write:    30 * time.Second,
+			Idle:     2 * time.Minute,
+			Request:  20 * time.Second,
+			Drain:    5 * time.Second,
+			Shutdown: 30 * time.Second,
+		},
+		Database: Database{
+			Driver:       "mysql",
+			DSN:          "sql:password@tcp(127.0.0.1:3306)/bookmanager",
+			MaxOpenConns: 25,
+			MaxIdleConns: 25,
+			AutoMigrate:  true,
+		},
+	}
+}
+
+// Load builds the configuration from, in increasing order of precedence, the
+// defaults, the YAML file given by -config or BOOKMANAGER_CONFIG, the
+// environment, and the command line flags. Arguments left after the flags
+// are returned alongside it.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, []string, error) {
+	// a first pass over the flags only to find the config file
+	scratch := Default()
+	path, _ := lookupEnv(EnvPrefix + "CONFIG")
+	fs := newFlagSet(&scratch, &path)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+
+	cfg := Default()
+	if len(path) > 0 {
+		if err := loadFile(path, &cfg); err != nil {
+			return Config{}, nil, err
+		}
+	}
+
+	fs = newFlagSet(&cfg, &path)
+	var errs ValidationError
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" {
+			return
+		}
+		name := EnvPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if v, ok := lookupEnv(name); ok {
+			if err := f.Value.Set(v); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return Config{}, nil, errs
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+	return cfg, fs.Args(), cfg.Validate()
+}
+
+func newFlagSet(cfg *Config, path *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("bookmanager", flag.ContinueOnError)
+	fs.StringVar(path, "config", *path, "path to a YAML configuration file")
+	fs.StringVar(&cfg.Listen, "listen", cfg.Listen, "address for the server to listen on")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "log level: debug, info, warn or error")
+	fs.DurationVar(&cfg.Timeouts.Read, "read-timeout", cfg.Timeouts.Read, "maximum duration for reading a request")
+	fs.DurationVar(&cfg.Timeouts.Write, "write-timeout", cfg.Timeouts.Write, "maximum duration for writing a response")
+	fs.DurationVar(&cfg.Timeouts.Idle, "idle-timeout", cfg.Timeouts.Idle, "maximum duration to keep an idle connection open")
+	fs.DurationVar(&cfg.Timeouts.Request, "request-timeout", cfg.Timeouts.Request, "maximum duration for handling a request, 0 for unlimited")
+	fs.DurationVar(&cfg.Timeouts.Drain, "drain-timeout", cfg.Timeouts.Drain, "duration to keep serving with /readyz failing when stopping, before connections are closed")
+	fs.DurationVar(&cfg.Timeouts.Shutdown, "shutdown-timeout", cfg.Timeouts.Shutdown, "maximum duration to wait for requests in flight when stopping, 0 for unlimited")
+	fs.StringVar(&cfg.TLS.Cert, "tls-cert", cfg.TLS.Cert, "path to the TLS certificate, enables HTTPS")
+	fs.StringVar(&cfg.TLS.Key, "tls-key", cfg.TLS.Key, "path to the TLS private key")
+	fs.StringVar(&cfg.Auth.AnonymousRole, "anonymous-role", cfg.Auth.AnonymousRole, "role given to requests without an API key: reader, editor or admin, empty to reject them")
+	fs.StringVar(&cfg.Database.Driver, "driver", cfg.Database.Driver, "storage backend: mysql, sqlite3 or memory")
+	fs.StringVar(&cfg.Database.DSN, "dsn", cfg.Database.DSN, "data source name for the storage backend")
+	fs.IntVar(&cfg.Database.MaxOpenConns, "max-open-conns", cfg.Database.MaxOpenConns, "maximum open database connections, 0 for unlimited")
+	fs.IntVar(&cfg.Database.MaxIdleConns, "max-idle-conns", cfg.Database.MaxIdleConns, "maximum idle database connections")
+	fs.DurationVar(&cfg.Database.ConnMaxLifetime, "conn-max-lifetime", cfg.Database.ConnMaxLifetime, "maximum lifetime of a database connection, 0 for unlimited")
+	fs.BoolVar(&cfg.Database.AutoMigrate, "auto-migrate", cfg.Database.AutoMigrate, "apply pending schema migrations on startup")
+	return fs
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.New(fmt.Sprintf("unable to read config file: %v", err))
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return errors.New(fmt.Sprintf("unable to parse config file %s: %v", path, err))
+	}
+	return nil
+}
+
+func (c Config) Validate() error {
+	var errs ValidationError
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		errs = append(errs, fmt.Sprintf("listen: invalid address %q: %v", c.Listen, err))
+	}
+	if !contains(validLogLevels, c.LogLevel) {
+		errs = append(errs, fmt.Sprintf("log_level: must be one of %v, got %q", validLogLevels, c.LogLevel))
+	}
+	durations := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"timeouts.read", c.Timeouts.Read},
+		{"timeouts.write", c.Timeouts.Write},
+		{"timeouts.idle", c.Timeouts.Idle},
+		{"timeouts.request", c.Timeouts.Request},
+		{"timeouts.drain", c.Timeouts.Drain},
+		{"timeouts.shutdown", c.Timeouts.Shutdown},
+		{"database.conn_max_lifetime", c.Database.ConnMaxLifetime},
+	}
+	for _, d := range durations {
+		if d.d < 0 {
+			errs = append(errs, fmt.Sprintf("%s: must not be negative, got %v", d.name, d.d))
+		}
+	}
+	if c.Timeouts.Write > 0 && c.Timeouts.Request >= c.Timeouts.Write {
+		errs = append(errs, fmt.Sprintf("timeouts.request: must be shorter than timeouts.write (%v), got %v",
+			c.Timeouts.Write, c.Timeouts.Request))
+	}
+	if (len(c.TLS.Cert) == 0) != (len(c.TLS.Key) == 0) {
+		errs = append(errs, "tls: cert and key must be given together")
+	}
+	for _, path := range []string{c.TLS.Cert, c.TLS.Key} {
+		if len(path) == 0 {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			errs = append(errs, fmt.Sprintf("tls: %v", err))
+		}
+	}
+	if len(c.Auth.AnonymousRole) > 0 && !contains(validRoles, c.Auth.AnonymousRole) {
+		errs = append(errs, fmt.Sprintf("auth.anonymous_role: must be empty or one of %v, got %q", validRoles, c.Auth.AnonymousRole))
+	}
+	if !contains(validDrivers, c.Database.Driver) {
+		errs = append(errs, fmt.Sprintf("database.driver: must be one of %v, got %q", validDrivers, c.Database.Driver))
+	}
+	if c.Database.Driver != "memory" && len(c.Database.DSN) == 0 {
+		errs = append(errs, fmt.Sprintf("database.dsn: required for driver %q", c.Database.Driver))
+	}
+	if c.Database.MaxOpenConns < 0 {
+		errs = append(errs, fmt.Sprintf("database.max_open_conns: must not be negative, got %d", c.Database.MaxOpenConns))
+	}
+	if c.Database.MaxIdleConns < 0 {
+		errs = append(errs, fmt.Sprintf("database.max_idle_conns: must not be negative, got %d", c.Database.MaxIdleConns))
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, fmt.Sprintf("database.max_idle_conns: must not exceed max_open_conns (%d), got %d",
+			c.Database.MaxOpenConns, c.Database.MaxIdleConns))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
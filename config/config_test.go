@@ -0,0 +1,172 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := vars[key]
+		return v, ok
+	}
+}
+
+func writeConfig(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("unable to write config file: %v", err)
+	}
+	return path
+}
+
+func TestPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+listen: ":9000"
+log_level: debug
+timeouts:
+  read: 1s
+database:
+  driver: sqlite3
+  dsn: file.db
+`)
+	testCases := []struct {
+		desc   string
+		args   []string
+		env    map[string]string
+		listen string
+		read   time.Duration
+		driver string
+	}{
+		{
+			desc:   "defaults",
+			listen: ":8080",
+			read:   10 * time.Second,
+			driver: "mysql",
+		},
+		{
+			desc:   "file over defaults",
+			args:   []string{"-config", path},
+			listen: ":9000",
+			read:   time.Second,
+			driver: "sqlite3",
+		},
+		{
+			desc:   "file from environment",
+			env:    map[string]string{"BOOKMANAGER_CONFIG": path},
+			listen: ":9000",
+			read:   time.Second,
+			driver: "sqlite3",
+		},
+		{
+			desc:   "environment over file",
+			args:   []string{"-config", path},
+			env:    map[string]string{"BOOKMANAGER_LISTEN": ":7000", "BOOKMANAGER_READ_TIMEOUT": "2s"},
+			listen: ":7000",
+			read:   2 * time.Second,
+			driver: "sqlite3",
+		},
+		{
+			desc:   "flags over environment",
+			args:   []string{"-config", path, "-listen", ":6000", "-driver", "memory"},
+			env:    map[string]string{"BOOKMANAGER_LISTEN": ":7000"},
+			listen: ":6000",
+			read:   time.Second,
+			driver: "memory",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			cfg, _, err := Load(tc.args, env(tc.env))
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if cfg.Listen != tc.listen || cfg.Timeouts.Read != tc.read || cfg.Database.Driver != tc.driver {
+				t.Fatalf("expected [%s %v %s], got [%s %v %s]", tc.listen, tc.read, tc.driver,
+					cfg.Listen, cfg.Timeouts.Read, cfg.Database.Driver)
+			}
+		})
+	}
+}
+
+func TestRemainingArgs(t *testing.T) {
+	_, args, err := Load([]string{"-driver", "memory", "migrate", "up"}, env(nil))
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Fatalf("expected [migrate up], got [%v]", args)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	testCases := []struct {
+		desc string
+		args []string
+		env  map[string]string
+		errs []string
+	}{
+		{
+			desc: "bad listen address",
+			args: []string{"-listen", "8080"},
+			errs: []string{"listen"},
+		},
+		{
+			desc: "unknown driver",
+			args: []string{"-driver", "postgres"},
+			errs: []string{"database.driver"},
+		},
+		{
+			desc: "every error at once",
+			args: []string{"-log-level", "loud", "-dsn", "", "-max-open-conns", "2", "-tls-cert", "cert.pem"},
+			errs: []string{"log_level", "database.dsn", "database.max_idle_conns", "tls: cert and key"},
+		},
+		{
+			desc: "request timeout past write timeout",
+			args: []string{"-write-timeout", "5s", "-request-timeout", "10s"},
+			errs: []string{"timeouts.request"},
+		},
+		{
+			desc: "unknown anonymous role",
+			args: []string{"-anonymous-role", "guest"},
+			errs: []string{"auth.anonymous_role"},
+		},
+		{
+			desc: "negative drain timeout",
+			args: []string{"-drain-timeout", "-1s"},
+			errs: []string{"timeouts.drain"},
+		},
+		{
+			desc: "negative shutdown timeout",
+			env:  map[string]string{"BOOKMANAGER_SHUTDOWN_TIMEOUT": "-1s"},
+			errs: []string{"timeouts.shutdown"},
+		},
+		{
+			desc: "bad environment value",
+			env:  map[string]string{"BOOKMANAGER_READ_TIMEOUT": "soon"},
+			errs: []string{"BOOKMANAGER_READ_TIMEOUT"},
+		},
+		{
+			desc: "unknown file key",
+			args: []string{"-config", writeConfig(t, "port: 8080\n")},
+			errs: []string{"port"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			_, _, err := Load(tc.args, env(tc.env))
+			if err == nil {
+				t.Fatalf("expected an error, got none")
+			}
+			for _, e := range tc.errs {
+				if !strings.Contains(err.Error(), e) {
+					t.Fatalf("expected error to mention %q, got [%v]", e, err)
+				}
+			}
+		})
+	}
+}
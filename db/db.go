@@ -2,8 +2,52 @@ package db
 
 import (
 	"database/sql"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/masnax/canonical-bookmanager/config"
+	_ "github.com/mattn/go-sqlite3"
 )
 
-func GetDB() (*sql.DB, error) {
-	return sql.Open("mysql", "sql:password@tcp(127.0.0.1:3306)/bookmanager")
+// Open connects to the configured database and sizes its connection pool.
+// SQLite databases are opened with foreign keys enabled, MySQL databases
+// report matched rather than changed rows, as SQLite does.
+func Open(cfg config.Database) (*sql.DB, error) {
+	dsn := cfg.DSN
+	switch cfg.Driver {
+	case "sqlite3":
+		dsn = sqliteDSN(dsn)
+	case "mysql":
+		mysqlCfg, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, err
+		}
+		mysqlCfg.ClientFoundRows = true
+		dsn = mysqlCfg.FormatDSN()
+	}
+	db, err := sql.Open(cfg.Driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	if cfg.Driver == "sqlite3" && (strings.Contains(dsn, ":memory:") || strings.Contains(dsn, "mode=memory")) {
+		// every connection to an in-memory database gets its own copy,
+		// so keep exactly one alive for the lifetime of the pool
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		db.SetConnMaxLifetime(0)
+	}
+	return db, nil
+}
+
+func sqliteDSN(dsn string) string {
+	if strings.Contains(dsn, "_foreign_keys") || strings.Contains(dsn, "_fk") {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&_foreign_keys=on"
+	}
+	return dsn + "?_foreign_keys=on"
 }
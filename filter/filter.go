@@ -12,87 +12,154 @@ import (
 )
 
 /*
-filter structure: url/path?filter=KEY+OP+VALUE
-where KEY    is a field
-			OP     is an operator
-			VALUE  is a series of words delimited by '+' corresponding to an entry
+filter structure: url/path?filter=EXPR, URL encoded
+where EXPR   is KEY OP VALUE, (EXPR), not EXPR, EXPR and EXPR, or EXPR or EXPR
+			KEY    is the JSON name of a book field, in any case
+			OP     is one of eq, ne, lt, gt, le, ge, in any case
+			VALUE  is one or more words separated by whitespace and ending at
+			       'and', 'or', a parenthesis or the end, which are joined by
+			       single spaces, or a single or double quoted string which may
+			       contain keywords, parentheses and backslash escapes; "" is
+			       the empty value
+'not' binds tighter than 'and', which binds tighter than 'or', and keywords
+are matched in any case
 */
 
-type Filter struct {
-	Key string
-	Op  string
-	Val string
+var validOps = []string{"eq", "ne", "lt", "gt", "le", "ge"}
+
+type fieldKind int
+
+const (
+	kindString fieldKind = iota
+	kindInt
+	kindDate
+)
+
+type Expr interface {
+	Eval(b book.Book) (bool, error)
+	String() string
 }
 
-var validOps = []string{"eq", "ne", "lt", "gt", "le", "ge"}
+type And struct {
+	Left  Expr
+	Right Expr
+}
 
-func FilterBooks(form string, book book.Book) (bool, error) {
-	filter, err := parseFilter(form)
-	if err != nil {
+type Or struct {
+	Left  Expr
+	Right Expr
+}
+
+type Not struct {
+	Expr Expr
+}
+
+type Comparison struct {
+	Key   string
+	Field string
+	Op    string
+	Value string
+
+	kind     fieldKind
+	valuePos int
+}
+
+func (a *And) Eval(b book.Book) (bool, error) {
+	left, err := a.Left.Eval(b)
+	if err != nil || !left {
 		return false, err
 	}
-	r := reflect.ValueOf(book)
-	for i := 0; i < r.NumField(); i++ {
-		field := r.Type().Field(i)
-		if strings.ToLower(field.Name) == strings.ToLower(filter.Key) {
-			switch field.Type.Kind() {
-			case reflect.Int:
-				return handleOpInt(r.Field(i), filter)
-			case reflect.String:
-				return handleOpString(field.Name, r.Field(i), filter)
-			default:
-				return false, errors.New(fmt.Sprintf("unexpected field for book: %s", field.Name))
-			}
-		}
+	return a.Right.Eval(b)
+}
+
+func (a *And) String() string {
+	return fmt.Sprintf("(%s and %s)", a.Left, a.Right)
+}
+
+func (o *Or) Eval(b book.Book) (bool, error) {
+	left, err := o.Left.Eval(b)
+	if err != nil || left {
+		return left, err
+	}
+	return o.Right.Eval(b)
+}
+
+func (o *Or) String() string {
+	return fmt.Sprintf("(%s or %s)", o.Left, o.Right)
+}
+
+func (n *Not) Eval(b book.Book) (bool, error) {
+	keep, err := n.Expr.Eval(b)
+	return !keep, err
+}
+
+func (n *Not) String() string {
+	return fmt.Sprintf("not %s", n.Expr)
+}
+
+func (c *Comparison) Eval(b book.Book) (bool, error) {
+	value := reflect.ValueOf(b).FieldByName(c.Field)
+	switch c.kind {
+	case kindInt:
+		return handleOpInt(value, c)
+	case kindDate:
+		return handleOpDate(value, c)
+	default:
+		return handleOpString(value, c)
+	}
+}
+
+func (c *Comparison) String() string {
+	return fmt.Sprintf("%s %s %q", c.Key, c.Op, c.Value)
+}
+
+func handleOpDate(value reflect.Value, c *Comparison) (bool, error) {
+	valueStr := strings.ToLower(value.String())
+	valueDate, err := time.Parse("2006-01-02", valueStr)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("invalid date for book, got %s", valueStr))
+	}
+	filterDate, err := time.Parse("2006-01-02", c.Value)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("expected date of form Y-M-D, got %s", c.Value))
 	}
-	return true, nil
+
+	switch c.Op {
+	case "eq":
+		return !valueDate.Before(filterDate) && !valueDate.After(filterDate), nil
+	case "ne":
+		return valueDate.Before(filterDate) || valueDate.After(filterDate), nil
+	case "lt":
+		return valueDate.Before(filterDate), nil
+	case "gt":
+		return valueDate.After(filterDate), nil
+	case "le":
+		return !valueDate.After(filterDate), nil
+	case "ge":
+		return !valueDate.Before(filterDate), nil
+	}
+	return false, errors.New("invalid filter")
 }
 
-func handleOpString(name string, value reflect.Value, filter Filter) (bool, error) {
+func handleOpString(value reflect.Value, c *Comparison) (bool, error) {
 	valueStr := strings.ToLower(value.String())
-	if name == "Published" {
-		valueDate, err := time.Parse("2006-01-02", valueStr)
-		if err != nil {
-			return false, errors.New(fmt.Sprintf("invalid date for book, got %s", valueStr))
-		}
-		filterDate, err := time.Parse("2006-01-02", filter.Val)
-		if err != nil {
-			return false, errors.New(fmt.Sprintf("expected date of form Y-M-D, got %s", filter.Val))
-		}
-
-		switch filter.Op {
-		case "eq":
-			return !valueDate.Before(filterDate) && !valueDate.After(filterDate), nil
-		case "ne":
-			return valueDate.Before(filterDate) || valueDate.After(filterDate), nil
-		case "lt":
-			return valueDate.Before(filterDate), nil
-		case "gt":
-			return valueDate.After(filterDate), nil
-		case "le":
-			return !valueDate.After(filterDate), nil
-		case "ge":
-			return !valueDate.Before(filterDate), nil
-		}
-	} else {
-		filterVal := strings.ToLower(filter.Val)
-		switch filter.Op {
-		case "eq":
-			return valueStr == filterVal, nil
-		case "ne":
-			return valueStr != filterVal, nil
-		}
+	filterVal := strings.ToLower(c.Value)
+	switch c.Op {
+	case "eq":
+		return valueStr == filterVal, nil
+	case "ne":
+		return valueStr != filterVal, nil
 	}
 	return false, errors.New("invalid filter")
 }
 
-func handleOpInt(value reflect.Value, filter Filter) (bool, error) {
-	filterVal, err := strconv.Atoi(filter.Val)
+func handleOpInt(value reflect.Value, c *Comparison) (bool, error) {
+	filterVal, err := strconv.Atoi(c.Value)
 	if err != nil {
 		return false, errors.New("expected integer value in form")
 	}
 	valueInt := value.Int()
-	switch filter.Op {
+	switch c.Op {
 	case "eq":
 		return valueInt == int64(filterVal), nil
 	case "ne":
@@ -108,26 +175,3 @@ func handleOpInt(value reflect.Value, filter Filter) (bool, error) {
 	}
 	return false, errors.New("invalid filter")
 }
-
-func parseFilter(form string) (Filter, error) {
-	filter := Filter{}
-	parts := strings.Split(form, " ")
-	if len(parts) < 3 {
-		return Filter{}, errors.New(fmt.Sprintf("invalid filter: %s", form))
-	}
-	filter.Key = parts[0]
-	filter.Op = parts[1]
-	for i, p := range parts[2:] {
-		filter.Val += p
-		if (i + 2) != len(parts)-1 {
-			filter.Val += " "
-		}
-	}
-
-	for _, o := range validOps {
-		if filter.Op == o {
-			return filter, nil
-		}
-	}
-	return Filter{}, errors.New(fmt.Sprintf("invalid filter operator: %s", form))
-}
@@ -7,6 +7,15 @@ import (
 	"github.com/masnax/canonical-bookmanager/book"
 )
 
+// filterBook parses the filter and evaluates it against the book.
+func filterBook(form string, b book.Book) (bool, error) {
+	expr, err := Parse(form)
+	if err != nil {
+		return false, err
+	}
+	return expr.Eval(b)
+}
+
 func TestValidFilter(t *testing.T) {
 	testCases := []struct {
 		desc      string
@@ -22,7 +31,7 @@ func TestValidFilter(t *testing.T) {
 		},
 		{
 			desc:      "empty title",
-			formValue: "title eq ",
+			formValue: `title eq ""`,
 		},
 		{
 			desc:      "long title",
@@ -37,13 +46,13 @@ func TestValidFilter(t *testing.T) {
 			formValue: "edition gt 1",
 		},
 		{
-			desc:      "non-present key",
-			formValue: "thing gt 1",
+			desc:      "id",
+			formValue: "id ge 1",
 		},
 	}
 	for _, tc := range testCases {
 		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
-			_, err := FilterBooks(tc.formValue, book.Book{Published: "2020-01-01"})
+			_, err := filterBook(tc.formValue, book.Book{Published: "2020-01-01"})
 			if err != nil {
 				t.Fatalf("expected no error, got [%v]", err)
 			}
@@ -88,13 +97,161 @@ func TestInvalidFilter(t *testing.T) {
 			desc:      "invalid date",
 			formValue: "published eq 2",
 		},
+		{
+			desc:      "non-present key",
+			formValue: "thing gt 1",
+		},
+		{
+			desc:      "misspelt key",
+			formValue: "titel eq x",
+		},
+		{
+			desc:      "missing value",
+			formValue: "title eq ",
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
-			_, err := FilterBooks(tc.formValue, book.Book{Published: "2020-01-01"})
+			_, err := filterBook(tc.formValue, book.Book{Published: "2020-01-01"})
 			if err == nil {
 				t.Fatalf("expected an error, got none")
 			}
 		})
 	}
 }
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		formValue string
+		out       string
+	}{
+		{
+			desc:      "precedence",
+			formValue: "genre eq fantasy or genre eq scifi and published ge 2000-01-01",
+			out:       `(genre eq "fantasy" or (genre eq "scifi" and published ge "2000-01-01"))`,
+		},
+		{
+			desc:      "grouping",
+			formValue: "(genre eq fantasy or genre eq scifi) and edition gt 1",
+			out:       `((genre eq "fantasy" or genre eq "scifi") and edition gt "1")`,
+		},
+		{
+			desc:      "not",
+			formValue: "NOT author eq max asna AND not (edition eq 1)",
+			out:       `(not author eq "max asna" and not edition eq "1")`,
+		},
+		{
+			desc:      "quoted keywords",
+			formValue: `title eq "war and peace" or title eq 'the \'or\' clause'`,
+			out:       `(title eq "war and peace" or title eq "the 'or' clause")`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			expr, err := Parse(tc.formValue)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if expr.String() != tc.out {
+				t.Fatalf("expected [%s], got [%s]", tc.out, expr)
+			}
+		})
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		formValue string
+		pos       int
+	}{
+		{
+			desc:      "missing operator",
+			formValue: "title",
+			pos:       6,
+		},
+		{
+			desc:      "invalid operator",
+			formValue: "genre eq a and title is b",
+			pos:       22,
+		},
+		{
+			desc:      "invalid value",
+			formValue: "genre eq a or (edition ge two)",
+			pos:       27,
+		},
+		{
+			desc:      "unclosed group",
+			formValue: "(genre eq a",
+			pos:       12,
+		},
+		{
+			desc:      "dangling and",
+			formValue: "genre eq a and",
+			pos:       15,
+		},
+		{
+			desc:      "unterminated quote",
+			formValue: `title eq "abc`,
+			pos:       10,
+		},
+		{
+			desc:      "trailing group",
+			formValue: "genre eq a (edition eq 1)",
+			pos:       12,
+		},
+		{
+			desc:      "unknown key",
+			formValue: "genre eq a and titel eq b",
+			pos:       16,
+		},
+		{
+			desc:      "missing value",
+			formValue: "genre eq a and title eq",
+			pos:       24,
+		},
+		{
+			desc:      "missing value before and",
+			formValue: "title eq and genre eq a",
+			pos:       10,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			_, err := Parse(tc.formValue)
+			syntaxErr, ok := err.(*SyntaxError)
+			if !ok {
+				t.Fatalf("expected a syntax error, got [%v]", err)
+			}
+			if syntaxErr.Pos != tc.pos {
+				t.Fatalf("expected error at position %d, got [%v]", tc.pos, err)
+			}
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	b := book.Book{Title: "Dune", Author: "Frank Herbert", Published: "1965-08-01", Edition: 2, Genre: "scifi"}
+	testCases := []struct {
+		formValue string
+		keep      bool
+	}{
+		{formValue: "genre eq scifi and published lt 1970-01-01", keep: true},
+		{formValue: "genre eq fantasy or edition ge 3", keep: false},
+		{formValue: "not (genre eq fantasy or edition ge 3)", keep: true},
+		{formValue: "author eq 'frank herbert' and not title ne dune", keep: true},
+		{formValue: "description eq '' and genre eq scifi", keep: true},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.formValue), func(t *testing.T) {
+			keep, err := filterBook(tc.formValue, b)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if keep != tc.keep {
+				t.Fatalf("expected %v, got %v", tc.keep, keep)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package filter
+
+import (
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of filter"
+	case tokenString:
+		return `"` + t.text + `"`
+	default:
+		return `'` + t.text + `'`
+	}
+}
+
+// keyword reports whether the token is the given unquoted keyword.
+func (t token) keyword(word string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, word)
+}
+
+// tokenize splits a filter into words, quoted strings and parentheses.
+// Positions are 1-based byte offsets into the filter.
+func tokenize(form string) ([]token, error) {
+	tokens := []token{}
+	i := 0
+	for i < len(form) {
+		c := rune(form[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: i + 1})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: i + 1})
+			i++
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(form) {
+					return nil, &SyntaxError{Pos: start + 1, Msg: "unterminated quoted value"}
+				}
+				if form[i] == '\\' && i+1 < len(form) {
+					sb.WriteByte(form[i+1])
+					i += 2
+					continue
+				}
+				if rune(form[i]) == c {
+					i++
+					break
+				}
+				sb.WriteByte(form[i])
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: start + 1})
+		default:
+			start := i
+			for i < len(form) && !strings.ContainsRune(" \t\n\r()\"'", rune(form[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: form[start:i], pos: start + 1})
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(form) + 1}), nil
+}
@@ -0,0 +1,196 @@
+package filter
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/masnax/canonical-bookmanager/book"
+)
+
+// SyntaxError is returned for a filter that cannot be parsed or does not fit
+// the book fields, Pos is the 1-based byte offset of the offending token.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid filter at position %d: %s", e.Pos, e.Msg)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse turns a filter into an expression, checking every comparison
+// against the fields of a book.
+func Parse(form string) (Expr, error) {
+	tokens, err := tokenize(form)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected 'and', 'or' or end of filter, got %s", t)}
+	}
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	t := p.peek()
+	if t.keyword("not") {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: expr}, nil
+	}
+	if t.kind == tokenLParen {
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, &SyntaxError{Pos: closing.pos,
+				Msg: fmt.Sprintf("expected ')' to close '(' at position %d, got %s", t.pos, closing)}
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (Expr, error) {
+	key := p.next()
+	if key.kind != tokenWord || key.keyword("and") || key.keyword("or") {
+		return nil, &SyntaxError{Pos: key.pos, Msg: fmt.Sprintf("expected field name, got %s", key)}
+	}
+	op := p.next()
+	if op.kind != tokenWord || !isValidOp(strings.ToLower(op.text)) {
+		return nil, &SyntaxError{Pos: op.pos,
+			Msg: fmt.Sprintf("expected operator %v, got %s", validOps, op)}
+	}
+
+	c := &Comparison{Key: key.text, Op: strings.ToLower(op.text), valuePos: p.peek().pos}
+	if p.peek().kind == tokenString {
+		c.Value = p.next().text
+	} else {
+		words := []string{}
+		for t := p.peek(); t.kind == tokenWord && !t.keyword("and") && !t.keyword("or"); t = p.peek() {
+			words = append(words, p.next().text)
+		}
+		if len(words) == 0 {
+			return nil, &SyntaxError{Pos: c.valuePos,
+				Msg: fmt.Sprintf("expected a value for %s, quote an empty one as \"\", got %s", c.Key, p.peek())}
+		}
+		c.Value = strings.Join(words, " ")
+	}
+	if err := c.resolve(key.pos, op.pos); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// resolve matches the key to a book field and checks that the operator and
+// value make sense for it.
+func (c *Comparison) resolve(keyPos int, opPos int) error {
+	r := reflect.TypeOf(book.Book{})
+	names := []string{}
+	for i := 0; i < r.NumField(); i++ {
+		field := r.Field(i)
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+		names = append(names, strings.Split(field.Tag.Get("json"), ",")[0])
+		if !strings.EqualFold(field.Name, c.Key) {
+			continue
+		}
+		c.Field = field.Name
+		switch {
+		case field.Name == "Published":
+			c.kind = kindDate
+			if _, err := time.Parse("2006-01-02", c.Value); err != nil {
+				return &SyntaxError{Pos: c.valuePos,
+					Msg: fmt.Sprintf("expected date of form Y-M-D for %s, got %q", c.Key, c.Value)}
+			}
+		case field.Type.Kind() == reflect.Int:
+			c.kind = kindInt
+			if _, err := strconv.Atoi(c.Value); err != nil {
+				return &SyntaxError{Pos: c.valuePos,
+					Msg: fmt.Sprintf("expected integer value for %s, got %q", c.Key, c.Value)}
+			}
+		case field.Type.Kind() == reflect.String:
+			c.kind = kindString
+			if c.Op != "eq" && c.Op != "ne" {
+				return &SyntaxError{Pos: opPos,
+					Msg: fmt.Sprintf("operator '%s' is not supported for %s, expected eq or ne", c.Op, c.Key)}
+			}
+		default:
+			return &SyntaxError{Pos: keyPos, Msg: fmt.Sprintf("unexpected field for book: %s", field.Name)}
+		}
+		return nil
+	}
+	return &SyntaxError{Pos: keyPos, Msg: fmt.Sprintf("unknown field %s, expected one of %v", c.Key, names)}
+}
+
+func isValidOp(op string) bool {
+	for _, o := range validOps {
+		if op == o {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var sqlOps = map[string]string{
+	"eq": "=",
+	"ne": "<>",
+	"lt": "<",
+	"gt": ">",
+	"le": "<=",
+	"ge": ">=",
+}
+
+// ToSQL compiles an expression into a WHERE clause fragment and its bound
+// arguments. Only fields present in columns, which maps book field names to
+// column names, may be compared.
+func ToSQL(expr Expr, columns map[string]string) (string, []interface{}, error) {
+	switch e := expr.(type) {
+	case *And:
+		return binarySQL("AND", e.Left, e.Right, columns)
+	case *Or:
+		return binarySQL("OR", e.Left, e.Right, columns)
+	case *Not:
+		where, args, err := ToSQL(e.Expr, columns)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + where + ")", args, nil
+	case *Comparison:
+		return comparisonSQL(e, columns)
+	default:
+		return "", nil, errors.New(fmt.Sprintf("unexpected filter expression: %v", expr))
+	}
+}
+
+func binarySQL(op string, left Expr, right Expr, columns map[string]string) (string, []interface{}, error) {
+	l, leftArgs, err := ToSQL(left, columns)
+	if err != nil {
+		return "", nil, err
+	}
+	r, rightArgs, err := ToSQL(right, columns)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("(%s %s %s)", l, op, r), append(leftArgs, rightArgs...), nil
+}
+
+func comparisonSQL(c *Comparison, columns map[string]string) (string, []interface{}, error) {
+	column, ok := columns[c.Field]
+	if !ok {
+		return "", nil, errors.New(fmt.Sprintf("filtering on %s is not supported", c.Key))
+	}
+	op := sqlOps[c.Op]
+	switch c.kind {
+	case kindInt:
+		value, err := strconv.Atoi(c.Value)
+		if err != nil {
+			return "", nil, errors.New("expected integer value in form")
+		}
+		return fmt.Sprintf("%s %s ?", column, op), []interface{}{value}, nil
+	case kindDate:
+		return fmt.Sprintf("%s %s ?", column, op), []interface{}{c.Value}, nil
+	default:
+		// text comparisons are case insensitive and treat NULL as empty, as Eval does
+		return fmt.Sprintf("LOWER(COALESCE(%s, '')) %s LOWER(?)", column, op), []interface{}{c.Value}, nil
+	}
+}
@@ -0,0 +1,75 @@
+package filter
+
+import (
+	"fmt"
+	"testing"
+)
+
+var testColumns = map[string]string{
+	"Title":     "book.title",
+	"Published": "book.published",
+	"Edition":   "book.edition",
+	"Genre":     "book.genre",
+}
+
+func TestToSQL(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		formValue string
+		where     string
+		args      string
+	}{
+		{
+			desc:      "text",
+			formValue: "title eq 'war and peace'",
+			where:     "LOWER(COALESCE(book.title, '')) = LOWER(?)",
+			args:      "[war and peace]",
+		},
+		{
+			desc:      "integer and date",
+			formValue: "edition ge 2 or published lt 2000-01-01",
+			where:     "(book.edition >= ? OR book.published < ?)",
+			args:      "[2 2000-01-01]",
+		},
+		{
+			desc:      "not and grouping",
+			formValue: "not (genre ne fantasy and edition eq 1)",
+			where:     "NOT ((LOWER(COALESCE(book.genre, '')) <> LOWER(?) AND book.edition = ?))",
+			args:      "[fantasy 1]",
+		},
+		{
+			desc:      "injection stays bound",
+			formValue: `title eq "x' OR '1'='1"`,
+			where:     "LOWER(COALESCE(book.title, '')) = LOWER(?)",
+			args:      "[x' OR '1'='1]",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			expr, err := Parse(tc.formValue)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			where, args, err := ToSQL(expr, testColumns)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if where != tc.where {
+				t.Fatalf("expected [%s], got [%s]", tc.where, where)
+			}
+			if fmt.Sprint(args) != tc.args {
+				t.Fatalf("expected args %s, got %v", tc.args, args)
+			}
+		})
+	}
+}
+
+func TestToSQLWhitelist(t *testing.T) {
+	expr, err := Parse("description eq secret")
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if _, _, err := ToSQL(expr, testColumns); err == nil {
+		t.Fatalf("expected an error for a column outside the whitelist, got none")
+	}
+}
@@ -3,8 +3,10 @@ module github.com/masnax/canonical-bookmanager
 go 1.16
 
 require (
-	github.com/go-sql-driver/mysql v1.5.0 // indirect
-	github.com/mitchellh/mapstructure v1.4.1 // indirect
-	github.com/olekukonko/tablewriter v0.0.5 // indirect
-	github.com/spf13/cobra v1.1.3 // indirect
+	github.com/go-sql-driver/mysql v1.5.0
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/olekukonko/tablewriter v0.0.5
+	github.com/prometheus/client_golang v1.9.0
+	github.com/spf13/cobra v1.1.3
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+// WithAuth identifies the caller by the API key sent as a bearer token. A
+// request without a token is given the anonymous role, which may be none, and
+// a request with a token that is malformed or unknown is rejected outright.
+// Routes check the role with Require.
+func WithAuth(h http.Handler, keys store.KeyStore, anonymous auth.Role) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if len(header) == 0 {
+			if anonymous != auth.RoleNone {
+				r = r.WithContext(auth.NewContext(r.Context(), auth.Key{Name: "anonymous", Role: anonymous}))
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+		scheme, token := header, ""
+		if i := strings.Index(header, " "); i >= 0 {
+			scheme, token = header[:i], strings.TrimSpace(header[i+1:])
+		}
+		if !strings.EqualFold(scheme, "Bearer") || len(token) == 0 {
+			unauthorized(w, r, "Expected an Authorization header of the form: Bearer <token>")
+			return
+		}
+		key, err := keys.GetKeyByHash(r.Context(), auth.Hash(token))
+		if err == store.ErrNotFound {
+			unauthorized(w, r, "The API key is unknown or has been revoked")
+			return
+		}
+		if err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), key)))
+	})
+}
+
+// Require only lets callers with at least the given role through to h.
+// Anonymous callers that fall short are asked to authenticate rather than
+// being forbidden.
+func Require(role auth.Role, h router.HandlerFunc) router.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, p router.Params) {
+		key, ok := auth.FromContext(r.Context())
+		if !ok {
+			unauthorized(w, r, "An API key is required, send it as: Authorization: Bearer <token>")
+			return
+		}
+		if !key.Role.Allows(role) && key.ID == 0 {
+			unauthorized(w, r, fmt.Sprintf("The %s role is required, send an API key as: Authorization: Bearer <token>", role))
+			return
+		}
+		if !key.Role.Allows(role) {
+			problem.Write(w, r, problem.New(http.StatusForbidden, problem.CodeForbidden,
+				fmt.Sprintf("The %s role is required, API key %s has the %s role", role, key.Name, key.Role)))
+			return
+		}
+		h(w, r, p)
+	}
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, detail string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="bookmanager"`)
+	problem.Write(w, r, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, detail))
+}
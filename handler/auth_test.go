@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+// asAdmin lets requests without a key through as admin, for tests that are
+// not about authorization.
+func asAdmin(h http.Handler) http.Handler {
+	return WithAuth(h, nil, auth.RoleAdmin)
+}
+
+func TestAuth(t *testing.T) {
+	s := store.NewMemoryStore()
+	tokens := map[auth.Role]string{}
+	for _, role := range auth.Roles {
+		key, token, err := auth.NewKey(string(role), role)
+		if err != nil {
+			t.Fatalf("expected no error, got [%v]", err)
+		}
+		if _, err := s.AddKey(context.Background(), key); err != nil {
+			t.Fatalf("expected no error, got [%v]", err)
+		}
+		tokens[role] = token
+	}
+	revoked, revokedToken, _ := auth.NewKey("revoked", auth.RoleAdmin)
+	id, _ := s.AddKey(context.Background(), revoked)
+	s.RevokeKey(context.Background(), id)
+
+	rt := router.New()
+	NewBookHandler(s).Register(rt)
+	NewCollectionHandler(s).Register(rt)
+	NewKeyHandler(s).Register(rt)
+
+	testCases := []struct {
+		desc      string
+		anonymous auth.Role
+		header    string
+		method    string
+		path      string
+		body      string
+		status    int
+	}{
+		{desc: "no key", method: "GET", path: "/books", status: http.StatusUnauthorized},
+		{desc: "anonymous reader", anonymous: auth.RoleReader, method: "GET", path: "/books", status: http.StatusOK},
+		{desc: "anonymous reader writing", anonymous: auth.RoleReader, method: "POST", path: "/collections",
+			body: `{"collection": "a"}`, status: http.StatusUnauthorized},
+		{desc: "reader", header: "Bearer " + tokens[auth.RoleReader], method: "GET", path: "/books", status: http.StatusOK},
+		{desc: "lower case scheme", header: "bearer " + tokens[auth.RoleReader], method: "GET", path: "/books", status: http.StatusOK},
+		{desc: "reader writing", header: "Bearer " + tokens[auth.RoleReader], method: "POST", path: "/collections",
+			body: `{"collection": "a"}`, status: http.StatusForbidden},
+		{desc: "editor writing", header: "Bearer " + tokens[auth.RoleEditor], method: "POST", path: "/collections",
+			body: `{"collection": "a"}`, status: http.StatusCreated},
+		{desc: "editor deleting", header: "Bearer " + tokens[auth.RoleEditor], method: "DELETE", path: "/collections/1",
+			status: http.StatusOK},
+		{desc: "editor listing keys", header: "Bearer " + tokens[auth.RoleEditor], method: "GET", path: "/apikeys",
+			status: http.StatusForbidden},
+		{desc: "admin listing keys", header: "Bearer " + tokens[auth.RoleAdmin], method: "GET", path: "/apikeys",
+			status: http.StatusOK},
+		{desc: "admin reading", header: "Bearer " + tokens[auth.RoleAdmin], method: "GET", path: "/books", status: http.StatusOK},
+		{desc: "unknown key", header: "Bearer bm_0000", method: "GET", path: "/books", status: http.StatusUnauthorized},
+		{desc: "unknown key despite anonymous role", anonymous: auth.RoleAdmin, header: "Bearer bm_0000",
+			method: "GET", path: "/books", status: http.StatusUnauthorized},
+		{desc: "revoked key", header: "Bearer " + revokedToken, method: "GET", path: "/books", status: http.StatusUnauthorized},
+		{desc: "basic auth", header: "Basic dXNlcjpwYXNz", method: "GET", path: "/books", status: http.StatusUnauthorized},
+		{desc: "empty token", header: "Bearer ", method: "GET", path: "/books", status: http.StatusUnauthorized},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if len(tc.header) > 0 {
+				r.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			WithAuth(rt, s, tc.anonymous).ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got [%d]: %s", tc.status, w.Code, w.Body)
+			}
+			if tc.status == http.StatusUnauthorized && len(w.Header().Get("WWW-Authenticate")) == 0 {
+				t.Fatalf("expected a WWW-Authenticate header, got none")
+			}
+		})
+	}
+}
@@ -1,200 +1,225 @@
 package handler
 
 import (
-	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"net/url"
-	"strconv"
-	"sync"
 
+	"github.com/masnax/canonical-bookmanager/auth"
 	"github.com/masnax/canonical-bookmanager/book"
 	"github.com/masnax/canonical-bookmanager/filter"
 	"github.com/masnax/canonical-bookmanager/parser"
+	"github.com/masnax/canonical-bookmanager/patch"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"github.com/masnax/canonical-bookmanager/query"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
 )
 
 type bookHandler struct {
-	sync.Mutex
-	db *sql.DB
+	store store.BookStore
 }
 
-func NewBookHandler(db *sql.DB) *bookHandler {
-	bh := &bookHandler{
-		db: db,
+func NewBookHandler(s store.BookStore) *bookHandler {
+	return &bookHandler{
+		store: s,
 	}
-	http.Handle("/books", bh)
-	http.Handle("/books/", bh)
-	return bh
 }
 
-func (bh *bookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	defer bh.Unlock()
-	bh.Lock()
+func (bh *bookHandler) Register(rt *router.Router) {
+	rt.Handle("GET", "/books", Require(auth.RoleReader, bh.listBooks))
+	rt.Handle("POST", "/books", Require(auth.RoleEditor, bh.addNewBook))
+	rt.Handle("GET", "/books/{id:int}", Require(auth.RoleReader, bh.getBookWithID))
+	rt.Handle("PUT", "/books/{id:int}", Require(auth.RoleEditor, bh.updateBookWithID))
+	rt.Handle("PATCH", "/books/{id:int}", Require(auth.RoleEditor, bh.patchBookWithID))
+	rt.Handle("DELETE", "/books/{id:int}", Require(auth.RoleEditor, bh.deleteBookByID))
+}
 
-	keys := parser.URLParser(r.URL)
-	if err := bh.validateUrl(keys, r.URL); err != nil {
-		parser.ErrorResponse(w, http.StatusBadRequest, err.Error())
+func (bh *bookHandler) listBooks(w http.ResponseWriter, r *http.Request, p router.Params) {
+	opts, page, err := listOptions(r)
+	if err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	lastKey := ""
-	if len(keys) > 0 {
-		lastKey = keys[len(keys)-1]
+	books, total, err := bh.store.ListBooks(r.Context(), opts)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
 	}
-	switch r.Method {
-	case "PUT":
-		bh.updateBookWithID(w, r, lastKey)
-	case "DELETE":
-		bh.deleteBookByID(w, r, lastKey)
-	case "GET":
-		bh.listBooks(w, r, lastKey)
-	case "POST":
-		bh.addNewBook(w, r)
-	default:
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Invalid method: '%s' for path: '%s'", r.Method, r.URL.Path))
+
+	parser.PagedResponse(w, http.StatusOK, books, total, page.NextToken(total))
+}
+
+func (bh *bookHandler) getBookWithID(w http.ResponseWriter, r *http.Request, p router.Params) {
+	book, err := bh.store.GetBook(r.Context(), p.Int("id"))
+	if err != nil {
+		problem.Write(w, r, storeError(err, fmt.Sprintf("No book with id: %s", p["id"]), ""))
+		return
+	}
+	w.Header().Set("ETag", etag(book.Version))
+	if notModified(r, book.Version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
+	parser.JSONResponse(w, http.StatusOK, book)
 }
 
-func (bh *bookHandler) validateUrl(keys []string, url *url.URL) error {
-	if len(keys) > 3 {
-		return errors.New(fmt.Sprintf("Invalid path: '%s'", url.Path))
+// listOptions reads the requested page, the sort order over book fields and
+// the filter, if there is one.
+func listOptions(r *http.Request) (store.ListOptions, query.Page, error) {
+	page, err := query.ParsePage(r)
+	if err != nil {
+		return store.ListOptions{}, page, paramError(err)
 	}
-	if len(keys) > 0 {
-		lastKey := keys[len(keys)-1]
-		if len(lastKey) > 0 {
-			if _, err := strconv.Atoi(lastKey); err != nil {
-				return errors.New(fmt.Sprintf("Invalid key: %s from path: %s", lastKey, url.Path))
-			}
-		}
+	opts, err := bookQuery(r)
+	opts.Limit, opts.Offset = page.Limit, page.Offset
+	return opts, page, err
+}
+
+// bookQuery reads the sort order over book fields and the filter, if there
+// is one.
+func bookQuery(r *http.Request) (store.ListOptions, error) {
+	sort, err := query.ParseSort(r.FormValue("sort"), query.Fields(book.Book{}))
+	if err != nil {
+		return store.ListOptions{}, paramError(err)
+	}
+	opts := store.ListOptions{Sort: sort}
+	form := r.FormValue("filter")
+	if len(form) == 0 {
+		return opts, nil
 	}
-	return nil
+	expr, err := filter.Parse(form)
+	if err != nil {
+		return opts, problem.Field(problem.CodeInvalidFilter, "filter", err.Error())
+	}
+	opts.Filter = expr
+	return opts, nil
 }
 
-func (bh *bookHandler) listBooks(w http.ResponseWriter, r *http.Request, key string) {
-	q := "SELECT * from book"
-	if len(key) > 0 {
-		q += " WHERE id = " + key
-	}
-	rows, err := bh.db.Query(q)
-	defer rows.Close()
-	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError,
-			fmt.Sprintf("Unable to query database due to error: %v", err))
-		return
-	}
-	books := []book.Book{}
-	for rows.Next() {
-		var book book.Book
-		err := rows.Scan(&book.Id, &book.Title,
-			&book.Author, &book.Published, &book.Edition, &book.Description, &book.Genre)
-		if err != nil {
-			parser.ErrorResponse(w, http.StatusInternalServerError,
-				fmt.Sprintf("Unable to scan results: %v", err))
-			return
-		}
-		form := r.FormValue("filter")
-		if len(form) > 0 {
-			keep, err := filter.FilterBooks(form, book)
-			if err != nil {
-				parser.ErrorResponse(w, http.StatusBadRequest, err.Error())
-				return
-			}
-			if !keep {
-				continue
-			}
-		}
-		books = append(books, book)
-	}
-
-	parser.JSONResponse(w, http.StatusOK, books)
+func (bh *bookHandler) addNewBook(w http.ResponseWriter, r *http.Request, p router.Params) {
+	var book book.Book
+	if err := decodeBody(r, &book); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	id, err := bh.store.AddBook(r.Context(), book)
+	if err != nil {
+		problem.Write(w, r, storeError(err, "", ""))
+		return
+	}
+	book, err = bh.store.GetBook(r.Context(), id)
+	if err != nil {
+		problem.Write(w, r, storeError(err, fmt.Sprintf("No book with id: %d", id), ""))
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/books/%d", id))
+	w.Header().Set("ETag", etag(book.Version))
+	parser.JSONResponse(w, http.StatusCreated, book)
 }
 
-func (bh *bookHandler) addNewBook(w http.ResponseWriter, r *http.Request) {
-	body, err := ioutil.ReadAll(r.Body)
+func (bh *bookHandler) updateBookWithID(w http.ResponseWriter, r *http.Request, p router.Params) {
+	version, err := ifMatch(r)
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Malformed request body: %v", err))
+		problem.Write(w, r, err)
 		return
 	}
 	var book book.Book
-	err = json.Unmarshal(body, &book)
-	if err != nil {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Unexpected non-JSON request: %v", err))
+	if err := decodeBody(r, &book); err != nil {
+		problem.Write(w, r, err)
 		return
 	}
 
-	stmt, err := bh.db.Prepare("INSERT INTO book " +
-		"(title, author, published, edition, description, genre) VALUES (?, ?, ?, ?, ?, ?)")
-	defer stmt.Close()
+	notFound := fmt.Sprintf("No book with id: %s", p["id"])
+	book.Version = version
+	err = bh.store.UpdateBook(r.Context(), p.Int("id"), book)
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError,
-			fmt.Sprintf("Unable to update database: %v", err))
+		problem.Write(w, r, storeError(err, notFound, ""))
 		return
 	}
-	_, err = stmt.Exec(book.Title, book.Author, book.Published, book.Edition, book.Description, book.Genre)
+	book, err = bh.store.GetBook(r.Context(), p.Int("id"))
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		problem.Write(w, r, storeError(err, notFound, ""))
 		return
 	}
-	parser.JSONResponse(w, http.StatusOK, nil)
+	w.Header().Set("ETag", etag(book.Version))
+	parser.JSONResponse(w, http.StatusOK, book)
 }
 
-func (bh *bookHandler) updateBookWithID(w http.ResponseWriter, r *http.Request, key string) {
-	if len(key) == 0 {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Invalid path: %s", r.URL.Path))
+// patchBookWithID applies a JSON Merge Patch, or a JSON Patch if the request
+// says so, to the stored book. The result is checked as a PUT body would be,
+// and is only stored if the book has not changed since the patch was applied.
+func (bh *bookHandler) patchBookWithID(w http.ResponseWriter, r *http.Request, p router.Params) {
+	version, err := ifMatch(r)
+	if err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-	body, err := ioutil.ReadAll(r.Body)
+	mediaType, body, err := readBody(r, patch.MergePatchType, "application/json", patch.JSONPatchType)
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Malformed request body: %v", err))
+		problem.Write(w, r, err)
 		return
 	}
-	var book book.Book
-	err = json.Unmarshal(body, &book)
+	notFound := fmt.Sprintf("No book with id: %s", p["id"])
+	current, err := bh.store.GetBook(r.Context(), p.Int("id"))
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Unexpected non-JSON request: %v", err))
+		problem.Write(w, r, storeError(err, notFound, ""))
 		return
 	}
-
-	stmt, err := bh.db.Prepare("UPDATE book SET " +
-		"title=?, author=?, published=?, edition=?, description=?, genre=? WHERE id=?")
-	defer stmt.Close()
+	if version > 0 && version != current.Version {
+		problem.Write(w, r, preconditionFailed())
+		return
+	}
+	doc, err := json.Marshal(current)
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError,
-			fmt.Sprintf("Unable to update database: %v", err))
+		problem.Write(w, r, err)
 		return
 	}
-	_, err = stmt.Exec(book.Title, book.Author, book.Published, book.Edition, book.Description, book.Genre, key)
+	var patched []byte
+	if mediaType == patch.JSONPatchType {
+		patched, err = patch.Apply(doc, body)
+	} else {
+		patched, err = patch.Merge(doc, body)
+	}
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		problem.Write(w, r, patchError(err))
 		return
 	}
-	parser.JSONResponse(w, http.StatusOK, nil)
-}
 
-func (bh *bookHandler) deleteBookByID(w http.ResponseWriter, r *http.Request, key string) {
-	if len(key) == 0 {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Invalid path: %s", r.URL.Path))
+	var book book.Book
+	if err := decodeJSON(patched, &book); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	book.Version = current.Version
+	err = bh.store.UpdateBook(r.Context(), p.Int("id"), book)
+	if err == store.ErrVersionMismatch && version == 0 {
+		problem.Write(w, r, problem.New(http.StatusConflict, problem.CodeConflict,
+			fmt.Sprintf("Book %s was modified while the patch was applied, retry", p["id"])))
+		return
+	}
+	if err != nil {
+		problem.Write(w, r, storeError(err, notFound, ""))
+		return
+	}
+	book, err = bh.store.GetBook(r.Context(), p.Int("id"))
+	if err != nil {
+		problem.Write(w, r, storeError(err, notFound, ""))
 		return
 	}
-	stmt, err := bh.db.Prepare("DELETE from book WHERE id=?")
-	defer stmt.Close()
+	w.Header().Set("ETag", etag(book.Version))
+	parser.JSONResponse(w, http.StatusOK, book)
+}
+
+func (bh *bookHandler) deleteBookByID(w http.ResponseWriter, r *http.Request, p router.Params) {
+	version, err := ifMatch(r)
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError,
-			fmt.Sprintf("Unable to update database: %v", err))
+		problem.Write(w, r, err)
 		return
 	}
-	_, err = stmt.Exec(key)
+	err = bh.store.DeleteBook(r.Context(), p.Int("id"), version)
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		problem.Write(w, r, storeError(err, fmt.Sprintf("No book with id: %s", p["id"]), ""))
 		return
 	}
 	parser.JSONResponse(w, http.StatusOK, nil)
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+func TestPatchBook(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		path        string
+		contentType string
+		body        string
+		status      int
+		edition     int
+		description string
+	}{
+		{
+			desc:        "merge patch",
+			contentType: "application/merge-patch+json",
+			body:        `{"edition": 2}`,
+			status:      http.StatusOK,
+			edition:     2,
+			description: "Spice",
+		},
+		{
+			desc:        "merge patch clearing a field",
+			body:        `{"description": null}`,
+			status:      http.StatusOK,
+			edition:     1,
+			description: "",
+		},
+		{
+			desc:        "json patch",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/edition", "value": 1}, {"op": "replace", "path": "/edition", "value": 3}]`,
+			status:      http.StatusOK,
+			edition:     3,
+			description: "Spice",
+		},
+		{
+			desc:        "failed test",
+			contentType: "application/json-patch+json",
+			body:        `[{"op": "test", "path": "/edition", "value": 2}, {"op": "replace", "path": "/edition", "value": 3}]`,
+			status:      http.StatusConflict,
+		},
+		{
+			desc:        "malformed json patch",
+			contentType: "application/json-patch+json",
+			body:        `{"op": "replace"}`,
+			status:      http.StatusBadRequest,
+		},
+		{
+			desc:   "invalid result",
+			body:   `{"edition": 0, "isbn": "123"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			desc:        "unsupported media type",
+			contentType: "text/plain",
+			body:        `{"edition": 2}`,
+			status:      http.StatusUnsupportedMediaType,
+		},
+		{
+			desc:   "unknown book",
+			path:   "/books/2",
+			body:   `{"edition": 2}`,
+			status: http.StatusNotFound,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			s := store.NewMemoryStore()
+			id, _ := s.AddBook(context.Background(), book.Book{Title: "Dune", Author: "Frank Herbert", Published: "1965-08-01",
+				Edition: 1, Description: "Spice"})
+			rt := router.New()
+			NewBookHandler(s).Register(rt)
+
+			path := tc.path
+			if len(path) == 0 {
+				path = fmt.Sprintf("/books/%d", id)
+			}
+			r := httptest.NewRequest("PATCH", path, strings.NewReader(tc.body))
+			if len(tc.contentType) > 0 {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			asAdmin(rt).ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got [%d]: %s", tc.status, w.Code, w.Body)
+			}
+
+			b, _ := s.GetBook(context.Background(), id)
+			if tc.status != http.StatusOK {
+				if b.Edition != 1 {
+					t.Fatalf("expected the book to be unchanged, got [%v]", b)
+				}
+				return
+			}
+			if b.Title != "Dune" || b.Edition != tc.edition || b.Description != tc.description {
+				t.Fatalf("expected edition %d and description %q, got [%v]", tc.edition, tc.description, b)
+			}
+		})
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	s := store.NewMemoryStore()
+	s.AddBook(context.Background(), book.Book{Title: "Dune", Author: "Frank Herbert", Published: "1965-08-01", Edition: 1})
+	rt := router.New()
+	NewBookHandler(s).Register(rt)
+
+	// the steps run in order against the same book
+	testCases := []struct {
+		desc   string
+		method string
+		header string
+		value  string
+		body   string
+		status int
+		etag   string
+	}{
+		{desc: "get", method: "GET", status: http.StatusOK, etag: `"1"`},
+		{desc: "get unchanged", method: "GET", header: "If-None-Match", value: `W/"1"`, status: http.StatusNotModified, etag: `"1"`},
+		{desc: "get any", method: "GET", header: "If-None-Match", value: "*", status: http.StatusNotModified, etag: `"1"`},
+		{desc: "get changed", method: "GET", header: "If-None-Match", value: `"0", "2"`, status: http.StatusOK, etag: `"1"`},
+		{desc: "put stale", method: "PUT", header: "If-Match", value: `"2"`,
+			body: `{"title": "Dune", "published": "1965-08-01", "edition": 2}`, status: http.StatusPreconditionFailed},
+		{desc: "put weak", method: "PUT", header: "If-Match", value: `W/"1"`,
+			body: `{"title": "Dune", "published": "1965-08-01", "edition": 2}`, status: http.StatusPreconditionFailed},
+		{desc: "put current", method: "PUT", header: "If-Match", value: `"1"`,
+			body: `{"title": "Dune", "published": "1965-08-01", "edition": 2}`, status: http.StatusOK, etag: `"2"`},
+		{desc: "patch stale", method: "PATCH", header: "If-Match", value: `"1"`,
+			body: `{"edition": 3}`, status: http.StatusPreconditionFailed},
+		{desc: "patch current", method: "PATCH", header: "If-Match", value: `"2"`,
+			body: `{"edition": 3}`, status: http.StatusOK, etag: `"3"`},
+		{desc: "patch unconditional", method: "PATCH", body: `{"edition": 4}`, status: http.StatusOK, etag: `"4"`},
+		{desc: "delete stale", method: "DELETE", header: "If-Match", value: `"3"`, status: http.StatusPreconditionFailed},
+		{desc: "delete current", method: "DELETE", header: "If-Match", value: `"4"`, status: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, "/books/1", strings.NewReader(tc.body))
+			if len(tc.header) > 0 {
+				r.Header.Set(tc.header, tc.value)
+			}
+			w := httptest.NewRecorder()
+			asAdmin(rt).ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got [%d]: %s", tc.status, w.Code, w.Body)
+			}
+			if etag := w.Header().Get("ETag"); etag != tc.etag {
+				t.Fatalf("expected ETag %s, got [%s]", tc.etag, etag)
+			}
+		})
+	}
+}
+
+// TestConcurrentRequests is meant to be run with -race, the handlers share
+// nothing but the store.
+func TestConcurrentRequests(t *testing.T) {
+	s := store.NewMemoryStore()
+	rt := router.New()
+	NewBookHandler(s).Register(rt)
+
+	const workers = 16
+	var wg sync.WaitGroup
+	statuses := make(chan int, 2*workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"title": "Book %d", "published": "2000-01-01", "edition": 1}`, i)
+			w := httptest.NewRecorder()
+			asAdmin(rt).ServeHTTP(w, httptest.NewRequest("POST", "/books", strings.NewReader(body)))
+			statuses <- w.Code
+		}(i)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			asAdmin(rt).ServeHTTP(w, httptest.NewRequest("GET", "/books?sort=-id", nil))
+			statuses <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	for status := range statuses {
+		if status != http.StatusOK && status != http.StatusCreated {
+			t.Fatalf("expected every request to succeed, got [%d]", status)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	asAdmin(rt).ServeHTTP(w, httptest.NewRequest("GET", "/books", nil))
+	var out struct {
+		Data []book.Book `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &out)
+	ids := map[int]bool{}
+	for _, b := range out.Data {
+		ids[b.Id] = true
+	}
+	if len(ids) != workers {
+		t.Fatalf("expected %d books with distinct ids, got [%v]", workers, out.Data)
+	}
+}
@@ -1,255 +1,184 @@
 package handler
 
 import (
-	"database/sql"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"net/http"
-	"net/url"
-	"strconv"
-	"sync"
 
-	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/auth"
 	"github.com/masnax/canonical-bookmanager/collection"
-	"github.com/masnax/canonical-bookmanager/filter"
 	"github.com/masnax/canonical-bookmanager/parser"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"github.com/masnax/canonical-bookmanager/query"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
 )
 
 type collectionHandler struct {
-	sync.Mutex
-	db *sql.DB
+	store store.CollectionStore
 }
 
-func NewCollectionHandler(db *sql.DB) *collectionHandler {
-	ch := &collectionHandler{
-		db: db,
-	}
-	http.Handle("/collections/book", ch)
-	http.Handle("/collections/collection", ch)
-	http.Handle("/collections/manage", ch)
-	http.Handle("/collections/book/", ch)
-	http.Handle("/collections/collection/", ch)
-	http.Handle("/collections/manage/", ch)
-	return ch
-}
-
-func (ch *collectionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	defer ch.Unlock()
-	ch.Lock()
-
-	keys := parser.URLParser(r.URL)
-	if err := ch.validateUrl(keys, r.URL); err != nil {
-		parser.ErrorResponse(w, http.StatusBadRequest, err.Error())
-		return
-	}
-	lastKey := keys[len(keys)-1]
-	formKey := keys[len(keys)-2]
-	switch r.Method {
-	case "PUT":
-		ch.updateCollectionNameForID(w, r, lastKey, formKey)
-	case "DELETE":
-		ch.deleteCollectionWithID(w, r, lastKey, formKey)
-	case "GET":
-		ch.getCollectionInfo(w, r, lastKey, formKey)
-	case "POST":
-		ch.addNewCollection(w, r)
-	default:
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Invalid method: '%s' for path: '%s'", r.Method, r.URL.Path))
+func NewCollectionHandler(s store.CollectionStore) *collectionHandler {
+	return &collectionHandler{
+		store: s,
 	}
 }
 
-func (ch *collectionHandler) validateUrl(keys []string, url *url.URL) error {
-	if len(keys) != 4 {
-		return errors.New(fmt.Sprintf("Invalid path: '%s'", url.Path))
-	}
-	lastKey := keys[len(keys)-1]
-	formKey := keys[len(keys)-2]
-	if formKey == "manage" || formKey == "book" {
-		if len(lastKey) > 0 {
-			if _, err := strconv.Atoi(lastKey); err != nil {
-				return errors.New(fmt.Sprintf("Invalid key: %s from path: %s", lastKey, url.Path))
-			}
-		}
-	} else if formKey == "collection" {
-		if len(lastKey) == 0 {
-			return errors.New(fmt.Sprintf("Invalid key: %s from path: %s", lastKey, url.Path))
-		}
-	}
-	return nil
+func (ch *collectionHandler) Register(rt *router.Router) {
+	rt.Handle("GET", "/collections", Require(auth.RoleReader, ch.getCollectionNameAndSize))
+	rt.Handle("POST", "/collections", Require(auth.RoleEditor, ch.addNewCollection))
+	rt.Handle("GET", "/collections/{id:int}", Require(auth.RoleReader, ch.getCollectionWithID))
+	rt.Handle("PUT", "/collections/{id:int}", Require(auth.RoleEditor, ch.updateCollectionNameForID))
+	rt.Handle("DELETE", "/collections/{id:int}", Require(auth.RoleEditor, ch.deleteCollectionWithID))
+	rt.Handle("GET", "/collections/{id:int}/books", Require(auth.RoleReader, ch.getBooksForCollection))
+	rt.Handle("PUT", "/collections/{id:int}/books/{bookId:int}", Require(auth.RoleEditor, ch.addBookToCollection))
+	rt.Handle("DELETE", "/collections/{id:int}/books/{bookId:int}", Require(auth.RoleEditor, ch.deleteBookFromCollection))
+	rt.Handle("GET", "/books/{id:int}/collections", Require(auth.RoleReader, ch.getCollectionsForBookID))
 }
 
-func (ch *collectionHandler) updateCollectionNameForID(w http.ResponseWriter, r *http.Request, lastKey string, formKey string) {
-	if len(lastKey) == 0 || formKey != "manage" {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Invalid path: %s", r.URL.Path))
+// getCollectionNameAndSize lists collections with the number of books in
+// each, narrowed down to a single collection by ?name=.
+func (ch *collectionHandler) getCollectionNameAndSize(w http.ResponseWriter, r *http.Request, p router.Params) {
+	page, err := query.ParsePage(r)
+	if err != nil {
+		problem.Write(w, r, paramError(err))
 		return
 	}
-	body, err := ioutil.ReadAll(r.Body)
+	sort, err := query.ParseSort(r.FormValue("sort"), query.Fields(collection.BookCollection{}))
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Malformed request body: %v", err))
+		problem.Write(w, r, paramError(err))
 		return
 	}
-	var collection collection.Collection
-	err = json.Unmarshal(body, &collection)
+	opts := store.ListOptions{Name: r.FormValue("name"), Sort: sort, Limit: page.Limit, Offset: page.Offset}
+	bookCollections, total, err := ch.store.ListCollections(r.Context(), opts)
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Unexpected non-JSON request: %v", err))
+		problem.Write(w, r, err)
 		return
 	}
+	parser.PagedResponse(w, http.StatusOK, bookCollections, total, page.NextToken(total))
+}
 
-	stmt, err := ch.db.Prepare("UPDATE collection SET collection.collection=? WHERE collection.id=?")
-	defer stmt.Close()
+func (ch *collectionHandler) addNewCollection(w http.ResponseWriter, r *http.Request, p router.Params) {
+	var collection collection.Collection
+	if err := decodeBody(r, &collection); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	id, err := ch.store.AddCollection(r.Context(), collection)
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError,
-			fmt.Sprintf("Unable to update database: %v", err))
+		problem.Write(w, r, storeError(err, "",
+			fmt.Sprintf("Collection %s already exists", collection.Collection)))
 		return
 	}
-	_, err = stmt.Exec(collection.Collection, lastKey)
+	collection, err = ch.store.GetCollection(r.Context(), id)
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		problem.Write(w, r, storeError(err, fmt.Sprintf("No collection with id: %d", id), ""))
 		return
 	}
-	parser.JSONResponse(w, http.StatusOK, nil)
+	w.Header().Set("Location", fmt.Sprintf("/collections/%d", id))
+	w.Header().Set("ETag", etag(collection.Version))
+	parser.JSONResponse(w, http.StatusCreated, collection)
 }
 
-func (ch *collectionHandler) deleteCollectionWithID(w http.ResponseWriter, r *http.Request, lastKey string, formKey string) {
-	if len(lastKey) == 0 || formKey != "manage" {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Invalid path: %s", r.URL.Path))
-		return
-	}
-	stmt, err := ch.db.Prepare("DELETE from collection WHERE id=?")
-	defer stmt.Close()
+func (ch *collectionHandler) getCollectionWithID(w http.ResponseWriter, r *http.Request, p router.Params) {
+	collection, err := ch.store.GetCollection(r.Context(), p.Int("id"))
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError,
-			fmt.Sprintf("Unable to update database: %v", err))
+		problem.Write(w, r, storeError(err, fmt.Sprintf("No collection with id: %s", p["id"]), ""))
 		return
 	}
-	_, err = stmt.Exec(lastKey)
-	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+	w.Header().Set("ETag", etag(collection.Version))
+	if notModified(r, collection.Version) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
-	parser.JSONResponse(w, http.StatusOK, nil)
+	parser.JSONResponse(w, http.StatusOK, collection)
 }
 
-func (ch *collectionHandler) getBooksForCollectionName(w http.ResponseWriter, r *http.Request, lastKey string) {
-	q := `SELECT book.* from book 
-	JOIN (book_collection as bc, collection) ON 
-	bc.book_id = book.id 
-	AND 
-	collection.id = bc.collection_id 
-	WHERE 
-	collection.collection = "` + lastKey + `"`
-
-	rows, err := ch.db.Query(q)
-	defer rows.Close()
-	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError,
-			fmt.Sprintf("Unable to query database due to error: %v", err))
-		return
-	}
-	books := []book.Book{}
-	for rows.Next() {
-		var book book.Book
-		err := rows.Scan(&book.Id, &book.Title,
-			&book.Author, &book.Published, &book.Edition, &book.Description, &book.Genre)
-		if err != nil {
-			parser.ErrorResponse(w, http.StatusInternalServerError,
-				fmt.Sprintf("Unable to scan results: %v", err))
-			return
-		}
-		form := r.FormValue("filter")
-		if len(form) > 0 {
-			keep, err := filter.FilterBooks(form, book)
-			if err != nil {
-				parser.ErrorResponse(w, http.StatusBadRequest, err.Error())
-				return
-			}
-			if !keep {
-				continue
-			}
-		}
-		books = append(books, book)
-	}
-	parser.JSONResponse(w, http.StatusOK, books)
-}
-
-func (ch *collectionHandler) getCollectionsForBookID(w http.ResponseWriter, r *http.Request, lastKey string) {
-	q := `SELECT collection.* from collection 
-	JOIN (book_collection as bc, book) ON 
-	bc.book_id = book.id 
-	AND 
-	collection.id = bc.collection_id 
-	WHERE 
-	book.id = ` + lastKey
-
-	rows, err := ch.db.Query(q)
-	defer rows.Close()
-	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError,
-			fmt.Sprintf("Unable to query database due to error: %v", err))
-		return
-	}
-	collections := []collection.Collection{}
-	for rows.Next() {
-		var collection collection.Collection
-		err := rows.Scan(&collection.ID, &collection.Collection)
-		if err != nil {
-			parser.ErrorResponse(w, http.StatusInternalServerError,
-				fmt.Sprintf("Unable to scan results: %v", err))
-			return
-		}
-		collections = append(collections, collection)
+func (ch *collectionHandler) updateCollectionNameForID(w http.ResponseWriter, r *http.Request, p router.Params) {
+	version, err := ifMatch(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	var collection collection.Collection
+	if err := decodeBody(r, &collection); err != nil {
+		problem.Write(w, r, err)
+		return
 	}
-	parser.JSONResponse(w, http.StatusOK, collections)
 
+	notFound := fmt.Sprintf("No collection with id: %s", p["id"])
+	collection.Version = version
+	err = ch.store.UpdateCollection(r.Context(), p.Int("id"), collection)
+	if err != nil {
+		problem.Write(w, r, storeError(err, notFound,
+			fmt.Sprintf("Collection %s already exists", collection.Collection)))
+		return
+	}
+	collection, err = ch.store.GetCollection(r.Context(), p.Int("id"))
+	if err != nil {
+		problem.Write(w, r, storeError(err, notFound, ""))
+		return
+	}
+	w.Header().Set("ETag", etag(collection.Version))
+	parser.JSONResponse(w, http.StatusOK, collection)
 }
 
-func (ch *collectionHandler) getCollectionInfo(w http.ResponseWriter, r *http.Request, lastKey string, formKey string) {
-	if formKey != "book" && formKey != "collection" && len(lastKey) == 0 {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Invalid keys: %s, %s from path: %s", lastKey, formKey, r.URL.Path))
+func (ch *collectionHandler) deleteCollectionWithID(w http.ResponseWriter, r *http.Request, p router.Params) {
+	version, err := ifMatch(r)
+	if err != nil {
+		problem.Write(w, r, err)
 		return
 	}
-
-	if formKey == "collection" {
-		ch.getBooksForCollectionName(w, r, lastKey)
-	} else {
-		ch.getCollectionsForBookID(w, r, lastKey)
+	err = ch.store.DeleteCollection(r.Context(), p.Int("id"), version)
+	if err != nil {
+		problem.Write(w, r, storeError(err, fmt.Sprintf("No collection with id: %s", p["id"]), ""))
+		return
 	}
+	parser.JSONResponse(w, http.StatusOK, nil)
 }
 
-func (ch *collectionHandler) addNewCollection(w http.ResponseWriter, r *http.Request) {
-	body, err := ioutil.ReadAll(r.Body)
+func (ch *collectionHandler) getBooksForCollection(w http.ResponseWriter, r *http.Request, p router.Params) {
+	opts, page, err := listOptions(r)
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Malformed request body: %v", err))
+		problem.Write(w, r, err)
 		return
 	}
-	var collection collection.Collection
-	err = json.Unmarshal(body, &collection)
+	books, total, err := ch.store.ListBooksForCollection(r.Context(), p.Int("id"), opts)
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusBadRequest,
-			fmt.Sprintf("Unexpected non-JSON request: %v", err))
+		problem.Write(w, r, storeError(err, fmt.Sprintf("No collection with id: %s", p["id"]), ""))
 		return
 	}
+	parser.PagedResponse(w, http.StatusOK, books, total, page.NextToken(total))
+}
 
-	stmt, err := ch.db.Prepare("INSERT INTO collection (collection) VALUES (?)")
-	defer stmt.Close()
+func (ch *collectionHandler) addBookToCollection(w http.ResponseWriter, r *http.Request, p router.Params) {
+	err := ch.store.AddBookToCollection(r.Context(), p.Int("bookId"), p.Int("id"))
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError,
-			fmt.Sprintf("Unable to update database: %v", err))
+		problem.Write(w, r, storeError(err,
+			fmt.Sprintf("No book with id: %s or collection with id: %s", p["bookId"], p["id"]),
+			fmt.Sprintf("Book %s is already in collection %s", p["bookId"], p["id"])))
 		return
 	}
-	_, err = stmt.Exec(collection.Collection)
+	w.Header().Set("Location", r.URL.Path)
+	parser.JSONResponse(w, http.StatusCreated,
+		collection.BookCollectionData{BookID: p.Int("bookId"), CollectionID: p.Int("id")})
+}
+
+func (ch *collectionHandler) deleteBookFromCollection(w http.ResponseWriter, r *http.Request, p router.Params) {
+	err := ch.store.RemoveBookFromCollection(r.Context(), p.Int("bookId"), p.Int("id"))
 	if err != nil {
-		parser.ErrorResponse(w, http.StatusInternalServerError, err.Error())
+		problem.Write(w, r, storeError(err,
+			fmt.Sprintf("Book %s is not in collection %s", p["bookId"], p["id"]), ""))
 		return
 	}
 	parser.JSONResponse(w, http.StatusOK, nil)
 }
+
+func (ch *collectionHandler) getCollectionsForBookID(w http.ResponseWriter, r *http.Request, p router.Params) {
+	collections, err := ch.store.ListCollectionsForBook(r.Context(), p.Int("id"))
+	if err != nil {
+		problem.Write(w, r, storeError(err, fmt.Sprintf("No book with id: %s", p["id"]), ""))
+		return
+	}
+	parser.JSONResponse(w, http.StatusOK, collections)
+}
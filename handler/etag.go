@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/masnax/canonical-bookmanager/problem"
+)
+
+// etag is the entity tag of a version of a record.
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatch returns the version named by the If-Match header, which writes are
+// made conditional on, or 0 if there is none or it is "*". Only a single,
+// strong ETag can match, anything else is answered with 412.
+func ifMatch(r *http.Request) (int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if len(header) == 0 || header == "*" {
+		return 0, nil
+	}
+	if len(header) < 3 || !strings.HasPrefix(header, `"`) || !strings.HasSuffix(header, `"`) {
+		return 0, preconditionFailed()
+	}
+	version, err := strconv.Atoi(header[1 : len(header)-1])
+	if err != nil || version <= 0 {
+		return 0, preconditionFailed()
+	}
+	return version, nil
+}
+
+// notModified reports whether the If-None-Match header names the version, so
+// that a GET can be answered with 304. Weak ETags match as well.
+func notModified(r *http.Request, version int) bool {
+	header := strings.TrimSpace(r.Header.Get("If-None-Match"))
+	if header == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+func preconditionFailed() error {
+	return problem.New(http.StatusPreconditionFailed, problem.CodePreconditionFailed,
+		"The resource has been modified since the If-Match ETag was issued, fetch it again and retry")
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/logging"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+	"gopkg.in/yaml.v2"
+)
+
+// YAMLType is the media type of a YAML export.
+const YAMLType = "application/yaml"
+
+// exportPageSize is the number of books fetched from the store at a time.
+const exportPageSize = 500
+
+// exportColumns are the columns of a CSV export, which an import accepts as
+// they are.
+var exportColumns = []string{"id", "title", "author", "published", "edition", "description", "genre"}
+
+// exportFormat is the media type of an export and the extension of the file
+// it is saved as.
+type exportFormat struct {
+	mediaType string
+	extension string
+}
+
+var exportFormats = map[string]exportFormat{
+	"jsonl": {mediaType: NDJSONType, extension: "jsonl"},
+	"csv":   {mediaType: CSVType, extension: "csv"},
+	"yaml":  {mediaType: YAMLType, extension: "yaml"},
+}
+
+type exportHandler struct {
+	store store.BookStore
+}
+
+func NewExportHandler(s store.BookStore) *exportHandler {
+	return &exportHandler{
+		store: s,
+	}
+}
+
+func (eh *exportHandler) Register(rt *router.Router) {
+	rt.Handle("GET", "/books/export", Require(auth.RoleReader, eh.exportBooks))
+}
+
+// exportWriter writes books in the format of an export.
+type exportWriter interface {
+	write(books []book.Book) error
+	close() error
+}
+
+// exportBooks streams every book matching the filter, in the sort order, as
+// JSON Lines, CSV or YAML. The books are read from the store a page at a
+// time, so an export is not a snapshot of the store. Failures after the
+// first page can no longer change the status of the response, they are logged
+// and the response is aborted, so that the client sees it end unexpectedly
+// rather than a complete but shorter export.
+func (eh *exportHandler) exportBooks(w http.ResponseWriter, r *http.Request, p router.Params) {
+	format := r.FormValue("format")
+	if len(format) == 0 {
+		format = "jsonl"
+	}
+	f, ok := exportFormats[format]
+	if !ok {
+		problem.Write(w, r, problem.Field(problem.CodeInvalidParam, "format",
+			fmt.Sprintf("expected csv, jsonl or yaml, got '%s'", format)))
+		return
+	}
+	opts, err := bookQuery(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+
+	var out exportWriter
+	opts.Limit = exportPageSize
+	for {
+		books, total, err := eh.store.ListBooks(r.Context(), opts)
+		if err != nil && out == nil {
+			problem.Write(w, r, storeError(err, "", ""))
+			return
+		}
+		if err != nil {
+			abortExport(r, err)
+		}
+		if out == nil {
+			w.Header().Set("Content-Type", f.mediaType)
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="books.%s"`, f.extension))
+			w.WriteHeader(http.StatusOK)
+			out = newExportWriter(format, w)
+		}
+		if err := out.write(books); err != nil {
+			abortExport(r, err)
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		opts.Offset += len(books)
+		if len(books) == 0 || opts.Offset >= total {
+			break
+		}
+	}
+	if err := out.close(); err != nil {
+		abortExport(r, err)
+	}
+}
+
+// abortExport logs the failure of an export whose response has started and
+// aborts the response, the server then closes the connection without ending
+// the body.
+func abortExport(r *http.Request, err error) {
+	logging.FromContext(r.Context()).Error("export failed", "path", r.URL.Path, "error", err)
+	panic(http.ErrAbortHandler)
+}
+
+func newExportWriter(format string, w io.Writer) exportWriter {
+	switch format {
+	case "csv":
+		c := &csvExport{w: csv.NewWriter(w)}
+		c.w.Write(exportColumns)
+		return c
+	case "yaml":
+		return &yamlExport{w: w}
+	default:
+		return &jsonlExport{e: json.NewEncoder(w)}
+	}
+}
+
+type jsonlExport struct {
+	e *json.Encoder
+}
+
+func (j *jsonlExport) write(books []book.Book) error {
+	for _, b := range books {
+		if err := j.e.Encode(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *jsonlExport) close() error {
+	return nil
+}
+
+type csvExport struct {
+	w *csv.Writer
+}
+
+func (c *csvExport) write(books []book.Book) error {
+	for _, b := range books {
+		c.w.Write([]string{strconv.Itoa(b.Id), b.Title, b.Author, b.Published, strconv.Itoa(b.Edition),
+			b.Description, b.Genre})
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvExport) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// yamlExport writes a sequence of books, a page at a time, with their fields
+// in the order of the JSON ones.
+type yamlExport struct {
+	w       io.Writer
+	written bool
+}
+
+func (y *yamlExport) write(books []book.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+	items := []yaml.MapSlice{}
+	for _, b := range books {
+		items = append(items, yaml.MapSlice{
+			{Key: "id", Value: b.Id},
+			{Key: "title", Value: b.Title},
+			{Key: "author", Value: b.Author},
+			{Key: "published", Value: b.Published},
+			{Key: "edition", Value: b.Edition},
+			{Key: "description", Value: b.Description},
+			{Key: "genre", Value: b.Genre},
+		})
+	}
+	out, err := yaml.Marshal(items)
+	if err != nil {
+		return err
+	}
+	y.written = true
+	_, err = y.w.Write(out)
+	return err
+}
+
+// close writes an empty sequence if there were no books, so that the export
+// is still a YAML sequence.
+func (y *yamlExport) close() error {
+	if y.written {
+		return nil
+	}
+	_, err := io.WriteString(y.w, "[]\n")
+	return err
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+func TestExportBooks(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		query       string
+		books       int
+		status      int
+		contentType string
+		lines       int
+		first       string
+		last        string
+	}{
+		{desc: "jsonl by default", books: 3, status: http.StatusOK, contentType: NDJSONType, lines: 3,
+			first: `{"id":1,"title":"Book 1",`},
+		{desc: "csv", query: "?format=csv", books: 3, status: http.StatusOK, contentType: CSVType, lines: 4,
+			first: "id,title,author,published,edition,description,genre"},
+		{desc: "yaml", query: "?format=yaml", books: 3, status: http.StatusOK, contentType: YAMLType, lines: 21,
+			first: "- id: 1"},
+		{desc: "empty yaml", query: "?format=yaml", status: http.StatusOK, contentType: YAMLType, lines: 1, first: "[]"},
+		{desc: "empty csv", query: "?format=csv", status: http.StatusOK, contentType: CSVType, lines: 1,
+			first: "id,title,author,published,edition,description,genre"},
+		{desc: "filtered and sorted", query: "?filter=edition+ge+2&sort=-id", books: 3, status: http.StatusOK,
+			contentType: NDJSONType, lines: 2, first: `{"id":3,`},
+		{desc: "more than a page", query: "?format=csv", books: exportPageSize*2 + 1, status: http.StatusOK,
+			contentType: CSVType, lines: exportPageSize*2 + 2, first: "id,title",
+			last: fmt.Sprintf("%d,Book %d,,2000-01-01,%d,,\n", exportPageSize*2+1, exportPageSize*2+1, exportPageSize*2+1)},
+		{desc: "limit and offset are ignored", query: "?limit=1&offset=1", books: 3, status: http.StatusOK,
+			contentType: NDJSONType, lines: 3},
+		{desc: "invalid format", query: "?format=xml", status: http.StatusBadRequest},
+		{desc: "invalid filter", query: "?filter=edition", status: http.StatusBadRequest},
+		{desc: "invalid sort", query: "?sort=isbn", status: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			s := store.NewMemoryStore()
+			for i := 1; i <= tc.books; i++ {
+				s.AddBook(context.Background(), book.Book{Title: fmt.Sprintf("Book %d", i), Published: "2000-01-01", Edition: i})
+			}
+			rt := router.New()
+			NewExportHandler(s).Register(rt)
+
+			w := httptest.NewRecorder()
+			asAdmin(rt).ServeHTTP(w, httptest.NewRequest("GET", "/books/export"+tc.query, nil))
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got [%d]: %s", tc.status, w.Code, w.Body)
+			}
+			if tc.status != http.StatusOK {
+				return
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != tc.contentType {
+				t.Fatalf("expected content type %s, got [%s]", tc.contentType, contentType)
+			}
+			if lines := strings.Count(w.Body.String(), "\n"); lines != tc.lines {
+				t.Fatalf("expected %d lines, got [%d]: %s", tc.lines, lines, w.Body)
+			}
+			if !strings.HasPrefix(w.Body.String(), tc.first) {
+				t.Fatalf("expected the export to start with %s, got [%s]", tc.first, w.Body)
+			}
+			if !strings.HasSuffix(w.Body.String(), tc.last) {
+				t.Fatalf("expected the export to end with %s, got [%s]", tc.last, w.Body)
+			}
+		})
+	}
+}
+
+// failingStore fails to list books from the given offset on.
+type failingStore struct {
+	store.BookStore
+	offset int
+}
+
+func (s failingStore) ListBooks(ctx context.Context, opts store.ListOptions) ([]book.Book, int, error) {
+	if opts.Offset >= s.offset {
+		return nil, 0, errors.New("connection lost")
+	}
+	return s.BookStore.ListBooks(ctx, opts)
+}
+
+func TestExportBooksCutShort(t *testing.T) {
+	s := store.NewMemoryStore()
+	for i := 1; i <= exportPageSize+1; i++ {
+		s.AddBook(context.Background(), book.Book{Title: fmt.Sprintf("Book %d", i), Published: "2000-01-01", Edition: 1})
+	}
+	testCases := []struct {
+		desc   string
+		offset int
+		status int
+	}{
+		{desc: "first page", offset: 0, status: http.StatusInternalServerError},
+		{desc: "second page", offset: exportPageSize, status: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			rt := router.New()
+			NewExportHandler(failingStore{BookStore: s, offset: tc.offset}).Register(rt)
+			server := httptest.NewServer(asAdmin(rt))
+			defer server.Close()
+
+			res, err := http.Get(server.URL + "/books/export")
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != tc.status {
+				t.Fatalf("expected status %d, got [%d]", tc.status, res.StatusCode)
+			}
+			// a failure after the first page aborts the response rather than
+			// ending it early
+			body, err := ioutil.ReadAll(res.Body)
+			if tc.status == http.StatusOK && err != io.ErrUnexpectedEOF {
+				t.Fatalf("expected [%v] after %d bytes, got [%v]", io.ErrUnexpectedEOF, len(body), err)
+			}
+		})
+	}
+}
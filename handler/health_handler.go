@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/masnax/canonical-bookmanager/logging"
+	"github.com/masnax/canonical-bookmanager/parser"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+type healthHandler struct {
+	store    store.Store
+	draining int32
+}
+
+func NewHealthHandler(s store.Store) *healthHandler {
+	return &healthHandler{
+		store: s,
+	}
+}
+
+func (hh *healthHandler) Register(rt *router.Router) {
+	rt.Handle("GET", "/healthz", hh.live)
+	rt.Handle("GET", "/readyz", hh.ready)
+}
+
+// Drain makes /readyz fail from now on, so that no new requests are sent to
+// the server while it finishes the ones in flight.
+func (hh *healthHandler) Drain() {
+	atomic.StoreInt32(&hh.draining, 1)
+}
+
+// live answers as long as the server is able to serve requests at all.
+func (hh *healthHandler) live(w http.ResponseWriter, r *http.Request, p router.Params) {
+	parser.JSONResponse(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ready answers once the store can be reached and until the server drains.
+func (hh *healthHandler) ready(w http.ResponseWriter, r *http.Request, p router.Params) {
+	if atomic.LoadInt32(&hh.draining) == 1 {
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, problem.CodeUnavailable,
+			"The server is shutting down"))
+		return
+	}
+	if err := hh.store.Ping(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Warn("readiness check failed", "error", err)
+		problem.Write(w, r, problem.New(http.StatusServiceUnavailable, problem.CodeUnavailable,
+			"The database is unreachable"))
+		return
+	}
+	parser.JSONResponse(w, http.StatusOK, map[string]string{"status": "ok"})
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/config"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+func TestHealth(t *testing.T) {
+	closed, err := store.Open(config.Database{Driver: "sqlite3", DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("expected no error opening sqlite store, got [%v]", err)
+	}
+	closed.Close()
+
+	testCases := []struct {
+		desc   string
+		store  store.Store
+		drain  bool
+		path   string
+		status int
+	}{
+		{desc: "live", store: store.NewMemoryStore(), path: "/healthz", status: http.StatusOK},
+		{desc: "ready", store: store.NewMemoryStore(), path: "/readyz", status: http.StatusOK},
+		{desc: "live while draining", store: store.NewMemoryStore(), drain: true, path: "/healthz", status: http.StatusOK},
+		{desc: "draining", store: store.NewMemoryStore(), drain: true, path: "/readyz", status: http.StatusServiceUnavailable},
+		{desc: "live without database", store: closed, path: "/healthz", status: http.StatusOK},
+		{desc: "database unreachable", store: closed, path: "/readyz", status: http.StatusServiceUnavailable},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			rt := router.New()
+			health := NewHealthHandler(tc.store)
+			health.Register(rt)
+			if tc.drain {
+				health.Drain()
+			}
+			w := serve(rt, "GET", tc.path, "")
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got [%d]: %s", tc.status, w.Code, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/parser"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+// Media types accepted by an import, one JSON book per line or a CSV file
+// whose header names the JSON fields of a book.
+const (
+	NDJSONType = "application/x-ndjson"
+	CSVType    = "text/csv"
+)
+
+type importHandler struct {
+	store store.ImportStore
+}
+
+func NewImportHandler(s store.ImportStore) *importHandler {
+	return &importHandler{
+		store: s,
+	}
+}
+
+func (ih *importHandler) Register(rt *router.Router) {
+	rt.Handle("POST", "/books:import", Require(auth.RoleEditor, ih.importBooks))
+}
+
+// importOptions are the query parameters of an import.
+type importOptions struct {
+	mode       string
+	dryRun     bool
+	collection int
+}
+
+func parseImportOptions(r *http.Request) (importOptions, error) {
+	opts := importOptions{mode: book.ImportTransactional}
+	if mode := r.FormValue("mode"); len(mode) > 0 {
+		if mode != book.ImportTransactional && mode != book.ImportBestEffort {
+			return opts, problem.Field(problem.CodeInvalidParam, "mode",
+				fmt.Sprintf("expected %s or %s, got '%s'", book.ImportTransactional, book.ImportBestEffort, mode))
+		}
+		opts.mode = mode
+	}
+	if dryRun := r.FormValue("dry_run"); len(dryRun) > 0 {
+		var err error
+		if opts.dryRun, err = strconv.ParseBool(dryRun); err != nil {
+			return opts, problem.Field(problem.CodeInvalidParam, "dry_run",
+				fmt.Sprintf("expected true or false, got '%s'", dryRun))
+		}
+	}
+	if collection := r.FormValue("collection"); len(collection) > 0 {
+		id, err := strconv.Atoi(collection)
+		if err != nil || id <= 0 {
+			return opts, problem.Field(problem.CodeInvalidParam, "collection",
+				fmt.Sprintf("expected the id of a collection, got '%s'", collection))
+		}
+		opts.collection = id
+	}
+	return opts, nil
+}
+
+// importBooks reads the books of the request body as a stream and adds the
+// valid ones, along with their membership of the requested collection. A
+// transactional import with invalid rows adds nothing and is rejected with
+// 422, a best-effort import adds the valid rows and reports the others. A dry
+// run only validates the rows.
+func (ih *importHandler) importBooks(w http.ResponseWriter, r *http.Request, p router.Params) {
+	opts, err := parseImportOptions(r)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	mediaType, err := bodyType(r, NDJSONType, CSVType)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	var rows rowReader = &ndjsonRows{r: bufio.NewReader(r.Body)}
+	if mediaType == CSVType {
+		if rows, err = newCSVRows(r.Body); err != nil {
+			problem.Write(w, r, err)
+			return
+		}
+	}
+
+	notFound := fmt.Sprintf("No collection with id: %d", opts.collection)
+	imp, err := ih.store.BeginImport(r.Context(), opts.collection)
+	if err != nil {
+		problem.Write(w, r, storeError(err, notFound, ""))
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			imp.Rollback()
+		}
+	}()
+
+	report := book.ImportReport{Mode: opts.mode, DryRun: opts.dryRun, Collection: opts.collection,
+		IDs: []int{}, Errors: []book.ImportError{}}
+	for {
+		row, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		report.Rows++
+		if msg, ok := err.(rowError); ok {
+			report.Fail(book.ImportError{Row: report.Rows, Message: string(msg)})
+			continue
+		}
+		if err != nil {
+			problem.Write(w, r, bodyError(err))
+			return
+		}
+		var b book.Book
+		if err := decodeJSON(row, &b); err != nil {
+			report.Fail(importErrors(report.Rows, err)...)
+			continue
+		}
+		if opts.dryRun || (opts.mode == book.ImportTransactional && report.Failed > 0) {
+			continue
+		}
+		id, err := imp.AddBook(r.Context(), b)
+		if err != nil {
+			problem.Write(w, r, storeError(err, notFound, ""))
+			return
+		}
+		report.IDs = append(report.IDs, id)
+	}
+
+	if opts.dryRun {
+		parser.JSONResponse(w, http.StatusOK, report)
+		return
+	}
+	if opts.mode == book.ImportTransactional && report.Failed > 0 {
+		p := problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed,
+			fmt.Sprintf("%d of %d row(s) are invalid, no book was imported", report.Failed, report.Rows))
+		for _, e := range report.Errors {
+			p.Errors = append(p.Errors, problem.FieldError{Field: e.Path(), Message: e.Message})
+		}
+		problem.Write(w, r, p)
+		return
+	}
+	if err := imp.Commit(); err != nil {
+		problem.Write(w, r, storeError(err, notFound, ""))
+		return
+	}
+	committed = true
+	report.Imported = len(report.IDs)
+	parser.JSONResponse(w, http.StatusOK, report)
+}
+
+// rowError rejects a row that could not be read, reading goes on with the
+// next row.
+type rowError string
+
+func (e rowError) Error() string {
+	return string(e)
+}
+
+// rowReader yields the rows of an import as JSON objects, and io.EOF once
+// they have all been read.
+type rowReader interface {
+	next() ([]byte, error)
+}
+
+// ndjsonRows reads one JSON object per line, blank lines are skipped.
+type ndjsonRows struct {
+	r *bufio.Reader
+}
+
+func (n *ndjsonRows) next() ([]byte, error) {
+	for {
+		line, err := n.r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// csvRows reads CSV records, which are turned into JSON objects keyed by the
+// columns of the header. Empty cells are left out, and cells of integer
+// fields are sent as numbers when they are ones, so that validation reports
+// them as it would in a JSON body.
+type csvRows struct {
+	r       *csv.Reader
+	header  []string
+	numeric map[string]bool
+}
+
+func newCSVRows(body io.Reader) (*csvRows, error) {
+	c := &csvRows{r: csv.NewReader(body), numeric: map[string]bool{}}
+	c.r.FieldsPerRecord = -1
+	header, err := c.r.Read()
+	if err == io.EOF {
+		return c, nil
+	}
+	if err != nil {
+		return nil, problem.Field(problem.CodeInvalidBody, "header", fmt.Sprintf("unable to read the CSV header: %v", err))
+	}
+	fields := jsonFields(reflect.ValueOf(&book.Book{}).Elem())
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	seen := map[string]bool{}
+	for i, column := range header {
+		if i == 0 {
+			// spreadsheets may start the file with a byte order mark
+			column = strings.TrimPrefix(column, "\ufeff")
+		}
+		column = strings.TrimSpace(column)
+		field, ok := fields[column]
+		if !ok {
+			return nil, problem.Field(problem.CodeInvalidBody, "header",
+				fmt.Sprintf("unknown column '%s', expected any of %s", column, strings.Join(names, ", ")))
+		}
+		if seen[column] {
+			return nil, problem.Field(problem.CodeInvalidBody, "header", fmt.Sprintf("duplicate column '%s'", column))
+		}
+		seen[column] = true
+		c.numeric[column] = field.Kind() == reflect.Int
+		c.header = append(c.header, column)
+	}
+	return c, nil
+}
+
+func (c *csvRows) next() ([]byte, error) {
+	if c.header == nil {
+		return nil, io.EOF
+	}
+	record, err := c.r.Read()
+	if parseErr, ok := err.(*csv.ParseError); ok {
+		return nil, rowError(parseErr.Err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(record) != len(c.header) {
+		return nil, rowError(fmt.Sprintf("expected %d fields, got %d", len(c.header), len(record)))
+	}
+	row := map[string]interface{}{}
+	for i, value := range record {
+		if len(value) == 0 {
+			continue
+		}
+		row[c.header[i]] = value
+		if n, err := strconv.Atoi(value); err == nil && c.numeric[c.header[i]] {
+			row[c.header[i]] = n
+		}
+	}
+	return json.Marshal(row)
+}
+
+// importErrors lists what decodeJSON rejected in a row.
+func importErrors(row int, err error) []book.ImportError {
+	p, ok := err.(*problem.Problem)
+	if !ok || len(p.Errors) == 0 {
+		return []book.ImportError{{Row: row, Message: err.Error()}}
+	}
+	errs := []book.ImportError{}
+	for _, f := range p.Errors {
+		errs = append(errs, book.ImportError{Row: row, Field: f.Field, Message: f.Message})
+	}
+	return errs
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/collection"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+func TestImportBooks(t *testing.T) {
+	const valid = `{"title": "Dune", "author": "Frank Herbert", "published": "1965-08-01", "edition": 1}
+{"id": 9, "title": "Emma", "published": "1815-12-23", "edition": 2}
+`
+	const invalid = `{"title": "Dune", "published": "1965-08-01", "edition": 1}
+{"title": "", "published": "1965", "edition": 1}
+not json
+
+{"title": "Emma", "published": "1815-12-23", "edition": 2, "isbn": "123"}
+{"title": "Ulysses", "published": "1922-02-02", "edition": 1}
+`
+	testCases := []struct {
+		desc        string
+		query       string
+		contentType string
+		body        string
+		status      int
+		imported    int
+		failed      int
+		errors      []string
+		stored      int
+		members     int
+	}{
+		{desc: "ndjson", body: valid, status: http.StatusOK, imported: 2, stored: 2},
+		{desc: "ndjson into a collection", query: "?collection=1", contentType: NDJSONType, body: valid,
+			status: http.StatusOK, imported: 2, stored: 2, members: 2},
+		{desc: "transactional with invalid rows", body: invalid, status: http.StatusUnprocessableEntity,
+			errors: []string{"rows[2].title", "rows[2].published", "rows[3]", "rows[4].isbn"}},
+		{desc: "best effort", query: "?mode=best-effort&collection=1", body: invalid, status: http.StatusOK,
+			imported: 2, failed: 3, errors: []string{"rows[2].title", "rows[2].published", "rows[3]", "rows[4].isbn"},
+			stored: 2, members: 2},
+		{desc: "dry run", query: "?dry_run=true", body: invalid, status: http.StatusOK,
+			failed: 3, errors: []string{"rows[2].title", "rows[2].published", "rows[3]", "rows[4].isbn"}},
+		{desc: "dry run of valid rows", query: "?dry_run=1&collection=1", body: valid, status: http.StatusOK},
+		{desc: "csv", contentType: "text/csv; charset=utf-8",
+			body:   "\ufeffid,title,author,published,edition\n9,Dune,Frank Herbert,1965-08-01,1\n,\"Emma, Volume 1\",,1815-12-23,2\n",
+			status: http.StatusOK, imported: 2, stored: 2},
+		{desc: "csv with invalid rows", query: "?mode=best-effort", contentType: CSVType,
+			body:   "title,published,edition\nDune,1965-08-01,first\nEmma,1815-12-23\nUlysses,1922-02-02,1\n\"Bare,1922-02-02,1\n",
+			status: http.StatusOK, imported: 1, failed: 3, errors: []string{"rows[1].edition", "rows[2]", "rows[4]"}, stored: 1},
+		{desc: "csv with an unknown column", contentType: CSVType, body: "title,isbn\nDune,123\n",
+			status: http.StatusBadRequest},
+		{desc: "csv with a duplicate column", contentType: CSVType, body: "title,title\nDune,Dune\n",
+			status: http.StatusBadRequest},
+		{desc: "empty body", contentType: CSVType, status: http.StatusOK},
+		{desc: "unknown collection", query: "?collection=2", body: valid, status: http.StatusNotFound},
+		{desc: "invalid collection", query: "?collection=first", body: valid, status: http.StatusBadRequest},
+		{desc: "invalid mode", query: "?mode=some", body: valid, status: http.StatusBadRequest},
+		{desc: "invalid dry run", query: "?dry_run=maybe", body: valid, status: http.StatusBadRequest},
+		{desc: "json array", contentType: "application/json", body: "[]", status: http.StatusUnsupportedMediaType},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			s := store.NewMemoryStore()
+			s.AddCollection(context.Background(), collection.Collection{Collection: "imported"})
+			rt := router.New()
+			NewImportHandler(s).Register(rt)
+
+			r := httptest.NewRequest("POST", "/books:import"+tc.query, strings.NewReader(tc.body))
+			if len(tc.contentType) > 0 {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			asAdmin(rt).ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got [%d]: %s", tc.status, w.Code, w.Body)
+			}
+
+			fields := []string{}
+			if tc.status == http.StatusOK {
+				var out struct {
+					Data book.ImportReport `json:"data"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &out)
+				if out.Data.Imported != tc.imported || out.Data.Failed != tc.failed || len(out.Data.IDs) != tc.imported {
+					t.Fatalf("expected %d imported and %d failed, got [%+v]", tc.imported, tc.failed, out.Data)
+				}
+				for _, e := range out.Data.Errors {
+					fields = append(fields, e.Path())
+				}
+			} else {
+				var p problem.Problem
+				json.Unmarshal(w.Body.Bytes(), &p)
+				for _, e := range p.Errors {
+					fields = append(fields, e.Field)
+				}
+			}
+			if tc.errors != nil && strings.Join(fields, " ") != strings.Join(tc.errors, " ") {
+				t.Fatalf("expected errors for %v, got [%v]: %s", tc.errors, fields, w.Body)
+			}
+
+			books, _, _ := s.ListBooks(context.Background(), store.ListOptions{})
+			if len(books) != tc.stored {
+				t.Fatalf("expected %d stored books, got [%v]", tc.stored, books)
+			}
+			members, _, _ := s.ListBooksForCollection(context.Background(), 1, store.ListOptions{})
+			if len(members) != tc.members {
+				t.Fatalf("expected %d books in the collection, got [%v]", tc.members, members)
+			}
+		})
+	}
+}
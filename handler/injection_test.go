@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/config"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+// injectionPayloads are values that would change the meaning of a query if
+// they were pasted into its SQL rather than bound to it.
+var injectionPayloads = []string{
+	`' OR '1'='1`,
+	`" OR "1"="1`,
+	`1 OR 1=1`,
+	`1; DROP TABLE book`,
+	`'; DROP TABLE book; --`,
+	`') OR ('1'='1`,
+	`%' OR '%'='`,
+	`\' OR 1=1 #`,
+	"` OR 1=1 /*",
+	`1 UNION SELECT id, collection, version FROM collection`,
+}
+
+// TestInjection sends every payload to every endpoint of a SQL backed server.
+// Each request must be rejected or match nothing, values must be stored as
+// sent, and the seeded records must be intact afterwards.
+func TestInjection(t *testing.T) {
+	s, err := store.Open(config.Database{Driver: "sqlite3", DSN: ":memory:", AutoMigrate: true})
+	if err != nil {
+		t.Fatalf("expected no error opening sqlite store, got [%v]", err)
+	}
+	defer s.Close()
+	rt := router.New()
+	NewBookHandler(s).Register(rt)
+	NewCollectionHandler(s).Register(rt)
+	h := WithAuth(rt, s, auth.RoleAdmin)
+	serve(h, "POST", "/books", `{"title": "Dune", "published": "1965-08-01", "edition": 1}`)
+	serve(h, "POST", "/collections", `{"collection": "classics"}`)
+	serve(h, "PUT", "/collections/1/books/1", "")
+
+	type request struct {
+		method string
+		target string
+		body   string
+	}
+	testCases := []struct {
+		desc    string
+		request func(payload string) request
+		status  []int
+	}{
+		{
+			desc: "book filter value",
+			request: func(p string) request {
+				return request{"GET", "/books?" + form("filter", "title eq "+strconv.Quote(p)), ""}
+			},
+			status: []int{http.StatusOK},
+		},
+		{
+			desc:    "book filter",
+			request: func(p string) request { return request{"GET", "/books?" + form("filter", p), ""} },
+			status:  []int{http.StatusOK, http.StatusBadRequest},
+		},
+		{
+			desc:    "book sort",
+			request: func(p string) request { return request{"GET", "/books?" + form("sort", p), ""} },
+			status:  []int{http.StatusBadRequest},
+		},
+		{
+			desc:    "book limit",
+			request: func(p string) request { return request{"GET", "/books?" + form("limit", p), ""} },
+			status:  []int{http.StatusBadRequest},
+		},
+		{
+			desc:    "book page token",
+			request: func(p string) request { return request{"GET", "/books?" + form("page_token", p), ""} },
+			status:  []int{http.StatusBadRequest},
+		},
+		{
+			desc:    "book id",
+			request: func(p string) request { return request{"GET", "/books/" + url.PathEscape(p), ""} },
+			status:  []int{http.StatusNotFound},
+		},
+		{
+			desc: "book id on update",
+			request: func(p string) request {
+				return request{"PUT", "/books/" + url.PathEscape(p), `{"title": "Dune", "published": "1965-08-01", "edition": 2}`}
+			},
+			status: []int{http.StatusNotFound},
+		},
+		{
+			desc:    "book id on patch",
+			request: func(p string) request { return request{"PATCH", "/books/" + url.PathEscape(p), `{"edition": 2}`} },
+			status:  []int{http.StatusNotFound},
+		},
+		{
+			desc:    "book id on delete",
+			request: func(p string) request { return request{"DELETE", "/books/" + url.PathEscape(p), ""} },
+			status:  []int{http.StatusNotFound},
+		},
+		{
+			desc: "collections of book id",
+			request: func(p string) request {
+				return request{"GET", "/books/" + url.PathEscape(p) + "/collections", ""}
+			},
+			status: []int{http.StatusNotFound},
+		},
+		{
+			desc:    "collection name",
+			request: func(p string) request { return request{"GET", "/collections?" + form("name", p), ""} },
+			status:  []int{http.StatusOK},
+		},
+		{
+			desc:    "collection sort",
+			request: func(p string) request { return request{"GET", "/collections?" + form("sort", p), ""} },
+			status:  []int{http.StatusBadRequest},
+		},
+		{
+			desc:    "collection id",
+			request: func(p string) request { return request{"GET", "/collections/" + url.PathEscape(p), ""} },
+			status:  []int{http.StatusNotFound},
+		},
+		{
+			desc: "collection id on update",
+			request: func(p string) request {
+				return request{"PUT", "/collections/" + url.PathEscape(p), `{"collection": "renamed"}`}
+			},
+			status: []int{http.StatusNotFound},
+		},
+		{
+			desc:    "collection id on delete",
+			request: func(p string) request { return request{"DELETE", "/collections/" + url.PathEscape(p), ""} },
+			status:  []int{http.StatusNotFound},
+		},
+		{
+			desc: "books of collection id",
+			request: func(p string) request {
+				return request{"GET", "/collections/" + url.PathEscape(p) + "/books", ""}
+			},
+			status: []int{http.StatusNotFound},
+		},
+		{
+			desc: "books of collection filter value",
+			request: func(p string) request {
+				return request{"GET", "/collections/1/books?" + form("filter", "author eq "+strconv.Quote(p)), ""}
+			},
+			status: []int{http.StatusOK},
+		},
+		{
+			desc: "book id in collection",
+			request: func(p string) request {
+				return request{"PUT", "/collections/1/books/" + url.PathEscape(p), ""}
+			},
+			status: []int{http.StatusNotFound},
+		},
+		{
+			desc: "book id removed from collection",
+			request: func(p string) request {
+				return request{"DELETE", "/collections/1/books/" + url.PathEscape(p), ""}
+			},
+			status: []int{http.StatusNotFound},
+		},
+	}
+	for _, tc := range testCases {
+		for i, payload := range injectionPayloads {
+			t.Run(fmt.Sprintf("%s %d", tc.desc, i), func(t *testing.T) {
+				req := tc.request(payload)
+				w := serve(h, req.method, req.target, req.body)
+				if !hasStatus(w.Code, tc.status) {
+					t.Fatalf("expected status in %v for %q, got [%d]: %s", tc.status, payload, w.Code, w.Body)
+				}
+				var out struct {
+					Total *int `json:"total"`
+				}
+				json.Unmarshal(w.Body.Bytes(), &out)
+				if strings.HasSuffix(tc.desc, "value") || tc.desc == "collection name" {
+					if out.Total == nil || *out.Total != 0 {
+						t.Fatalf("expected nothing to match %q, got [%s]", payload, w.Body)
+					}
+				}
+			})
+		}
+	}
+
+	for i, payload := range injectionPayloads {
+		t.Run(fmt.Sprintf("stored verbatim %d", i), func(t *testing.T) {
+			body, _ := json.Marshal(map[string]interface{}{"title": payload, "author": payload,
+				"published": "2000-01-01", "edition": 1})
+			w := serve(h, "POST", "/books", string(body))
+			if w.Code != http.StatusCreated {
+				t.Fatalf("expected status %d, got [%d]: %s", http.StatusCreated, w.Code, w.Body)
+			}
+			location := w.Header().Get("Location")
+			body, _ = json.Marshal(map[string]interface{}{"description": payload})
+			if w := serve(h, "PATCH", location, string(body)); w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got [%d]: %s", http.StatusOK, w.Code, w.Body)
+			}
+			var b struct {
+				Data struct {
+					Title       string `json:"title"`
+					Description string `json:"description"`
+				} `json:"data"`
+			}
+			json.Unmarshal(serve(h, "GET", location, "").Body.Bytes(), &b)
+			if b.Data.Title != payload || b.Data.Description != payload {
+				t.Fatalf("expected title and description %q, got [%v]", payload, b.Data)
+			}
+			w = serve(h, "GET", "/books?"+form("filter", "author eq "+strconv.Quote(payload)), "")
+			if !strings.Contains(w.Body.String(), `"total":1`) {
+				t.Fatalf("expected the book to be found by author %q, got [%s]", payload, w.Body)
+			}
+
+			body, _ = json.Marshal(map[string]interface{}{"collection": payload})
+			w = serve(h, "POST", "/collections", string(body))
+			if w.Code != http.StatusCreated {
+				t.Fatalf("expected status %d, got [%d]: %s", http.StatusCreated, w.Code, w.Body)
+			}
+			w = serve(h, "GET", "/collections?"+form("name", payload), "")
+			var out struct {
+				Data []struct {
+					Collection string `json:"collection"`
+				} `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &out)
+			if len(out.Data) != 1 || out.Data[0].Collection != payload {
+				t.Fatalf("expected collection %q, got [%s]", payload, w.Body)
+			}
+		})
+	}
+
+	w := serve(h, "GET", "/books/1", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"title":"Dune"`) {
+		t.Fatalf("expected the seeded book to be intact, got [%d]: %s", w.Code, w.Body)
+	}
+	w = serve(h, "GET", "/collections/1/books", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total":1`) {
+		t.Fatalf("expected the seeded collection to be intact, got [%d]: %s", w.Code, w.Body)
+	}
+}
+
+func serve(h http.Handler, method string, target string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func form(key string, value string) string {
+	return url.Values{key: {value}}.Encode()
+}
+
+func hasStatus(status int, statuses []int) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/parser"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+type keyHandler struct {
+	store store.KeyStore
+}
+
+func NewKeyHandler(s store.KeyStore) *keyHandler {
+	return &keyHandler{
+		store: s,
+	}
+}
+
+func (kh *keyHandler) Register(rt *router.Router) {
+	rt.Handle("GET", "/apikeys", Require(auth.RoleAdmin, kh.listKeys))
+	rt.Handle("POST", "/apikeys", Require(auth.RoleAdmin, kh.addKey))
+	rt.Handle("DELETE", "/apikeys/{id:int}", Require(auth.RoleAdmin, kh.revokeKey))
+}
+
+// newKey is an API key along with its token, which is only ever sent once.
+type newKey struct {
+	auth.Key
+	Token string `json:"token"`
+}
+
+func (kh *keyHandler) listKeys(w http.ResponseWriter, r *http.Request, p router.Params) {
+	keys, err := kh.store.ListKeys(r.Context())
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	parser.JSONResponse(w, http.StatusOK, keys)
+}
+
+func (kh *keyHandler) addKey(w http.ResponseWriter, r *http.Request, p router.Params) {
+	var in auth.Key
+	if err := decodeBody(r, &in); err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	key, token, err := auth.NewKey(in.Name, in.Role)
+	if err != nil {
+		problem.Write(w, r, err)
+		return
+	}
+	key.ID, err = kh.store.AddKey(r.Context(), key)
+	if err != nil {
+		problem.Write(w, r, storeError(err, "", fmt.Sprintf("API key %s already exists", in.Name)))
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/apikeys/%d", key.ID))
+	parser.JSONResponse(w, http.StatusCreated, newKey{Key: key, Token: token})
+}
+
+func (kh *keyHandler) revokeKey(w http.ResponseWriter, r *http.Request, p router.Params) {
+	err := kh.store.RevokeKey(r.Context(), p.Int("id"))
+	if err != nil {
+		problem.Write(w, r, storeError(err, fmt.Sprintf("No API key with id: %s", p["id"]), ""))
+		return
+	}
+	parser.JSONResponse(w, http.StatusOK, nil)
+}
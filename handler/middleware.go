@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/masnax/canonical-bookmanager/logging"
+	"github.com/masnax/canonical-bookmanager/problem"
+)
+
+// WithTimeout bounds the time h may spend on a request, a timeout of 0 leaves
+// it unbounded. Handlers hand the request context to the store, whose queries
+// give up once it expires. Requests for the exempt paths, which stream their
+// response for as long as it takes, are left unbounded.
+func WithTimeout(h http.Handler, timeout time.Duration, exempt ...string) http.Handler {
+	if timeout <= 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range exempt {
+			if r.URL.Path == path {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WithLogging assigns every request an id, taken from X-Request-ID when the
+// client sends one and echoed back in the response, and logs the request
+// once it is answered. Handlers and problem.Write find a logger carrying the
+// id in the request context.
+func WithLogging(h http.Handler, logger *logging.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := problem.RequestID(w, r)
+		reqLogger := logger.With("request_id", id)
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		h.ServeHTTP(rec, r.WithContext(logging.NewContext(r.Context(), reqLogger)))
+
+		level := logging.LevelInfo
+		if rec.status >= http.StatusInternalServerError {
+			level = logging.LevelError
+		}
+		reqLogger.Log(level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"bytes_in", body.n,
+			"bytes_out", rec.n,
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// responseRecorder notes the status and size of a response as it is written.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	n           int64
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.n += int64(n)
+	return n, err
+}
+
+// Flush sends what has been written so far, for handlers that stream their
+// response.
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
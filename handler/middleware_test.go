@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/masnax/canonical-bookmanager/logging"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+func TestWithLogging(t *testing.T) {
+	testCases := []struct {
+		desc      string
+		method    string
+		path      string
+		body      string
+		requestID string
+		status    int
+		level     string
+	}{
+		{
+			desc:   "created",
+			method: "POST",
+			path:   "/books",
+			body:   `{"title": "Dune", "published": "1965-08-01", "edition": 1}`,
+			status: http.StatusCreated,
+			level:  "INFO",
+		},
+		{
+			desc:      "client request id",
+			method:    "GET",
+			path:      "/books/2",
+			requestID: "client-id",
+			status:    http.StatusNotFound,
+			level:     "INFO",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			var buf bytes.Buffer
+			rt := router.New()
+			NewBookHandler(store.NewMemoryStore()).Register(rt)
+			h := WithLogging(asAdmin(rt), logging.New(&buf, logging.LevelInfo))
+
+			r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if len(tc.requestID) > 0 {
+				r.Header.Set("X-Request-ID", tc.requestID)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got [%d]: %s", tc.status, w.Code, w.Body)
+			}
+			id := w.Header().Get("X-Request-ID")
+			if len(id) == 0 || (len(tc.requestID) > 0 && id != tc.requestID) {
+				t.Fatalf("expected request id %q, got [%s]", tc.requestID, id)
+			}
+			if w.Code >= 400 && !strings.Contains(w.Body.String(), `"request_id":"`+id+`"`) {
+				t.Fatalf("expected the problem to carry request id %s, got [%s]", id, w.Body)
+			}
+
+			var line map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatalf("expected a single JSON line, got [%v]: %s", err, buf.String())
+			}
+			expected := map[string]interface{}{
+				"level":      tc.level,
+				"msg":        "request",
+				"request_id": id,
+				"method":     tc.method,
+				"path":       tc.path,
+				"status":     float64(tc.status),
+				"bytes_in":   float64(len(tc.body)),
+				"bytes_out":  float64(w.Body.Len()),
+			}
+			for key, value := range expected {
+				if line[key] != value {
+					t.Fatalf("expected %s to be [%v], got [%v]", key, value, line[key])
+				}
+			}
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		path     string
+		timeout  time.Duration
+		deadline bool
+	}{
+		{desc: "bounded", path: "/books", timeout: time.Second, deadline: true},
+		{desc: "unbounded", path: "/books", timeout: 0, deadline: false},
+		{desc: "exempt path", path: "/books/export", timeout: time.Second, deadline: false},
+		{desc: "below an exempt path", path: "/books/export/1", timeout: time.Second, deadline: true},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			deadline := false
+			h := WithTimeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, deadline = r.Context().Deadline()
+			}), tc.timeout, "/books/export")
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tc.path, nil))
+			if deadline != tc.deadline {
+				t.Fatalf("expected a deadline to be %v, got [%v]", tc.deadline, deadline)
+			}
+		})
+	}
+}
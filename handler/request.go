@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/masnax/canonical-bookmanager/patch"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"github.com/masnax/canonical-bookmanager/query"
+	"github.com/masnax/canonical-bookmanager/store"
+	"github.com/masnax/canonical-bookmanager/validate"
+)
+
+// validator is implemented by request payloads that check their own fields.
+type validator interface {
+	Validate() error
+}
+
+// readBody returns the media type and the body of the request. A request
+// declaring a media type other than the accepted ones is rejected with 415,
+// one without a Content-Type is taken to be of the first accepted type.
+func readBody(r *http.Request, accepted ...string) (string, []byte, error) {
+	mediaType, err := bodyType(r, accepted...)
+	if err != nil {
+		return "", nil, err
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return "", nil, bodyError(err)
+	}
+	return mediaType, body, nil
+}
+
+// bodyType returns the media type of the request body as readBody does,
+// for handlers that read the body as a stream.
+func bodyType(r *http.Request, accepted ...string) (string, error) {
+	mediaType := accepted[0]
+	if contentType := r.Header.Get("Content-Type"); len(contentType) > 0 {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(contentType)
+		ok := false
+		for _, a := range accepted {
+			ok = ok || mediaType == a
+		}
+		if err != nil || !ok {
+			return "", problem.New(http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType,
+				fmt.Sprintf("Unsupported Content-Type: '%s', expected one of '%s'", contentType,
+					strings.Join(accepted, "', '")))
+		}
+	}
+	return mediaType, nil
+}
+
+// bodyError rejects a request body that could not be read.
+func bodyError(err error) error {
+	return problem.New(http.StatusBadRequest, problem.CodeInvalidBody, fmt.Sprintf("Malformed request body: %v", err))
+}
+
+// decodeBody reads the JSON request body into v as decodeJSON does.
+func decodeBody(r *http.Request, v interface{}) error {
+	_, body, err := readBody(r, "application/json")
+	if err != nil {
+		return err
+	}
+	return decodeJSON(body, v)
+}
+
+// decodeJSON reads a JSON object into v, which must point to a struct. A body
+// that is not a JSON object is rejected with 400. Unknown fields, values of
+// the wrong type and values failing v's own Validate are all reported
+// together with 422.
+func decodeJSON(body []byte, v interface{}) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil || raw == nil {
+		return problem.New(http.StatusBadRequest, problem.CodeInvalidBody,
+			fmt.Sprintf("Expected a JSON object in the request body, got: %.64s", body))
+	}
+
+	errs := validate.Errors{}
+	fields := jsonFields(reflect.ValueOf(v).Elem())
+	names := []string{}
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field, ok := fields[name]
+		if !ok {
+			errs.Add(name, "is not a known field")
+			continue
+		}
+		if err := json.Unmarshal(raw[name], field.Addr().Interface()); err != nil {
+			errs.Add(name, "expected %s value, got %s", field.Type(), raw[name])
+		}
+	}
+	if val, ok := v.(validator); ok {
+		if ruleErrs, ok := val.Validate().(validate.Errors); ok {
+			for _, f := range ruleErrs {
+				if !errs.Has(f.Field) {
+					errs = append(errs, f)
+				}
+			}
+		}
+	}
+	return validationError(errs)
+}
+
+// jsonFields maps the JSON names of the fields of a struct to the fields.
+func jsonFields(v reflect.Value) map[string]reflect.Value {
+	fields := map[string]reflect.Value{}
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if len(name) == 0 {
+			name = v.Type().Field(i).Name
+		}
+		if name != "-" {
+			fields[name] = v.Field(i)
+		}
+	}
+	return fields
+}
+
+// validationError turns failed checks into a 422 problem listing them all.
+func validationError(errs validate.Errors) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	p := problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed,
+		fmt.Sprintf("%d invalid field(s) in request body", len(errs)))
+	for _, f := range errs {
+		p.Errors = append(p.Errors, problem.FieldError{Field: f.Field, Message: f.Message})
+	}
+	return p
+}
+
+// patchError turns a patch that could not be applied into a problem: 400 for
+// malformed patches, 409 for failed tests and 422 for anything else.
+func patchError(err error) error {
+	if _, ok := err.(*patch.SyntaxError); ok {
+		return problem.New(http.StatusBadRequest, problem.CodeInvalidPatch, err.Error())
+	}
+	if err == patch.ErrTestFailed {
+		return problem.New(http.StatusConflict, problem.CodeConflict, err.Error())
+	}
+	return problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidPatch, err.Error())
+}
+
+// storeError turns the store's sentinel errors into 404, 409 and 412
+// problems. Anything else is left to problem.Write to report as an internal
+// error.
+func storeError(err error, notFound string, conflict string) error {
+	switch err {
+	case store.ErrNotFound:
+		return problem.New(http.StatusNotFound, problem.CodeNotFound, notFound)
+	case store.ErrConflict:
+		return problem.New(http.StatusConflict, problem.CodeConflict, conflict)
+	case store.ErrVersionMismatch:
+		return preconditionFailed()
+	default:
+		return err
+	}
+}
+
+// paramError turns a rejected query parameter into a 400 problem.
+func paramError(err error) error {
+	paramErr, ok := err.(*query.ParamError)
+	if !ok {
+		return err
+	}
+	code := problem.CodeInvalidPage
+	if paramErr.Param == "sort" {
+		code = problem.CodeInvalidSort
+	}
+	return problem.Field(code, paramErr.Param, paramErr.Msg)
+}
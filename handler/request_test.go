@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/problem"
+)
+
+func TestDecodeBody(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		contentType string
+		body        string
+		status      int
+		fields      string
+	}{
+		{
+			desc:   "valid book",
+			body:   `{"title": "Dune", "author": "Frank Herbert", "published": "1965-08-01", "edition": 1}`,
+			status: 0,
+		},
+		{
+			desc:        "json with charset",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"title": "Dune", "published": "1965-08-01", "edition": 1}`,
+			status:      0,
+		},
+		{
+			desc:        "form body",
+			contentType: "application/x-www-form-urlencoded",
+			body:        `title=Dune`,
+			status:      http.StatusUnsupportedMediaType,
+		},
+		{
+			desc:   "not an object",
+			body:   `["Dune"]`,
+			status: http.StatusBadRequest,
+		},
+		{
+			desc:   "every field error at once",
+			body:   `{"title": "", "published": "1965-13-01", "edition": "one", "isbn": "123", "genre": 5}`,
+			status: http.StatusUnprocessableEntity,
+			fields: "[edition genre isbn title published]",
+		},
+		{
+			desc:   "title too long",
+			body:   fmt.Sprintf(`{"title": "%s", "published": "1965-08-01", "edition": 1}`, strings.Repeat("a", 256)),
+			status: http.StatusUnprocessableEntity,
+			fields: "[title]",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/books", strings.NewReader(tc.body))
+			if len(tc.contentType) > 0 {
+				r.Header.Set("Content-Type", tc.contentType)
+			}
+			var b book.Book
+			err := decodeBody(r, &b)
+			if tc.status == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+				if b.Title != "Dune" {
+					t.Fatalf("expected the decoded book, got [%v]", b)
+				}
+				return
+			}
+			p, ok := err.(*problem.Problem)
+			if !ok || p.Status != tc.status {
+				t.Fatalf("expected a %d problem, got [%v]", tc.status, err)
+			}
+			fields := []string{}
+			for _, f := range p.Errors {
+				fields = append(fields, f.Field)
+			}
+			if len(tc.fields) > 0 && fmt.Sprint(fields) != tc.fields {
+				t.Fatalf("expected errors for %s, got [%v]", tc.fields, p.Errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Package testserver serves the API on a memory store for the tests of the
+// packages that talk to it.
+package testserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/client"
+	"github.com/masnax/canonical-bookmanager/handler"
+	"github.com/masnax/canonical-bookmanager/problem"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+// New serves the API to anonymous admins and returns a client for it.
+// Requests for which fail, unless nil, returns true are answered with a 500
+// instead.
+func New(t *testing.T, fail func(r *http.Request) bool) *client.Client {
+	c, _ := serve(t, auth.RoleAdmin, fail)
+	return c
+}
+
+// NewWithKey serves the API to API key holders only and returns a client
+// with the token of an admin key.
+func NewWithKey(t *testing.T) *client.Client {
+	c, s := serve(t, auth.RoleNone, nil)
+	key, token, err := auth.NewKey("admin", auth.RoleAdmin)
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if _, err := s.AddKey(context.Background(), key); err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	c.Token = token
+	return c
+}
+
+func serve(t *testing.T, anonymous auth.Role, fail func(r *http.Request) bool) (*client.Client, store.Store) {
+	s := store.NewMemoryStore()
+	rt := router.New()
+	handler.NewBookHandler(s).Register(rt)
+	handler.NewCollectionHandler(s).Register(rt)
+	handler.NewImportHandler(s).Register(rt)
+	handler.NewExportHandler(s).Register(rt)
+	handler.NewKeyHandler(s).Register(rt)
+	h := handler.WithAuth(rt, s, anonymous)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail != nil && fail(r) {
+			problem.Write(w, r, problem.New(http.StatusInternalServerError, problem.CodeInternal, "failed"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	c, err := client.New(server.URL + "/")
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	return c, s
+}
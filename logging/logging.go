@@ -0,0 +1,173 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel accepts the level names of the configuration, e.g. "warn".
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, errors.New(fmt.Sprintf("unknown log level: %s", s))
+}
+
+// Logger writes one JSON object per line, holding the time, level and message
+// followed by its attributes, given as alternating keys and values in the
+// manner of log/slog. Loggers made by With share the output of their parent.
+type Logger struct {
+	out   *output
+	level Level
+	attrs []byte
+}
+
+type output struct {
+	sync.Mutex
+	w io.Writer
+}
+
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w}, level: level}
+}
+
+// With returns a logger that adds the attributes to every line.
+func (l *Logger) With(args ...interface{}) *Logger {
+	return &Logger{out: l.out, level: l.level, attrs: appendAttrs(append([]byte{}, l.attrs...), args)}
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Debug(msg string, args ...interface{}) {
+	l.Log(LevelDebug, msg, args...)
+}
+
+func (l *Logger) Info(msg string, args ...interface{}) {
+	l.Log(LevelInfo, msg, args...)
+}
+
+func (l *Logger) Warn(msg string, args ...interface{}) {
+	l.Log(LevelWarn, msg, args...)
+}
+
+func (l *Logger) Error(msg string, args ...interface{}) {
+	l.Log(LevelError, msg, args...)
+}
+
+func (l *Logger) Log(level Level, msg string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	line := []byte(`{"time":`)
+	line = appendValue(line, time.Now().UTC().Format(time.RFC3339Nano))
+	line = append(line, `,"level":`...)
+	line = appendValue(line, level.String())
+	line = append(line, `,"msg":`...)
+	line = appendValue(line, msg)
+	line = append(line, l.attrs...)
+	line = appendAttrs(line, args)
+	line = append(line, "}\n"...)
+
+	l.out.Lock()
+	defer l.out.Unlock()
+	l.out.w.Write(line)
+}
+
+// appendAttrs adds the key value pairs of args to a JSON object. A key
+// without a value is logged under !BADKEY, as log/slog does.
+func appendAttrs(line []byte, args []interface{}) []byte {
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		var value interface{}
+		if !ok {
+			key, value = "!BADKEY", args[i]
+			i--
+		} else if i+1 < len(args) {
+			value = args[i+1]
+		} else {
+			key, value = "!BADKEY", key
+		}
+		line = append(line, ',')
+		line = appendValue(line, key)
+		line = append(line, ':')
+		line = appendValue(line, value)
+	}
+	return line
+}
+
+func appendValue(line []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		enc.Encode(fmt.Sprintf("%+v", value))
+	}
+	return append(line, bytes.TrimSuffix(buf.Bytes(), []byte("\n"))...)
+}
+
+var defaultLogger = New(os.Stderr, LevelInfo)
+
+// Default is the logger used outside of requests, and for requests that
+// carry no logger of their own.
+func Default() *Logger {
+	return defaultLogger
+}
+
+// SetDefault replaces the default logger, it is meant to be called once on
+// startup.
+func SetDefault(l *Logger) {
+	defaultLogger = l
+}
+
+type contextKey struct{}
+
+// NewContext returns a context carrying the logger of a request.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger of a request, or the default logger.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return Default()
+}
@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		level Level
+		log   func(l *Logger)
+		attrs string
+	}{
+		{
+			desc:  "message only",
+			level: LevelInfo,
+			log:   func(l *Logger) { l.Info("hello") },
+			attrs: `"level":"INFO","msg":"hello"}`,
+		},
+		{
+			desc:  "below level",
+			level: LevelWarn,
+			log:   func(l *Logger) { l.Info("hello") },
+		},
+		{
+			desc:  "attributes in order",
+			level: LevelDebug,
+			log: func(l *Logger) {
+				l.Debug("request", "status", 404, "path", "/books/<1>", "took", 2*time.Millisecond, "error", errors.New("boom"))
+			},
+			attrs: `"level":"DEBUG","msg":"request","status":404,"path":"/books/<1>","took":"2ms","error":"boom"}`,
+		},
+		{
+			desc:  "with",
+			level: LevelInfo,
+			log:   func(l *Logger) { l.With("request_id", "abc").Error("failed", "n", 1) },
+			attrs: `"level":"ERROR","msg":"failed","request_id":"abc","n":1}`,
+		},
+		{
+			desc:  "bad keys",
+			level: LevelInfo,
+			log:   func(l *Logger) { l.Warn("odd", 1, "key") },
+			attrs: `"level":"WARN","msg":"odd","!BADKEY":1,"!BADKEY":"key"}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			var buf bytes.Buffer
+			tc.log(New(&buf, tc.level))
+			out := buf.String()
+			if len(tc.attrs) == 0 {
+				if len(out) > 0 {
+					t.Fatalf("expected nothing to be logged, got [%s]", out)
+				}
+				return
+			}
+			if !strings.HasSuffix(out, tc.attrs+"\n") {
+				t.Fatalf("expected line to end with %s, got [%s]", tc.attrs, out)
+			}
+			var line map[string]interface{}
+			if err := json.Unmarshal([]byte(out), &line); err != nil {
+				t.Fatalf("expected a JSON line, got [%v]: %s", err, out)
+			}
+			if _, err := time.Parse(time.RFC3339Nano, fmt.Sprint(line["time"])); err != nil {
+				t.Fatalf("expected an RFC 3339 time, got [%v]", line["time"])
+			}
+		})
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, name := range []string{"debug", "info", "WARN", "error"} {
+		level, err := ParseLevel(name)
+		if err != nil {
+			t.Fatalf("expected no error, got [%v]", err)
+		}
+		if !strings.EqualFold(level.String(), name) {
+			t.Fatalf("expected %s, got [%v]", name, level)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Fatalf("expected an error, got none")
+	}
+}
@@ -1,27 +1,135 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
-	"github.com/masnax/canonical-bookmanager/db"
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/config"
 	"github.com/masnax/canonical-bookmanager/handler"
+	"github.com/masnax/canonical-bookmanager/logging"
+	"github.com/masnax/canonical-bookmanager/metrics"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
 )
 
 func main() {
-
-	db, err := db.GetDB()
+	cfg, args, err := config.Load(os.Args[1:], os.LookupEnv)
+	if err == flag.ErrHelp {
+		return
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
-	handler.NewBookHandler(db)
-	handler.NewCollectionHandler(db)
-	handler.NewBookCollectionHandler(db)
-	err = http.ListenAndServe(":8080", nil)
+	if len(args) > 0 {
+		if err := runCommand(cfg, args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// the level has been validated with the rest of the configuration
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	logger := logging.New(os.Stderr, level)
+	logging.SetDefault(logger)
+	// an empty anonymous role parses to none, which rejects requests without a key
+	anonymous, _ := auth.ParseRole(cfg.Auth.AnonymousRole)
+
+	s, err := store.Open(cfg.Database)
+	if err != nil {
+		logger.Error("unable to open store", "driver", cfg.Database.Driver, "error", err)
+		os.Exit(1)
+	}
+	rt := router.New()
+	health := handler.NewHealthHandler(s)
+	health.Register(rt)
+	handler.NewBookHandler(s).Register(rt)
+	handler.NewCollectionHandler(s).Register(rt)
+	handler.NewImportHandler(s).Register(rt)
+	handler.NewExportHandler(s).Register(rt)
+	handler.NewKeyHandler(s).Register(rt)
+	m := metrics.New(s, rt)
+	rt.Handle("GET", "/metrics", handler.Require(auth.RoleReader, func(w http.ResponseWriter, r *http.Request, p router.Params) {
+		m.Handler().ServeHTTP(w, r)
+	}))
+
+	server := &http.Server{
+		Addr:         cfg.Listen,
+		Handler:      handler.WithLogging(m.Instrument(handler.WithTimeout(handler.WithAuth(rt, s, anonymous), cfg.Timeouts.Request, "/books/export")), logger),
+		ReadTimeout:  cfg.Timeouts.Read,
+		WriteTimeout: cfg.Timeouts.Write,
+		IdleTimeout:  cfg.Timeouts.Idle,
+	}
+	listener, err := net.Listen("tcp", cfg.Listen)
 	if err != nil {
-		log.Fatal(err)
+		logger.Error("unable to listen", "addr", cfg.Listen, "error", err)
+		os.Exit(1)
 	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	err = serve(server, listener, cfg, health.Drain, signals)
+	signal.Stop(signals)
+	if closeErr := s.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// serve runs the server on l until it fails or a signal is received. On a
+// signal the server fails /readyz but keeps serving for the drain timeout, or
+// until a second signal, then stops accepting connections and waits for the
+// requests in flight, for at most the shutdown timeout.
+func serve(server *http.Server, l net.Listener, cfg config.Config, drain func(), signals <-chan os.Signal) error {
+	errs := make(chan error, 1)
+	logging.Default().Info("listening", "addr", l.Addr().String(), "tls", len(cfg.TLS.Cert) > 0)
+	go func() {
+		if len(cfg.TLS.Cert) > 0 {
+			errs <- server.ServeTLS(l, cfg.TLS.Cert, cfg.TLS.Key)
+		} else {
+			errs <- server.Serve(l)
+		}
+	}()
 
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		logging.Default().Info("shutting down", "signal", sig, "drain", cfg.Timeouts.Drain)
+	}
+
+	drain()
+	timer := time.NewTimer(cfg.Timeouts.Drain)
+	select {
+	case <-timer.C:
+	case sig := <-signals:
+		timer.Stop()
+		logging.Default().Info("drain cut short", "signal", sig)
+	case err := <-errs:
+		timer.Stop()
+		return err
+	}
+	ctx := context.Background()
+	if cfg.Timeouts.Shutdown > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeouts.Shutdown)
+		defer cancel()
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		server.Close()
+		return errors.New(fmt.Sprintf("requests still in flight after %v were cut off: %v", cfg.Timeouts.Shutdown, err))
+	}
+	logging.Default().Info("shut down")
+	return nil
 }
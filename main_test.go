@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/masnax/canonical-bookmanager/config"
+	"github.com/masnax/canonical-bookmanager/handler"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+func TestServeDrain(t *testing.T) {
+	testCases := []struct {
+		desc         string
+		drain        time.Duration
+		secondSignal bool
+		maxWait      time.Duration
+	}{
+		{desc: "waits the drain timeout", drain: 500 * time.Millisecond, maxWait: 5 * time.Second},
+		{desc: "second signal skips the wait", drain: time.Hour, secondSignal: true, maxWait: 5 * time.Second},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			rt := router.New()
+			health := handler.NewHealthHandler(store.NewMemoryStore())
+			health.Register(rt)
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			url := fmt.Sprintf("http://%s/readyz", l.Addr())
+			cfg := config.Default()
+			cfg.Timeouts.Drain = tc.drain
+			cfg.Timeouts.Shutdown = time.Second
+
+			signals := make(chan os.Signal, 1)
+			errs := make(chan error, 1)
+			start := time.Now()
+			go func() {
+				errs <- serve(&http.Server{Handler: rt}, l, cfg, health.Drain, signals)
+			}()
+
+			if status := readyz(t, url); status != http.StatusOK {
+				t.Fatalf("expected status %d before the signal, got [%d]", http.StatusOK, status)
+			}
+			signals <- syscall.SIGTERM
+			// the server keeps serving while it drains, but reports it is not ready
+			deadline := time.Now().Add(tc.maxWait)
+			for readyz(t, url) != http.StatusServiceUnavailable {
+				if time.Now().After(deadline) {
+					t.Fatalf("expected status %d while draining", http.StatusServiceUnavailable)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			select {
+			case err := <-errs:
+				t.Fatalf("expected the server to keep serving while draining, got [%v]", err)
+			default:
+			}
+			if tc.secondSignal {
+				signals <- syscall.SIGINT
+			}
+
+			select {
+			case err := <-errs:
+				if err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+			case <-time.After(tc.maxWait):
+				t.Fatalf("expected the server to stop within %v", tc.maxWait)
+			}
+			if elapsed := time.Since(start); !tc.secondSignal && elapsed < tc.drain {
+				t.Fatalf("expected the server to drain for %v, stopped after [%v]", tc.drain, elapsed)
+			}
+			if _, err := noKeepAlive.Get(url); err == nil {
+				t.Fatalf("expected the server to be stopped, got a response")
+			}
+		})
+	}
+}
+
+// noKeepAlive closes every connection once answered, so that none is left
+// idle for the shutdown to wait on.
+var noKeepAlive = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+// readyz returns the status of a readiness check.
+func readyz(t *testing.T, url string) int {
+	resp, err := noKeepAlive.Get(url)
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/masnax/canonical-bookmanager/logging"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "bookmanager"
+
+// countTimeout bounds the queries counting books and collections on a scrape.
+const countTimeout = 5 * time.Second
+
+// Metrics holds the metrics of a server in a registry of its own, so that
+// servers in the same process, e.g. in tests, do not clash.
+type Metrics struct {
+	registry *prometheus.Registry
+	rt       *router.Router
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight prometheus.Gauge
+}
+
+// New registers the request metrics for the routes of rt, the size of the
+// store and, for stores backed by a database, its connection pool.
+func New(s store.Store, rt *router.Router) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		rt:       rt,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Requests handled, by method, route and status code.",
+		}, []string{"method", "route", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to handle requests, by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Requests currently being handled.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.duration,
+		m.inFlight,
+		newStoreCollector(s),
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+	if pool, ok := s.(interface{ DBStats() sql.DBStats }); ok {
+		m.registry.MustRegister(newPoolCollector(pool.DBStats))
+	}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Instrument counts and times the requests handled by h. Requests are
+// labelled with the pattern of their route rather than their path, to bound
+// the number of series, and paths matching no route share one label.
+func (m *Metrics) Instrument(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := m.rt.Pattern(r)
+		if len(route) == 0 {
+			route = "unmatched"
+		}
+		m.inFlight.Inc()
+		defer m.inFlight.Dec()
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		m.duration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+		m.requests.WithLabelValues(r.Method, route, strconv.Itoa(rec.status)).Inc()
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// storeCollector reports the number of books and collections, counted on
+// every scrape.
+type storeCollector struct {
+	store       store.Store
+	books       *prometheus.Desc
+	collections *prometheus.Desc
+}
+
+func newStoreCollector(s store.Store) *storeCollector {
+	return &storeCollector{
+		store:       s,
+		books:       prometheus.NewDesc(namespace+"_books", "Books in the store.", nil, nil),
+		collections: prometheus.NewDesc(namespace+"_collections", "Collections in the store.", nil, nil),
+	}
+}
+
+func (c *storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.books
+	ch <- c.collections
+}
+
+// Collect leaves out a count that fails, so that a scrape still reports the
+// other metrics while the database is unreachable.
+func (c *storeCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+	defer cancel()
+	// a single row is enough, only the total is needed
+	opts := store.ListOptions{Limit: 1}
+	if _, total, err := c.store.ListBooks(ctx, opts); err != nil {
+		logging.Default().Warn("unable to count books", "error", err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.books, prometheus.GaugeValue, float64(total))
+	}
+	if _, total, err := c.store.ListCollections(ctx, opts); err != nil {
+		logging.Default().Warn("unable to count collections", "error", err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(c.collections, prometheus.GaugeValue, float64(total))
+	}
+}
+
+// poolCollector reports sql.DBStats of the store's connection pool.
+type poolCollector struct {
+	stats func() sql.DBStats
+	descs map[string]*prometheus.Desc
+}
+
+func newPoolCollector(stats func() sql.DBStats) *poolCollector {
+	desc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(namespace+"_db_"+name, help, nil, nil)
+	}
+	return &poolCollector{
+		stats: stats,
+		descs: map[string]*prometheus.Desc{
+			"max_open":        desc("max_open_connections", "Maximum number of open connections to the database."),
+			"open":            desc("open_connections", "Established connections, both in use and idle."),
+			"in_use":          desc("in_use_connections", "Connections currently in use."),
+			"idle":            desc("idle_connections", "Idle connections."),
+			"wait_count":      desc("wait_count_total", "Connections waited for."),
+			"wait_duration":   desc("wait_duration_seconds_total", "Time spent waiting for a connection."),
+			"max_idle_closed": desc("max_idle_closed_total", "Connections closed due to max_idle_conns."),
+			"max_lifetime":    desc("max_lifetime_closed_total", "Connections closed due to conn_max_lifetime."),
+		},
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range c.descs {
+		ch <- d
+	}
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+	gauge := func(name string, value float64) {
+		ch <- prometheus.MustNewConstMetric(c.descs[name], prometheus.GaugeValue, value)
+	}
+	counter := func(name string, value float64) {
+		ch <- prometheus.MustNewConstMetric(c.descs[name], prometheus.CounterValue, value)
+	}
+	gauge("max_open", float64(stats.MaxOpenConnections))
+	gauge("open", float64(stats.OpenConnections))
+	gauge("in_use", float64(stats.InUse))
+	gauge("idle", float64(stats.Idle))
+	counter("wait_count", float64(stats.WaitCount))
+	counter("wait_duration", stats.WaitDuration.Seconds())
+	counter("max_idle_closed", float64(stats.MaxIdleClosed))
+	counter("max_lifetime", float64(stats.MaxLifetimeClosed))
+}
@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/config"
+	"github.com/masnax/canonical-bookmanager/handler"
+	"github.com/masnax/canonical-bookmanager/router"
+	"github.com/masnax/canonical-bookmanager/store"
+)
+
+func TestMetrics(t *testing.T) {
+	sqlite, err := store.Open(config.Database{Driver: "sqlite3", DSN: ":memory:", AutoMigrate: true})
+	if err != nil {
+		t.Fatalf("expected no error opening sqlite store, got [%v]", err)
+	}
+	defer sqlite.Close()
+
+	requests := []struct{ method, path, body string }{
+		{"POST", "/books", `{"title": "Dune", "published": "1965-08-01", "edition": 1}`},
+		{"GET", "/books/1", ""},
+		{"GET", "/books/2", ""},
+		{"GET", "/books/3", ""},
+		{"PATCH", "/collections", ""},
+		{"GET", "/authors", ""},
+	}
+	expected := []string{
+		`bookmanager_http_requests_total{code="201",method="POST",route="/books"} 1`,
+		`bookmanager_http_requests_total{code="200",method="GET",route="/books/{id:int}"} 1`,
+		`bookmanager_http_requests_total{code="404",method="GET",route="/books/{id:int}"} 2`,
+		`bookmanager_http_requests_total{code="405",method="PATCH",route="/collections"} 1`,
+		`bookmanager_http_requests_total{code="404",method="GET",route="unmatched"} 1`,
+		`bookmanager_http_request_duration_seconds_count{method="GET",route="/books/{id:int}"} 3`,
+		`bookmanager_http_requests_in_flight 0`,
+		`bookmanager_books 1`,
+		`bookmanager_collections 0`,
+	}
+	for name, s := range map[string]store.Store{"memory": store.NewMemoryStore(), "sqlite3": sqlite} {
+		t.Run(fmt.Sprintf("%s", name), func(t *testing.T) {
+			rt := router.New()
+			handler.NewBookHandler(s).Register(rt)
+			handler.NewCollectionHandler(s).Register(rt)
+			m := New(s, rt)
+			h := m.Instrument(handler.WithAuth(rt, s, auth.RoleAdmin))
+			for _, req := range requests {
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, strings.NewReader(req.body)))
+			}
+
+			w := httptest.NewRecorder()
+			m.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got [%d]", http.StatusOK, w.Code)
+			}
+			out := w.Body.String()
+			for _, line := range expected {
+				if !strings.Contains(out, line+"\n") {
+					t.Fatalf("expected metrics to contain %q, got [%s]", line, out)
+				}
+			}
+			pool := strings.Contains(out, "bookmanager_db_open_connections ")
+			if pool != (name == "sqlite3") {
+				t.Fatalf("expected connection pool metrics only for sqlite3, got [%v] for %s", pool, name)
+			}
+		})
+	}
+}
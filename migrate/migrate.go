@@ -0,0 +1,200 @@
+package migrate
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+migration files: <driver>/V<version>__<Name>.<up|down>.sql
+where version  orders the migrations and is recorded in schema_migrations once applied
+			up       applies the change, down reverts it
+			each file may hold several statements separated by ';'
+*/
+
+//go:embed mysql/*.sql sqlite3/*.sql
+var files embed.FS
+
+var fileName = regexp.MustCompile(`^V(\d+)__(\w+)\.(up|down)\.sql$`)
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    INTEGER PRIMARY KEY,
+	name       VARCHAR(255) NOT NULL,
+	applied_at VARCHAR(64) NOT NULL
+)`
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt string
+}
+
+// Migrations returns every migration shipped for the driver, oldest first.
+func Migrations(driver string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, driver)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("no migrations for driver: %s", driver))
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		parts := fileName.FindStringSubmatch(e.Name())
+		if parts == nil {
+			return nil, errors.New(fmt.Sprintf("invalid migration file name: %s", e.Name()))
+		}
+		version, _ := strconv.Atoi(parts[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		}
+		if m.Name != parts[2] {
+			return nil, errors.New(fmt.Sprintf("conflicting names for migration V%d: %s and %s",
+				version, m.Name, parts[2]))
+		}
+		contents, err := files.ReadFile(path.Join(driver, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if parts[3] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, m := range byVersion {
+		if len(m.Up) == 0 || len(m.Down) == 0 {
+			return nil, errors.New(fmt.Sprintf("migration V%d__%s needs both an up and a down file",
+				m.Version, m.Name))
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// GetStatus lists every migration for the driver and whether it has been applied.
+func GetStatus(db *sql.DB, driver string) ([]Status, error) {
+	migrations, err := Migrations(driver)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := []Status{}
+	for _, m := range migrations {
+		at, ok := applied[m.Version]
+		statuses = append(statuses, Status{Migration: m, Applied: ok, AppliedAt: at})
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration in order and returns the ones it applied.
+func Up(db *sql.DB, driver string) ([]Migration, error) {
+	statuses, err := GetStatus(db, driver)
+	if err != nil {
+		return nil, err
+	}
+	done := []Migration{}
+	for _, s := range statuses {
+		if s.Applied {
+			continue
+		}
+		err := run(db, s.Up, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			s.Version, s.Name, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return done, errors.New(fmt.Sprintf("unable to apply migration V%d__%s: %v", s.Version, s.Name, err))
+		}
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+// Down reverts up to steps of the most recently applied migrations and
+// returns the ones it reverted.
+func Down(db *sql.DB, driver string, steps int) ([]Migration, error) {
+	statuses, err := GetStatus(db, driver)
+	if err != nil {
+		return nil, err
+	}
+	done := []Migration{}
+	for i := len(statuses) - 1; i >= 0 && len(done) < steps; i-- {
+		s := statuses[i]
+		if !s.Applied {
+			continue
+		}
+		err := run(db, s.Down, "DELETE FROM schema_migrations WHERE version = ?", s.Version)
+		if err != nil {
+			return done, errors.New(fmt.Sprintf("unable to revert migration V%d__%s: %v", s.Version, s.Name, err))
+		}
+		done = append(done, s.Migration)
+	}
+	return done, nil
+}
+
+func appliedVersions(db *sql.DB) (map[int]string, error) {
+	if _, err := db.Exec(createTable); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]string{}
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// run executes the statements of a migration followed by the bookkeeping
+// query in one transaction. MySQL commits DDL implicitly, so a failure there
+// can leave a migration partially applied.
+func run(db *sql.DB, script string, record string, args ...interface{}) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, stmt := range strings.Split(script, ";") {
+		if len(strings.TrimSpace(stmt)) == 0 {
+			continue
+		}
+		if _, err := tx.Exec(stmt); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.Exec(record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
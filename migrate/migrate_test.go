@@ -0,0 +1,98 @@
+package migrate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/config"
+	"github.com/masnax/canonical-bookmanager/db"
+)
+
+func TestMigrationFiles(t *testing.T) {
+	for _, driver := range []string{"mysql", "sqlite3"} {
+		t.Run(driver, func(t *testing.T) {
+			migrations, err := Migrations(driver)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			for i, m := range migrations {
+				if m.Version != i+1 {
+					t.Fatalf("expected contiguous versions, got V%d at position %d", m.Version, i)
+				}
+			}
+		})
+	}
+	if _, err := Migrations("postgres"); err == nil {
+		t.Fatalf("expected an error for unknown driver, got none")
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	database, err := db.Open(config.Database{Driver: "sqlite3", DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	defer database.Close()
+	migrations, err := Migrations("sqlite3")
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+
+	applied, err := Up(database, "sqlite3")
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("expected %d migrations applied, got [%v]", len(migrations), applied)
+	}
+	if _, err := database.Exec("INSERT INTO book (title, author, published, edition, genre) " +
+		"VALUES ('a', 'b', '2000-01-01', 1, 'c')"); err != nil {
+		t.Fatalf("expected book table to exist, got [%v]", err)
+	}
+	if _, err := database.Exec("INSERT INTO collection (collection) VALUES ('d')"); err != nil {
+		t.Fatalf("expected collection table to exist, got [%v]", err)
+	}
+	if _, err := database.Exec("INSERT INTO book_collection (book_id, collection_id) VALUES (1, 1)"); err != nil {
+		t.Fatalf("expected book_collection table to exist, got [%v]", err)
+	}
+	applied, err = Up(database, "sqlite3")
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("expected nothing left to apply, got [%v] [%v]", applied, err)
+	}
+
+	// the last two reach back to V4, whose down rebuilds the tables
+	reverted, err := Down(database, "sqlite3", 2)
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	last := migrations[len(migrations)-2]
+	if len(reverted) != 2 || reverted[1].Version != last.Version {
+		t.Fatalf("expected V%d reverted last, got [%v]", last.Version, reverted)
+	}
+	var members int
+	if err := database.QueryRow("SELECT COUNT(*) FROM book_collection").Scan(&members); err != nil || members != 1 {
+		t.Fatalf("expected the collection member to be kept, got [%d] [%v]", members, err)
+	}
+	statuses, err := GetStatus(database, "sqlite3")
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	for _, s := range statuses {
+		if s.Applied != (s.Version < last.Version) {
+			t.Fatalf("unexpected status for V%d: %v", s.Version, s.Applied)
+		}
+	}
+
+	reverted, err = Down(database, "sqlite3", len(migrations))
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if len(reverted) != len(migrations)-2 {
+		t.Fatalf("expected %d migrations reverted, got [%v]", len(migrations)-2, reverted)
+	}
+	for _, table := range []string{"book", "collection", "book_collection", "api_key"} {
+		if _, err := database.Exec(fmt.Sprintf("SELECT * FROM %s", table)); err == nil {
+			t.Fatalf("expected table %s to be dropped", table)
+		}
+	}
+}
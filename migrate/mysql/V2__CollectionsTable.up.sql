@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS collection (
+	id          INTEGER AUTO_INCREMENT PRIMARY KEY,
+	collection  VARCHAR(255) UNIQUE NOT NULL
+);
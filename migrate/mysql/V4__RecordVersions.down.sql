@@ -0,0 +1,2 @@
+ALTER TABLE collection DROP COLUMN version;
+ALTER TABLE book DROP COLUMN version;
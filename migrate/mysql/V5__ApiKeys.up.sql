@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS api_key (
+	id          INTEGER AUTO_INCREMENT PRIMARY KEY,
+	name        VARCHAR(255) UNIQUE NOT NULL,
+	key_hash    CHAR(64) UNIQUE NOT NULL,
+	role        VARCHAR(16) NOT NULL,
+	created_at  VARCHAR(64) NOT NULL
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS book (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	title       VARCHAR(255) NOT NULL,
+	author      VARCHAR(255) NOT NULL,
+	published   TEXT NOT NULL,
+	edition     INTEGER NOT NULL,
+	description TEXT,
+	genre       VARCHAR(255) NOT NULL
+);
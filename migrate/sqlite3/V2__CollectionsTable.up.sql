@@ -1,4 +1,4 @@
 CREATE TABLE IF NOT EXISTS collection (
-	id					INTEGER AUTO_INCREMENT PRIMARY KEY,
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
 	collection  VARCHAR(255) UNIQUE NOT NULL
 );
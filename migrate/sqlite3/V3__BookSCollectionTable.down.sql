@@ -0,0 +1 @@
+DROP TABLE IF EXISTS book_collection;
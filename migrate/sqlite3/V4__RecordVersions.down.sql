@@ -0,0 +1,27 @@
+-- SQLite before 3.35 cannot drop columns, so both tables are rebuilt. Dropping
+-- them cascades to book_collection, which is restored from a copy.
+CREATE TABLE book_collection_copy AS SELECT book_id, collection_id FROM book_collection;
+
+CREATE TABLE book_copy (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	title       VARCHAR(255) NOT NULL,
+	author      VARCHAR(255) NOT NULL,
+	published   TEXT NOT NULL,
+	edition     INTEGER NOT NULL,
+	description TEXT,
+	genre       VARCHAR(255) NOT NULL
+);
+INSERT INTO book_copy SELECT id, title, author, published, edition, description, genre FROM book;
+DROP TABLE book;
+ALTER TABLE book_copy RENAME TO book;
+
+CREATE TABLE collection_copy (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	collection  VARCHAR(255) UNIQUE NOT NULL
+);
+INSERT INTO collection_copy SELECT id, collection FROM collection;
+DROP TABLE collection;
+ALTER TABLE collection_copy RENAME TO collection;
+
+INSERT INTO book_collection SELECT book_id, collection_id FROM book_collection_copy;
+DROP TABLE book_collection_copy;
@@ -0,0 +1,2 @@
+ALTER TABLE book ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE collection ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -3,33 +3,35 @@ package parser
 import (
 	"encoding/json"
 	"net/http"
-	"net/url"
-	"strings"
 )
 
-func URLParser(url *url.URL) []string {
-	parts := strings.Split(url.Path, "/")
-	if len(parts) < 3 {
-		return nil
-	}
-	return parts
-}
-
 func JSONResponse(w http.ResponseWriter, code int, data interface{}) error {
-	out := map[string]interface{}{
+	return writeResponse(w, code, map[string]interface{}{
 		"status-code": code,
 		"status":      http.StatusText(code),
 		"data":        data,
-	}
+	})
+}
+
+// PagedResponse is a JSONResponse for one page of a listing, with the total
+// number of results and the token for the next page, empty on the last page.
+func PagedResponse(w http.ResponseWriter, code int, data interface{}, total int, nextPageToken string) error {
+	return writeResponse(w, code, map[string]interface{}{
+		"status-code":     code,
+		"status":          http.StatusText(code),
+		"data":            data,
+		"total":           total,
+		"next_page_token": nextPageToken,
+	})
+}
+
+func writeResponse(w http.ResponseWriter, code int, out map[string]interface{}) error {
 	response, err := json.Marshal(out)
 	if err != nil {
 		return err
 	}
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
 	w.Write(response)
 	return nil
 }
-
-func ErrorResponse(w http.ResponseWriter, code int, msg string) error {
-	return JSONResponse(w, code, map[string]string{"error": msg})
-}
@@ -0,0 +1,246 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// ErrTestFailed is returned when a JSON Patch test operation does not match.
+var ErrTestFailed = errors.New("patch test operation failed")
+
+// SyntaxError is returned for patch documents that are not well formed, as
+// opposed to well formed patches that cannot be applied to the document.
+type SyntaxError struct {
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return e.Msg
+}
+
+// Merge applies an RFC 7396 JSON Merge Patch to a JSON document.
+func Merge(doc []byte, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, &SyntaxError{Msg: fmt.Sprintf("malformed merge patch: %v", err)}
+	}
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = merge(t[k], v)
+		}
+	}
+	return t
+}
+
+type operation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// Apply applies an RFC 6902 JSON Patch to a JSON document. The operations are
+// applied in order and the document is left untouched if any of them fails.
+func Apply(doc []byte, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+	var ops []operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, &SyntaxError{Msg: fmt.Sprintf("malformed JSON patch: %v", err)}
+	}
+	for i, op := range ops {
+		var err error
+		target, err = apply(target, op)
+		if err == ErrTestFailed {
+			return nil, err
+		}
+		if syntaxErr, ok := err.(*SyntaxError); ok {
+			return nil, &SyntaxError{Msg: fmt.Sprintf("operation %d: %s", i, syntaxErr.Msg)}
+		}
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("operation %d: %v", i, err))
+		}
+	}
+	return json.Marshal(target)
+}
+
+func apply(doc interface{}, op operation) (interface{}, error) {
+	if op.Path == nil {
+		return nil, &SyntaxError{Msg: fmt.Sprintf("missing path in %s operation", op.Op)}
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, &SyntaxError{Msg: fmt.Sprintf("missing value in %s operation", op.Op)}
+		}
+		if err := json.Unmarshal(*op.Value, &value); err != nil {
+			return nil, &SyntaxError{Msg: fmt.Sprintf("malformed value in %s operation: %v", op.Op, err)}
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return nil, &SyntaxError{Msg: fmt.Sprintf("missing from in %s operation", op.Op)}
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err = get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		// copies must not share maps or slices with the original
+		data, _ := json.Marshal(value)
+		json.Unmarshal(data, &value)
+		if op.Op == "move" {
+			if doc, err = remove(doc, from); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return add(doc, path, value, false)
+	case "replace":
+		return add(doc, path, value, true)
+	case "remove":
+		return remove(doc, path)
+	case "test":
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	default:
+		return nil, &SyntaxError{Msg: fmt.Sprintf("unknown operation %q", op.Op)}
+	}
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if len(pointer) == 0 {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, &SyntaxError{Msg: fmt.Sprintf("invalid JSON pointer %q", pointer)}
+	}
+	path := strings.Split(pointer[1:], "/")
+	for i, p := range path {
+		path[i] = strings.Replace(strings.Replace(p, "~1", "/", -1), "~0", "~", -1)
+	}
+	return path, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, key := range path {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, ok := d[key]
+			if !ok {
+				return nil, errors.New(fmt.Sprintf("path /%s does not exist", strings.Join(path, "/")))
+			}
+			doc = v
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(d) {
+				return nil, errors.New(fmt.Sprintf("path /%s does not exist", strings.Join(path, "/")))
+			}
+			doc = d[i]
+		default:
+			return nil, errors.New(fmt.Sprintf("path /%s does not exist", strings.Join(path, "/")))
+		}
+	}
+	return doc, nil
+}
+
+// add sets the value at path, which must exist when replacing. The parent is
+// looked up and rebuilt, since arrays may need to grow.
+func add(doc interface{}, path []string, value interface{}, replace bool) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	key := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := p[key]; replace && !ok {
+			return nil, errors.New(fmt.Sprintf("path /%s does not exist", strings.Join(path, "/")))
+		}
+		p[key] = value
+		return doc, nil
+	case []interface{}:
+		i := len(p)
+		if key != "-" || replace {
+			i, err = strconv.Atoi(key)
+			if err != nil || i < 0 || i > len(p) || (replace && i == len(p)) {
+				return nil, errors.New(fmt.Sprintf("path /%s does not exist", strings.Join(path, "/")))
+			}
+		}
+		if replace {
+			p[i] = value
+			return doc, nil
+		}
+		grown := append(append(append([]interface{}{}, p[:i]...), value), p[i:]...)
+		return add(doc, path[:len(path)-1], grown, len(path) > 1)
+	default:
+		return nil, errors.New(fmt.Sprintf("path /%s does not exist", strings.Join(path, "/")))
+	}
+}
+
+func remove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	if _, err := get(doc, path); err != nil {
+		return nil, err
+	}
+	parent, _ := get(doc, path[:len(path)-1])
+	key := path[len(path)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		delete(p, key)
+		return doc, nil
+	default:
+		i, _ := strconv.Atoi(key)
+		shrunk := append(append([]interface{}{}, p.([]interface{})[:i]...), p.([]interface{})[i+1:]...)
+		return add(doc, path[:len(path)-1], shrunk, len(path) > 1)
+	}
+}
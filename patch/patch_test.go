@@ -0,0 +1,154 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	testCases := []struct {
+		doc    string
+		patch  string
+		expect string
+	}{
+		{doc: `{"a":"b"}`, patch: `{"a":"c"}`, expect: `{"a":"c"}`},
+		{doc: `{"a":"b"}`, patch: `{"b":"c"}`, expect: `{"a":"b","b":"c"}`},
+		{doc: `{"a":"b"}`, patch: `{"a":null}`, expect: `{}`},
+		{doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, expect: `{"b":"c"}`},
+		{doc: `{"a":["b"]}`, patch: `{"a":"c"}`, expect: `{"a":"c"}`},
+		{doc: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, expect: `{"a":{"b":"d"}}`},
+		{doc: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, expect: `{"a":[1]}`},
+		{doc: `{"e":null}`, patch: `{"a":1}`, expect: `{"a":1,"e":null}`},
+		{doc: `[1,2]`, patch: `{"a":"b","c":null}`, expect: `{"a":"b"}`},
+		{doc: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, expect: `{"a":{"bb":{}}}`},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s %s", tc.doc, tc.patch), func(t *testing.T) {
+			out, err := Merge([]byte(tc.doc), []byte(tc.patch))
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			assertJSON(t, tc.expect, out)
+		})
+	}
+	if _, err := Merge([]byte(`{}`), []byte(`{`)); err == nil {
+		t.Fatalf("expected an error for a malformed patch, got none")
+	}
+}
+
+func TestApply(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		doc    string
+		patch  string
+		expect string
+		err    error
+	}{
+		{
+			desc:   "add member",
+			doc:    `{"foo":"bar"}`,
+			patch:  `[{"op":"add","path":"/baz","value":"qux"}]`,
+			expect: `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			desc:   "add array element",
+			doc:    `{"foo":["bar","baz"]}`,
+			patch:  `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			expect: `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			desc:   "append array element",
+			doc:    `{"foo":["bar"]}`,
+			patch:  `[{"op":"add","path":"/foo/-","value":"qux"}]`,
+			expect: `{"foo":["bar","qux"]}`,
+		},
+		{
+			desc:   "remove member",
+			doc:    `{"baz":"qux","foo":"bar"}`,
+			patch:  `[{"op":"remove","path":"/baz"}]`,
+			expect: `{"foo":"bar"}`,
+		},
+		{
+			desc:   "remove array element",
+			doc:    `{"foo":["bar","qux","baz"]}`,
+			patch:  `[{"op":"remove","path":"/foo/1"}]`,
+			expect: `{"foo":["bar","baz"]}`,
+		},
+		{
+			desc:   "replace",
+			doc:    `{"baz":"qux","foo":"bar"}`,
+			patch:  `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			expect: `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			desc:   "move",
+			doc:    `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch:  `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			expect: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			desc:   "copy",
+			doc:    `{"a":{"b":1}}`,
+			patch:  `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`,
+			expect: `{"a":{"b":1},"c":{"b":2}}`,
+		},
+		{
+			desc:   "escaped pointer",
+			doc:    `{"a/b":1,"m~n":2}`,
+			patch:  `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`,
+			expect: `{"a/b":3}`,
+		},
+		{
+			desc:   "test passes",
+			doc:    `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch:  `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			expect: `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			desc:  "test fails",
+			doc:   `{"baz":"qux"}`,
+			patch: `[{"op":"test","path":"/baz","value":"bar"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			desc:  "replace missing member",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"replace","path":"/baz","value":"qux"}]`,
+		},
+		{
+			desc:  "add to missing parent",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+		},
+		{
+			desc:  "unknown operation",
+			doc:   `{}`,
+			patch: `[{"op":"frobnicate","path":"/a"}]`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			out, err := Apply([]byte(tc.doc), []byte(tc.patch))
+			if len(tc.expect) == 0 {
+				if err == nil || (tc.err != nil && err != tc.err) {
+					t.Fatalf("expected an error, got [%v]", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			assertJSON(t, tc.expect, out)
+		})
+	}
+}
+
+func assertJSON(t *testing.T, expect string, out []byte) {
+	var e, o interface{}
+	json.Unmarshal([]byte(expect), &e)
+	if err := json.Unmarshal(out, &o); err != nil || !reflect.DeepEqual(e, o) {
+		t.Fatalf("expected %s, got [%s]", expect, out)
+	}
+}
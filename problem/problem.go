@@ -0,0 +1,132 @@
+package problem
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/masnax/canonical-bookmanager/logging"
+)
+
+const ContentType = "application/problem+json"
+
+// Code identifies the kind of problem. Codes are stable, unlike the detail
+// message, so clients may branch on them.
+type Code string
+
+const (
+	CodeInvalidBody          Code = "invalid_body"
+	CodeValidationFailed     Code = "validation_failed"
+	CodeInvalidPatch         Code = "invalid_patch"
+	CodeInvalidFilter        Code = "invalid_filter"
+	CodeInvalidSort          Code = "invalid_sort"
+	CodeInvalidPage          Code = "invalid_page"
+	CodeInvalidParam         Code = "invalid_param"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeMethodNotAllowed     Code = "method_not_allowed"
+	CodeConflict             Code = "conflict"
+	CodePreconditionFailed   Code = "precondition_failed"
+	CodeUnsupportedMediaType Code = "unsupported_media_type"
+	CodeTimeout              Code = "timeout"
+	CodeUnavailable          Code = "unavailable"
+	CodeInternal             Code = "internal"
+)
+
+// FieldError points at the part of the request that was rejected, a field of
+// the body or a query parameter.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details object, extended with a code, the
+// rejected fields and the id of the request.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      Code         `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+func New(status int, code Code, detail string) *Problem {
+	return &Problem{
+		Type:   "urn:bookmanager:problem:" + string(code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Field is a 400 problem rejecting a single field.
+func Field(code Code, field string, message string) *Problem {
+	p := New(http.StatusBadRequest, code, message)
+	p.Errors = []FieldError{{Field: field, Message: message}}
+	return p
+}
+
+func (p *Problem) Error() string {
+	msg := p.Detail
+	if len(msg) == 0 {
+		msg = p.Title
+	}
+	for _, f := range p.Errors {
+		if f.Message != p.Detail {
+			msg += "; " + f.Field + ": " + f.Message
+		}
+	}
+	return msg
+}
+
+// Write answers the request with err. Anything other than a *Problem is
+// logged and answered with a generic 500, so that driver errors do not leak
+// to clients, or with 503 if the request ran out of time, since drivers
+// report interrupted queries in different ways.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	p, ok := err.(*Problem)
+	if !ok && r.Context().Err() == context.DeadlineExceeded {
+		p = New(http.StatusServiceUnavailable, CodeTimeout, "The server was unable to complete the request in time")
+	} else if !ok {
+		p = New(http.StatusInternalServerError, CodeInternal, "The server was unable to complete the request")
+	}
+	out := *p
+	out.Instance = r.URL.Path
+	out.RequestID = RequestID(w, r)
+	if !ok {
+		logging.FromContext(r.Context()).Error("request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+	}
+
+	response, jsonErr := json.Marshal(out)
+	if jsonErr != nil {
+		http.Error(w, jsonErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(out.Status)
+	w.Write(response)
+}
+
+// RequestID returns the id the client sent in X-Request-ID, or a new one. The
+// id is echoed back in the response headers.
+func RequestID(w http.ResponseWriter, r *http.Request) string {
+	if id := w.Header().Get("X-Request-ID"); len(id) > 0 {
+		return id
+	}
+	id := strings.TrimSpace(r.Header.Get("X-Request-ID"))
+	if len(id) == 0 || len(id) > 128 {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	w.Header().Set("X-Request-ID", id)
+	return id
+}
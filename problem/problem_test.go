@@ -0,0 +1,100 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		err    error
+		status int
+		code   Code
+		detail string
+		errors int
+	}{
+		{
+			desc:   "problem",
+			err:    New(http.StatusNotFound, CodeNotFound, "No book with id: 3"),
+			status: http.StatusNotFound,
+			code:   CodeNotFound,
+			detail: "No book with id: 3",
+		},
+		{
+			desc:   "field problem",
+			err:    Field(CodeInvalidFilter, "filter", "unexpected end of filter"),
+			status: http.StatusBadRequest,
+			code:   CodeInvalidFilter,
+			detail: "unexpected end of filter",
+			errors: 1,
+		},
+		{
+			desc:   "raw error is hidden",
+			err:    errors.New("Error 1054: Unknown column 'secret' in 'field list'"),
+			status: http.StatusInternalServerError,
+			code:   CodeInternal,
+			detail: "The server was unable to complete the request",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/books/3", nil)
+			r.Header.Set("X-Request-ID", "abc")
+			Write(w, r, tc.err)
+
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got [%v]", tc.status, w.Code)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != ContentType {
+				t.Fatalf("expected Content-Type %s, got [%v]", ContentType, contentType)
+			}
+			if id := w.Header().Get("X-Request-ID"); id != "abc" {
+				t.Fatalf("expected request id abc, got [%v]", id)
+			}
+			var p Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if p.Status != tc.status || p.Code != tc.code || p.Detail != tc.detail || len(p.Errors) != tc.errors {
+				t.Fatalf("expected %d %s %q with %d field errors, got [%+v]", tc.status, tc.code, tc.detail, tc.errors, p)
+			}
+			if p.Instance != "/books/3" || p.RequestID != "abc" || !strings.HasSuffix(p.Type, string(tc.code)) {
+				t.Fatalf("expected instance, request id and type to be set, got [%+v]", p)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	w := httptest.NewRecorder()
+	id := RequestID(w, httptest.NewRequest("GET", "/", nil))
+	if len(id) != 16 || w.Header().Get("X-Request-ID") != id {
+		t.Fatalf("expected a generated request id in the response, got [%v]", id)
+	}
+	if again := RequestID(w, httptest.NewRequest("GET", "/", nil)); again != id {
+		t.Fatalf("expected the same request id for the same response, got [%v]", again)
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/books", nil).WithContext(ctx)
+	Write(w, r, errors.New("interrupted"))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got [%v]", http.StatusServiceUnavailable, w.Code)
+	}
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || p.Code != CodeTimeout {
+		t.Fatalf("expected a %s problem, got [%+v] [%v]", CodeTimeout, p, err)
+	}
+}
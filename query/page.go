@@ -0,0 +1,126 @@
+package query
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// pageParams are left out of the fingerprint tying a page token to its query.
+var pageParams = []string{"limit", "offset", "page_token"}
+
+// ParamError rejects the value of a query parameter.
+type ParamError struct {
+	Param string
+	Msg   string
+}
+
+func (e *ParamError) Error() string {
+	return e.Msg
+}
+
+type Page struct {
+	Limit  int
+	Offset int
+
+	fingerprint uint32
+}
+
+type pageToken struct {
+	Offset      int    `json:"o"`
+	Fingerprint uint32 `json:"q"`
+}
+
+// ParsePage reads limit, offset and page_token from the request. A page token
+// takes the place of offset and is only valid for the query that produced it.
+func ParsePage(r *http.Request) (Page, error) {
+	values := r.URL.Query()
+	page := Page{Limit: DefaultLimit, fingerprint: fingerprint(r.URL.Path, values)}
+
+	if limit := values.Get("limit"); len(limit) > 0 {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxLimit {
+			return Page{}, &ParamError{Param: "limit",
+				Msg: fmt.Sprintf("limit must be an integer between 1 and %d, got %q", MaxLimit, limit)}
+		}
+		page.Limit = n
+	}
+	offset := values.Get("offset")
+	token := values.Get("page_token")
+	if len(offset) > 0 && len(token) > 0 {
+		return Page{}, &ParamError{Param: "page_token", Msg: "offset and page_token cannot be used together"}
+	}
+	if len(offset) > 0 {
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			return Page{}, &ParamError{Param: "offset",
+				Msg: fmt.Sprintf("offset must be a non-negative integer, got %q", offset)}
+		}
+		page.Offset = n
+	}
+	if len(token) > 0 {
+		t, err := decodeToken(token)
+		if err != nil || t.Offset < 0 {
+			return Page{}, &ParamError{Param: "page_token", Msg: fmt.Sprintf("invalid page_token: %q", token)}
+		}
+		if t.Fingerprint != page.fingerprint {
+			return Page{}, &ParamError{Param: "page_token", Msg: "page_token was issued for a different query"}
+		}
+		page.Offset = t.Offset
+	}
+	return page, nil
+}
+
+// NextToken returns the token for the page after this one, or an empty
+// string if this is the last page.
+func (p Page) NextToken(total int) string {
+	next := p.Offset + p.Limit
+	if p.Limit <= 0 || next >= total {
+		return ""
+	}
+	data, _ := json.Marshal(pageToken{Offset: next, Fingerprint: p.fingerprint})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeToken(token string) (pageToken, error) {
+	var t pageToken
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal(data, &t)
+	return t, err
+}
+
+func fingerprint(path string, values url.Values) uint32 {
+	keys := []string{}
+	for k := range values {
+		keep := true
+		for _, p := range pageParams {
+			if k == p {
+				keep = false
+			}
+		}
+		if keep {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	h := fnv.New32a()
+	h.Write([]byte(path + "?"))
+	for _, k := range keys {
+		h.Write([]byte(k + "=" + strings.Join(values[k], ",") + "&"))
+	}
+	return h.Sum32()
+}
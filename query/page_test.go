@@ -0,0 +1,58 @@
+package query
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParsePage(t *testing.T) {
+	first, err := ParsePage(httptest.NewRequest("GET", "/books?filter=genre+eq+a&limit=10", nil))
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if first.Limit != 10 || first.Offset != 0 {
+		t.Fatalf("expected limit 10 offset 0, got [%v]", first)
+	}
+	token := first.NextToken(25)
+	if len(token) == 0 {
+		t.Fatalf("expected a next page token, got none")
+	}
+
+	second, err := ParsePage(httptest.NewRequest("GET", "/books?limit=10&filter=genre+eq+a&page_token="+token, nil))
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if second.Offset != 10 {
+		t.Fatalf("expected offset 10, got [%v]", second)
+	}
+	third, err := ParsePage(httptest.NewRequest("GET", "/books?filter=genre+eq+a&limit=10&page_token="+second.NextToken(25), nil))
+	if err != nil {
+		t.Fatalf("expected no error, got [%v]", err)
+	}
+	if third.Offset != 20 || len(third.NextToken(25)) != 0 {
+		t.Fatalf("expected last page at offset 20, got [%v]", third)
+	}
+
+	if _, err := ParsePage(httptest.NewRequest("GET", "/books?filter=genre+eq+b&page_token="+token, nil)); err == nil {
+		t.Fatalf("expected an error for a token from another query, got none")
+	}
+}
+
+func TestInvalidPage(t *testing.T) {
+	testCases := []string{
+		"limit=0",
+		"limit=abc",
+		fmt.Sprintf("limit=%d", MaxLimit+1),
+		"offset=-1",
+		"page_token=garbage",
+		"offset=1&page_token=eyJvIjoxLCJxIjowfQ",
+	}
+	for _, tc := range testCases {
+		t.Run(tc, func(t *testing.T) {
+			if _, err := ParsePage(httptest.NewRequest("GET", "/books?"+tc, nil)); err == nil {
+				t.Fatalf("expected an error, got none")
+			}
+		})
+	}
+}
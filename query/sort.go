@@ -0,0 +1,82 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Sort orders results by each field in turn, Field is the name of a struct field.
+type Sort []SortField
+
+// Fields lists the names of the fields of a struct that results may be sorted
+// by, which are the fields that are not left out of its JSON.
+func Fields(v interface{}) []string {
+	fields := []string{}
+	r := reflect.TypeOf(v)
+	for i := 0; i < r.NumField(); i++ {
+		if r.Field(i).Tag.Get("json") == "-" {
+			continue
+		}
+		fields = append(fields, r.Field(i).Name)
+	}
+	return fields
+}
+
+// ParseSort reads a comma separated list of fields, each prefixed with '-' to
+// sort in descending order, e.g. "author,-published". Field names are matched
+// case insensitively against fields.
+func ParseSort(value string, fields []string) (Sort, error) {
+	sort := Sort{}
+	if len(value) == 0 {
+		return sort, nil
+	}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		desc := strings.HasPrefix(part, "-")
+		name := strings.TrimPrefix(part, "-")
+		field := ""
+		for _, f := range fields {
+			if strings.EqualFold(f, name) {
+				field = f
+			}
+		}
+		if len(field) == 0 {
+			return nil, &ParamError{Param: "sort", Msg: fmt.Sprintf("cannot sort by %q, expected one of %v",
+				name, strings.ToLower(strings.Join(fields, ", ")))}
+		}
+		if seen[field] {
+			return nil, &ParamError{Param: "sort", Msg: fmt.Sprintf("cannot sort by %q more than once", name)}
+		}
+		seen[field] = true
+		sort = append(sort, SortField{Field: field, Desc: desc})
+	}
+	return sort, nil
+}
+
+// Less compares two structs of the same type by the sort fields.
+func (s Sort) Less(a interface{}, b interface{}) bool {
+	ra := reflect.ValueOf(a)
+	rb := reflect.ValueOf(b)
+	for _, f := range s {
+		fa := ra.FieldByName(f.Field)
+		fb := rb.FieldByName(f.Field)
+		var less, greater bool
+		switch fa.Kind() {
+		case reflect.Int:
+			less, greater = fa.Int() < fb.Int(), fa.Int() > fb.Int()
+		default:
+			less, greater = fa.String() < fb.String(), fa.String() > fb.String()
+		}
+		if less || greater {
+			return less != f.Desc
+		}
+	}
+	return false
+}
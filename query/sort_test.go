@@ -0,0 +1,61 @@
+package query
+
+import (
+	"fmt"
+	"testing"
+)
+
+type sortable struct {
+	Id     int
+	Author string
+}
+
+func TestParseSort(t *testing.T) {
+	fields := Fields(sortable{})
+	testCases := []struct {
+		value  string
+		expect string
+		err    bool
+	}{
+		{value: "", expect: "[]"},
+		{value: "author", expect: "[{Author false}]"},
+		{value: "AUTHOR,-id", expect: "[{Author false} {Id true}]"},
+		{value: " -author , id", expect: "[{Author true} {Id false}]"},
+		{value: "title", err: true},
+		{value: "author,", err: true},
+		{value: "author,-author", err: true},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%q", tc.value), func(t *testing.T) {
+			sort, err := ParseSort(tc.value, fields)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected an error, got [%v]", sort)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if fmt.Sprint(sort) != tc.expect {
+				t.Fatalf("expected %s, got [%v]", tc.expect, sort)
+			}
+		})
+	}
+}
+
+func TestSortLess(t *testing.T) {
+	a := sortable{Id: 1, Author: "b"}
+	b := sortable{Id: 2, Author: "b"}
+	c := sortable{Id: 3, Author: "a"}
+	sort := Sort{{Field: "Author"}, {Field: "Id", Desc: true}}
+	if !sort.Less(c, a) || sort.Less(a, c) {
+		t.Fatalf("expected author a before author b")
+	}
+	if !sort.Less(b, a) || sort.Less(a, b) {
+		t.Fatalf("expected id 2 before id 1")
+	}
+	if sort.Less(a, a) {
+		t.Fatalf("expected equal values to not be less")
+	}
+}
@@ -0,0 +1,157 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/masnax/canonical-bookmanager/problem"
+)
+
+// Params holds the path parameters of a matched route, keyed by name.
+type Params map[string]string
+
+// Int returns an integer parameter. Parameters declared as {name:int} are
+// checked when the route is matched, so this only fails for other names.
+func (p Params) Int(name string) int {
+	n, _ := strconv.Atoi(p[name])
+	return n
+}
+
+type HandlerFunc func(w http.ResponseWriter, r *http.Request, p Params)
+
+type segment struct {
+	literal string
+	param   string
+	kind    string
+}
+
+type route struct {
+	method   string
+	pattern  string
+	segments []segment
+	handler  HandlerFunc
+}
+
+// Router dispatches requests on their method and path. Patterns are made of
+// literal segments and parameters written as {name} or {name:int}, e.g.
+// "/collections/{id:int}/books/{bookId:int}". A path that matches no pattern
+// is answered with 404, a path that matches only with another method with 405
+// and an Allow header.
+type Router struct {
+	routes []route
+}
+
+func New() *Router {
+	return &Router{}
+}
+
+func (rt *Router) Handle(method string, pattern string, handler HandlerFunc) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	rt.routes = append(rt.routes, route{method: method, pattern: pattern, segments: segments, handler: handler})
+}
+
+// Pattern returns the pattern of the route the request is dispatched to, or
+// of a route with another method for the same path, and "" if there is none.
+func (rt *Router) Pattern(r *http.Request) string {
+	parts := splitPath(r.URL.Path)
+	pattern := ""
+	for _, route := range rt.routes {
+		if _, ok := route.match(parts); !ok {
+			continue
+		}
+		if route.method == r.Method {
+			return route.pattern
+		}
+		if len(pattern) == 0 {
+			pattern = route.pattern
+		}
+	}
+	return pattern
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := splitPath(r.URL.Path)
+	allowed := []string{}
+	for _, route := range rt.routes {
+		params, ok := route.match(parts)
+		if !ok {
+			continue
+		}
+		if route.method == r.Method {
+			route.handler(w, r, params)
+			return
+		}
+		allowed = append(allowed, route.method)
+	}
+	if len(allowed) == 0 {
+		problem.Write(w, r, problem.New(http.StatusNotFound, problem.CodeNotFound,
+			fmt.Sprintf("Invalid path: '%s'", r.URL.Path)))
+		return
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	problem.Write(w, r, problem.New(http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed,
+		fmt.Sprintf("Invalid method: '%s' for path: '%s'", r.Method, r.URL.Path)))
+}
+
+func (rt route) match(parts []string) (Params, bool) {
+	if len(parts) != len(rt.segments) {
+		return nil, false
+	}
+	params := Params{}
+	for i, s := range rt.segments {
+		if len(s.param) == 0 {
+			if parts[i] != s.literal {
+				return nil, false
+			}
+			continue
+		}
+		if len(parts[i]) == 0 {
+			return nil, false
+		}
+		if s.kind == "int" {
+			if _, err := strconv.Atoi(parts[i]); err != nil {
+				return nil, false
+			}
+		}
+		params[s.param] = parts[i]
+	}
+	return params, true
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	segments := []segment{}
+	for _, part := range splitPath(pattern) {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			segments = append(segments, segment{literal: part})
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(part, "{"), "}")
+		kind := ""
+		if i := strings.Index(name, ":"); i >= 0 {
+			name, kind = name[:i], name[i+1:]
+		}
+		if len(name) == 0 || (kind != "" && kind != "int") {
+			return nil, errors.New(fmt.Sprintf("invalid parameter %s in pattern %s", part, pattern))
+		}
+		segments = append(segments, segment{param: name, kind: kind})
+	}
+	return segments, nil
+}
+
+// splitPath ignores leading and trailing slashes, so "/books/" and "/books"
+// are the same path.
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if len(path) == 0 {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
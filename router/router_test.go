@@ -0,0 +1,79 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	rt := New()
+	for _, route := range []struct{ method, pattern string }{
+		{"GET", "/books"},
+		{"POST", "/books"},
+		{"GET", "/books/{id:int}"},
+		{"DELETE", "/books/{id:int}"},
+		{"PUT", "/collections/{id:int}/books/{bookId:int}"},
+		{"GET", "/authors/{name}"},
+	} {
+		route := route
+		rt.Handle(route.method, route.pattern, func(w http.ResponseWriter, r *http.Request, p Params) {
+			w.Header().Set("X-Route", fmt.Sprintf("%s %s %v", route.method, route.pattern, map[string]string(p)))
+		})
+	}
+
+	testCases := []struct {
+		method  string
+		path    string
+		code    int
+		route   string
+		allow   string
+		pattern string
+	}{
+		{method: "GET", path: "/books", code: 200, route: "GET /books map[]", pattern: "/books"},
+		{method: "GET", path: "/books/", code: 200, route: "GET /books map[]", pattern: "/books"},
+		{method: "POST", path: "/books", code: 200, route: "POST /books map[]", pattern: "/books"},
+		{method: "GET", path: "/books/12", code: 200, route: "GET /books/{id:int} map[id:12]", pattern: "/books/{id:int}"},
+		{method: "PUT", path: "/collections/3/books/4", code: 200,
+			route:   "PUT /collections/{id:int}/books/{bookId:int} map[bookId:4 id:3]",
+			pattern: "/collections/{id:int}/books/{bookId:int}"},
+		{method: "GET", path: "/authors/max", code: 200, route: "GET /authors/{name} map[name:max]", pattern: "/authors/{name}"},
+		{method: "GET", path: "/books/abc", code: 404},
+		{method: "GET", path: "/books/1/2", code: 404},
+		{method: "GET", path: "/", code: 404},
+		{method: "PATCH", path: "/books", code: 405, allow: "GET, POST", pattern: "/books"},
+		{method: "PUT", path: "/books/1", code: 405, allow: "DELETE, GET", pattern: "/books/{id:int}"},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s %s", tc.method, tc.path), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rt.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+			if w.Code != tc.code {
+				t.Fatalf("expected code %d, got [%v]", tc.code, w.Code)
+			}
+			if route := w.Header().Get("X-Route"); route != tc.route {
+				t.Fatalf("expected route %q, got [%v]", tc.route, route)
+			}
+			if allow := w.Header().Get("Allow"); allow != tc.allow {
+				t.Fatalf("expected Allow %q, got [%v]", tc.allow, allow)
+			}
+			if pattern := rt.Pattern(httptest.NewRequest(tc.method, tc.path, nil)); pattern != tc.pattern {
+				t.Fatalf("expected pattern %q, got [%v]", tc.pattern, pattern)
+			}
+		})
+	}
+}
+
+func TestInvalidPattern(t *testing.T) {
+	for _, pattern := range []string{"/books/{}", "/books/{id:float}"} {
+		t.Run(pattern, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic, got none")
+				}
+			}()
+			New().Handle("GET", pattern, nil)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/masnax/canonical-bookmanager/query"
+)
+
+// selectQuery builds a SELECT out of fragments of SQL written in this package
+// and values that are always bound as parameters. The first invalid fragment
+// is reported by SQL and CountSQL.
+type selectQuery struct {
+	columns string
+	from    string
+	where   []string
+	groupBy string
+	order   []string
+	args    []interface{}
+	limit   int
+	offset  int
+	err     error
+}
+
+func newSelect(columns string, from string) *selectQuery {
+	q := &selectQuery{columns: columns, from: from}
+	q.check(columns)
+	q.check(from)
+	return q
+}
+
+// Where adds a condition, holding one placeholder for each of args. Every
+// condition must hold.
+func (q *selectQuery) Where(cond string, args ...interface{}) *selectQuery {
+	q.check(cond, args...)
+	q.where = append(q.where, cond)
+	q.args = append(q.args, args...)
+	return q
+}
+
+func (q *selectQuery) GroupBy(columns string) *selectQuery {
+	q.check(columns)
+	q.groupBy = columns
+	return q
+}
+
+// OrderBy sorts by the columns that the sort fields map to, followed by id so
+// that pages are stable. Fields missing from columns are an error.
+func (q *selectQuery) OrderBy(sort query.Sort, columns map[string]string, id string) *selectQuery {
+	for _, f := range sort {
+		column, ok := columns[f.Field]
+		if !ok {
+			q.fail(errors.New(fmt.Sprintf("sorting by %s is not supported", f.Field)))
+			continue
+		}
+		if f.Desc {
+			column += " DESC"
+		}
+		q.order = append(q.order, column)
+	}
+	q.order = append(q.order, id)
+	return q
+}
+
+// Page limits the rows returned, a limit of 0 returns every row.
+func (q *selectQuery) Page(limit int, offset int) *selectQuery {
+	q.limit = limit
+	q.offset = offset
+	return q
+}
+
+func (q *selectQuery) SQL() (string, []interface{}, error) {
+	if q.err != nil {
+		return "", nil, q.err
+	}
+	stmt, args := q.body()
+	if len(q.order) > 0 {
+		stmt += " ORDER BY " + strings.Join(q.order, ", ")
+	}
+	if q.limit > 0 {
+		stmt += " LIMIT ? OFFSET ?"
+		args = append(args, q.limit, q.offset)
+	}
+	return stmt, args, nil
+}
+
+// CountSQL counts the rows the query returns, regardless of its page.
+func (q *selectQuery) CountSQL() (string, []interface{}, error) {
+	if q.err != nil {
+		return "", nil, q.err
+	}
+	if len(q.groupBy) == 0 {
+		stmt := "SELECT COUNT(*) FROM " + q.from
+		if len(q.where) > 0 {
+			stmt += " WHERE " + strings.Join(q.where, " AND ")
+		}
+		return stmt, append([]interface{}{}, q.args...), nil
+	}
+	stmt, args := q.body()
+	return "SELECT COUNT(*) FROM (" + stmt + ") AS counted", args, nil
+}
+
+func (q *selectQuery) body() (string, []interface{}) {
+	stmt := "SELECT " + q.columns + " FROM " + q.from
+	if len(q.where) > 0 {
+		stmt += " WHERE " + strings.Join(q.where, " AND ")
+	}
+	if len(q.groupBy) > 0 {
+		stmt += " GROUP BY " + q.groupBy
+	}
+	return stmt, append([]interface{}{}, q.args...)
+}
+
+func (q *selectQuery) check(fragment string, args ...interface{}) {
+	q.fail(checkSQL(fragment, args))
+}
+
+func (q *selectQuery) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// checkSQL rejects SQL holding quotes, other than those of an empty string,
+// comments or statement separators, or a placeholder count that does not
+// match args. SQL is only written in this package and values are always bound,
+// so such SQL can only come from a value pasted into it by mistake.
+func checkSQL(fragment string, args []interface{}) error {
+	stripped := strings.ReplaceAll(fragment, "''", "")
+	for _, token := range []string{"'", `"`, "`", ";", "--", "/*", "#"} {
+		if strings.Contains(stripped, token) {
+			return errors.New(fmt.Sprintf("refusing to run SQL containing %q: %s", token, fragment))
+		}
+	}
+	if n := strings.Count(fragment, "?"); n != len(args) {
+		return errors.New(fmt.Sprintf("expected %d arguments for SQL, got %d: %s", n, len(args), fragment))
+	}
+	return nil
+}
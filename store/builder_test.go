@@ -0,0 +1,121 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/query"
+)
+
+func TestSelectQuery(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		query func() *selectQuery
+		sql   string
+		count string
+		args  string
+		err   bool
+	}{
+		{
+			desc:  "select",
+			query: func() *selectQuery { return newSelect("book.id", "book") },
+			sql:   "SELECT book.id FROM book",
+			count: "SELECT COUNT(*) FROM book",
+			args:  "[]",
+		},
+		{
+			desc: "where, order and page",
+			query: func() *selectQuery {
+				return newSelect("book.id", "book").Where("book.id > ?", 1).Where("book.title = ?", "Dune").
+					OrderBy(query.Sort{{Field: "Title", Desc: true}}, bookFilterColumns, "book.id").Page(10, 20)
+			},
+			sql:   "SELECT book.id FROM book WHERE book.id > ? AND book.title = ? ORDER BY book.title DESC, book.id LIMIT ? OFFSET ?",
+			count: "SELECT COUNT(*) FROM book WHERE book.id > ? AND book.title = ?",
+			args:  "[1 Dune 10 20]",
+		},
+		{
+			desc: "group by",
+			query: func() *selectQuery {
+				return newSelect("collection.id", "collection").Where("collection.collection = ?", "a").
+					GroupBy("collection.id")
+			},
+			sql:   "SELECT collection.id FROM collection WHERE collection.collection = ? GROUP BY collection.id",
+			count: "SELECT COUNT(*) FROM (SELECT collection.id FROM collection WHERE collection.collection = ? GROUP BY collection.id) AS counted",
+			args:  "[a]",
+		},
+		{
+			desc:  "empty string",
+			query: func() *selectQuery { return newSelect("book.id", "book").Where("COALESCE(book.genre, '') = ?", "") },
+			sql:   "SELECT book.id FROM book WHERE COALESCE(book.genre, '') = ?",
+			count: "SELECT COUNT(*) FROM book WHERE COALESCE(book.genre, '') = ?",
+			args:  "[]",
+		},
+		{
+			desc: "unsupported sort",
+			query: func() *selectQuery {
+				return newSelect("book.id", "book").OrderBy(query.Sort{{Field: "Isbn"}}, bookFilterColumns, "book.id")
+			},
+			err: true,
+		},
+		{
+			desc:  "missing argument",
+			query: func() *selectQuery { return newSelect("book.id", "book").Where("book.id = ?") },
+			err:   true,
+		},
+		{
+			desc:  "extra argument",
+			query: func() *selectQuery { return newSelect("book.id", "book").Where("book.id = 1", 1) },
+			err:   true,
+		},
+		{
+			desc:  "quoted value",
+			query: func() *selectQuery { return newSelect("book.id", "book").Where("book.title = 'Dune'") },
+			err:   true,
+		},
+		{
+			desc:  "double quoted value",
+			query: func() *selectQuery { return newSelect("book.id", "book").Where(`book.title = "Dune"`) },
+			err:   true,
+		},
+		{
+			desc:  "statement separator",
+			query: func() *selectQuery { return newSelect("book.id", "book; DROP TABLE book") },
+			err:   true,
+		},
+		{
+			desc:  "comment",
+			query: func() *selectQuery { return newSelect("book.id", "book").GroupBy("book.id -- ") },
+			err:   true,
+		},
+		{
+			desc:  "block comment",
+			query: func() *selectQuery { return newSelect("book.id /* */", "book") },
+			err:   true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			q := tc.query()
+			sql, args, err := q.SQL()
+			count, _, countErr := q.CountSQL()
+			if tc.err {
+				if err == nil || countErr == nil {
+					t.Fatalf("expected an error, got [%s] and [%s]", sql, count)
+				}
+				return
+			}
+			if err != nil || countErr != nil {
+				t.Fatalf("expected no error, got [%v] and [%v]", err, countErr)
+			}
+			if sql != tc.sql {
+				t.Fatalf("expected [%s], got [%s]", tc.sql, sql)
+			}
+			if count != tc.count {
+				t.Fatalf("expected [%s], got [%s]", tc.count, count)
+			}
+			if fmt.Sprintf("%v", args) != tc.args {
+				t.Fatalf("expected args %s, got [%v]", tc.args, args)
+			}
+		})
+	}
+}
@@ -0,0 +1,440 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/collection"
+	"github.com/masnax/canonical-bookmanager/query"
+)
+
+// memoryStore keeps records in maps guarded by its lock. It never waits on
+// anything but the lock, so it ignores the context it is given.
+type memoryStore struct {
+	sync.RWMutex
+	books            map[int]book.Book
+	collections      map[int]collection.Collection
+	members          map[collection.BookCollectionData]bool
+	keys             map[int]auth.Key
+	nextBookID       int
+	nextCollectionID int
+	nextKeyID        int
+}
+
+func NewMemoryStore() *memoryStore {
+	return &memoryStore{
+		books:            map[int]book.Book{},
+		collections:      map[int]collection.Collection{},
+		members:          map[collection.BookCollectionData]bool{},
+		keys:             map[int]auth.Key{},
+		nextBookID:       1,
+		nextCollectionID: 1,
+		nextKeyID:        1,
+	}
+}
+
+func (m *memoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *memoryStore) Close() error {
+	return nil
+}
+
+func (m *memoryStore) ListBooks(ctx context.Context, opts ListOptions) ([]book.Book, int, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	books := []book.Book{}
+	for _, b := range m.books {
+		books = append(books, b)
+	}
+	return filterBooks(books, opts)
+}
+
+func (m *memoryStore) GetBook(ctx context.Context, id int) (book.Book, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	b, ok := m.books[id]
+	if !ok {
+		return book.Book{}, ErrNotFound
+	}
+	return b, nil
+}
+
+func (m *memoryStore) AddBook(ctx context.Context, b book.Book) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	b.Id = m.nextBookID
+	b.Version = 1
+	m.nextBookID++
+	m.books[b.Id] = b
+	return b.Id, nil
+}
+
+func (m *memoryStore) UpdateBook(ctx context.Context, id int, b book.Book) error {
+	m.Lock()
+	defer m.Unlock()
+
+	current, ok := m.books[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if b.Version > 0 && b.Version != current.Version {
+		return ErrVersionMismatch
+	}
+	b.Id = id
+	b.Version = current.Version + 1
+	m.books[id] = b
+	return nil
+}
+
+func (m *memoryStore) DeleteBook(ctx context.Context, id int, version int) error {
+	m.Lock()
+	defer m.Unlock()
+
+	current, ok := m.books[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if version > 0 && version != current.Version {
+		return ErrVersionMismatch
+	}
+	delete(m.books, id)
+	for member := range m.members {
+		if member.BookID == id {
+			delete(m.members, member)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) ListCollections(ctx context.Context, opts ListOptions) ([]collection.BookCollection, int, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	bookCollections := []collection.BookCollection{}
+	for _, c := range m.collections {
+		if len(opts.Name) > 0 && c.Collection != opts.Name {
+			continue
+		}
+		bc := collection.BookCollection{ID: c.ID, Collection: c.Collection}
+		for member := range m.members {
+			if member.CollectionID == c.ID {
+				bc.Size++
+			}
+		}
+		bookCollections = append(bookCollections, bc)
+	}
+	sort.Slice(bookCollections, func(i, j int) bool {
+		return bookCollections[i].ID < bookCollections[j].ID
+	})
+	order := opts.Sort
+	if len(order) == 0 {
+		order = query.Sort{{Field: "Size", Desc: true}}
+	}
+	sort.SliceStable(bookCollections, func(i, j int) bool {
+		return order.Less(bookCollections[i], bookCollections[j])
+	})
+	lo, hi := pageBounds(len(bookCollections), opts)
+	return bookCollections[lo:hi], len(bookCollections), nil
+}
+
+func (m *memoryStore) GetCollection(ctx context.Context, id int) (collection.Collection, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	c, ok := m.collections[id]
+	if !ok {
+		return collection.Collection{}, ErrNotFound
+	}
+	return c, nil
+}
+
+func (m *memoryStore) AddCollection(ctx context.Context, c collection.Collection) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if err := m.checkUniqueName(0, c.Collection); err != nil {
+		return 0, err
+	}
+	c.ID = m.nextCollectionID
+	c.Version = 1
+	m.nextCollectionID++
+	m.collections[c.ID] = c
+	return c.ID, nil
+}
+
+func (m *memoryStore) UpdateCollection(ctx context.Context, id int, c collection.Collection) error {
+	m.Lock()
+	defer m.Unlock()
+
+	current, ok := m.collections[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if c.Version > 0 && c.Version != current.Version {
+		return ErrVersionMismatch
+	}
+	if err := m.checkUniqueName(id, c.Collection); err != nil {
+		return err
+	}
+	c.ID = id
+	c.Version = current.Version + 1
+	m.collections[id] = c
+	return nil
+}
+
+func (m *memoryStore) DeleteCollection(ctx context.Context, id int, version int) error {
+	m.Lock()
+	defer m.Unlock()
+
+	current, ok := m.collections[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if version > 0 && version != current.Version {
+		return ErrVersionMismatch
+	}
+	delete(m.collections, id)
+	for member := range m.members {
+		if member.CollectionID == id {
+			delete(m.members, member)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) ListBooksForCollection(ctx context.Context, collectionID int, opts ListOptions) ([]book.Book, int, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if _, ok := m.collections[collectionID]; !ok {
+		return nil, 0, ErrNotFound
+	}
+	books := []book.Book{}
+	for member := range m.members {
+		if member.CollectionID == collectionID {
+			books = append(books, m.books[member.BookID])
+		}
+	}
+	return filterBooks(books, opts)
+}
+
+func (m *memoryStore) ListCollectionsForBook(ctx context.Context, bookID int) ([]collection.Collection, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if _, ok := m.books[bookID]; !ok {
+		return nil, ErrNotFound
+	}
+	collections := []collection.Collection{}
+	for member := range m.members {
+		if member.BookID == bookID {
+			collections = append(collections, m.collections[member.CollectionID])
+		}
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].ID < collections[j].ID
+	})
+	return collections, nil
+}
+
+func (m *memoryStore) AddBookToCollection(ctx context.Context, bookID int, collectionID int) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.books[bookID]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := m.collections[collectionID]; !ok {
+		return ErrNotFound
+	}
+	member := collection.BookCollectionData{BookID: bookID, CollectionID: collectionID}
+	if m.members[member] {
+		return ErrConflict
+	}
+	m.members[member] = true
+	return nil
+}
+
+func (m *memoryStore) RemoveBookFromCollection(ctx context.Context, bookID int, collectionID int) error {
+	m.Lock()
+	defer m.Unlock()
+
+	member := collection.BookCollectionData{BookID: bookID, CollectionID: collectionID}
+	if !m.members[member] {
+		return ErrNotFound
+	}
+	delete(m.members, member)
+	return nil
+}
+
+func (m *memoryStore) ListKeys(ctx context.Context) ([]auth.Key, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	keys := []auth.Key{}
+	for _, k := range m.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (m *memoryStore) GetKeyByHash(ctx context.Context, hash string) (auth.Key, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	for _, k := range m.keys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+	return auth.Key{}, ErrNotFound
+}
+
+func (m *memoryStore) AddKey(ctx context.Context, k auth.Key) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, other := range m.keys {
+		if other.Name == k.Name || other.Hash == k.Hash {
+			return 0, ErrConflict
+		}
+	}
+	k.ID = m.nextKeyID
+	m.nextKeyID++
+	m.keys[k.ID] = k
+	return k.ID, nil
+}
+
+func (m *memoryStore) RevokeKey(ctx context.Context, id int) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.keys[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.keys, id)
+	return nil
+}
+
+// memoryImport buffers the books of an import, their ids are reserved as
+// they are added so that they do not change on commit.
+type memoryImport struct {
+	store        *memoryStore
+	collectionID int
+	books        []book.Book
+	done         bool
+}
+
+func (m *memoryStore) BeginImport(ctx context.Context, collectionID int) (BookImport, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	if _, ok := m.collections[collectionID]; collectionID > 0 && !ok {
+		return nil, ErrNotFound
+	}
+	return &memoryImport{store: m, collectionID: collectionID}, nil
+}
+
+func (i *memoryImport) AddBook(ctx context.Context, b book.Book) (int, error) {
+	i.store.Lock()
+	defer i.store.Unlock()
+
+	b.Id = i.store.nextBookID
+	b.Version = 1
+	i.store.nextBookID++
+	i.books = append(i.books, b)
+	return b.Id, nil
+}
+
+// Commit fails with ErrNotFound if the collection was deleted during the
+// import, in which case nothing is added.
+func (i *memoryImport) Commit() error {
+	i.store.Lock()
+	defer i.store.Unlock()
+
+	if i.done {
+		return errors.New("import already committed or rolled back")
+	}
+	i.done = true
+	if _, ok := i.store.collections[i.collectionID]; i.collectionID > 0 && !ok {
+		return ErrNotFound
+	}
+	for _, b := range i.books {
+		i.store.books[b.Id] = b
+		if i.collectionID > 0 {
+			i.store.members[collection.BookCollectionData{BookID: b.Id, CollectionID: i.collectionID}] = true
+		}
+	}
+	return nil
+}
+
+func (i *memoryImport) Rollback() error {
+	i.store.Lock()
+	defer i.store.Unlock()
+
+	i.done = true
+	i.books = nil
+	return nil
+}
+
+func (m *memoryStore) checkUniqueName(id int, name string) error {
+	for _, c := range m.collections {
+		if c.ID != id && c.Collection == name {
+			return ErrConflict
+		}
+	}
+	return nil
+}
+
+// filterBooks evaluates the filter and sort in Go, since there is no database
+// to do it, and returns the requested page of the result.
+func filterBooks(books []book.Book, opts ListOptions) ([]book.Book, int, error) {
+	sort.Slice(books, func(i, j int) bool {
+		return books[i].Id < books[j].Id
+	})
+	sort.SliceStable(books, func(i, j int) bool {
+		return opts.Sort.Less(books[i], books[j])
+	})
+	filtered := books
+	if opts.Filter != nil {
+		filtered = []book.Book{}
+		for _, b := range books {
+			keep, err := opts.Filter.Eval(b)
+			if err != nil {
+				return nil, 0, err
+			}
+			if keep {
+				filtered = append(filtered, b)
+			}
+		}
+	}
+	lo, hi := pageBounds(len(filtered), opts)
+	return filtered[lo:hi], len(filtered), nil
+}
+
+func pageBounds(total int, opts ListOptions) (int, int) {
+	if opts.Limit <= 0 {
+		return 0, total
+	}
+	lo := opts.Offset
+	if lo > total {
+		lo = total
+	}
+	hi := lo + opts.Limit
+	if hi > total {
+		hi = total
+	}
+	return lo, hi
+}
@@ -0,0 +1,451 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/collection"
+	"github.com/masnax/canonical-bookmanager/filter"
+	"github.com/masnax/canonical-bookmanager/query"
+	"github.com/mattn/go-sqlite3"
+)
+
+const bookColumns = "book.id, book.title, book.author, book.published, book.edition, book.description, " +
+	"book.genre, book.version"
+
+const collectionColumns = "collection.id, collection.collection, collection.version"
+
+const keyColumns = "api_key.id, api_key.name, api_key.role, api_key.key_hash, api_key.created_at"
+
+// bookFilterColumns lists the columns a filter may compare against or a
+// listing may be sorted by.
+var bookFilterColumns = map[string]string{
+	"Id":          "book.id",
+	"Title":       "book.title",
+	"Author":      "book.author",
+	"Published":   "book.published",
+	"Edition":     "book.edition",
+	"Description": "book.description",
+	"Genre":       "book.genre",
+}
+
+var collectionSortColumns = map[string]string{
+	"ID":         "collection.id",
+	"Collection": "collection.collection",
+	"Size":       "size",
+}
+
+type sqlStore struct {
+	db *sql.DB
+}
+
+// conn is what statements run on, the database or a transaction.
+type conn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func NewSQLStore(db *sql.DB) *sqlStore {
+	return &sqlStore{
+		db: db,
+	}
+}
+
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// DBStats reports the state of the connection pool.
+func (s *sqlStore) DBStats() sql.DBStats {
+	return s.db.Stats()
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqlStore) ListBooks(ctx context.Context, opts ListOptions) ([]book.Book, int, error) {
+	return s.listBooks(ctx, newSelect(bookColumns, "book"), opts)
+}
+
+func (s *sqlStore) GetBook(ctx context.Context, id int) (book.Book, error) {
+	books, err := s.queryBooks(ctx, newSelect(bookColumns, "book").Where("book.id = ?", id))
+	if err != nil {
+		return book.Book{}, err
+	}
+	if len(books) == 0 {
+		return book.Book{}, ErrNotFound
+	}
+	return books[0], nil
+}
+
+func (s *sqlStore) AddBook(ctx context.Context, b book.Book) (int, error) {
+	return addBook(ctx, s.db, b)
+}
+
+func addBook(ctx context.Context, c conn, b book.Book) (int, error) {
+	res, err := exec(ctx, c, "INSERT INTO book "+
+		"(title, author, published, edition, description, genre) VALUES (?, ?, ?, ?, ?, ?)",
+		b.Title, b.Author, b.Published, b.Edition, b.Description, b.Genre)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *sqlStore) UpdateBook(ctx context.Context, id int, b book.Book) error {
+	return s.versioned(ctx, "book", id, b.Version, "UPDATE book SET "+
+		"title=?, author=?, published=?, edition=?, description=?, genre=?, version=version+1 WHERE id=?",
+		b.Title, b.Author, b.Published, b.Edition, b.Description, b.Genre, id)
+}
+
+func (s *sqlStore) DeleteBook(ctx context.Context, id int, version int) error {
+	return s.versioned(ctx, "book", id, version, "DELETE FROM book WHERE id=?", id)
+}
+
+func (s *sqlStore) ListCollections(ctx context.Context, opts ListOptions) ([]collection.BookCollection, int, error) {
+	q := newSelect("collection.id, collection.collection, COUNT(bc.book_id) AS size",
+		"collection LEFT JOIN book_collection AS bc ON bc.collection_id = collection.id").
+		GroupBy("collection.id, collection.collection")
+	if len(opts.Name) > 0 {
+		q.Where("collection.collection = ?", opts.Name)
+	}
+	total, err := s.count(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(opts.Sort) == 0 {
+		opts.Sort = query.Sort{{Field: "Size", Desc: true}}
+	}
+	q.OrderBy(opts.Sort, collectionSortColumns, "collection.id").Page(opts.Limit, opts.Offset)
+	rows, err := s.query(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	bookCollections := []collection.BookCollection{}
+	for rows.Next() {
+		var bc collection.BookCollection
+		if err := rows.Scan(&bc.ID, &bc.Collection, &bc.Size); err != nil {
+			return nil, 0, err
+		}
+		bookCollections = append(bookCollections, bc)
+	}
+	return bookCollections, total, rows.Err()
+}
+
+func (s *sqlStore) GetCollection(ctx context.Context, id int) (collection.Collection, error) {
+	collections, err := s.queryCollections(ctx,
+		newSelect(collectionColumns, "collection").Where("collection.id = ?", id))
+	if err != nil {
+		return collection.Collection{}, err
+	}
+	if len(collections) == 0 {
+		return collection.Collection{}, ErrNotFound
+	}
+	return collections[0], nil
+}
+
+func (s *sqlStore) AddCollection(ctx context.Context, c collection.Collection) (int, error) {
+	res, err := s.exec(ctx, "INSERT INTO collection (collection) VALUES (?)", c.Collection)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *sqlStore) UpdateCollection(ctx context.Context, id int, c collection.Collection) error {
+	return s.versioned(ctx, "collection", id, c.Version,
+		"UPDATE collection SET collection=?, version=version+1 WHERE id=?", c.Collection, id)
+}
+
+func (s *sqlStore) DeleteCollection(ctx context.Context, id int, version int) error {
+	return s.versioned(ctx, "collection", id, version, "DELETE FROM collection WHERE id=?", id)
+}
+
+func (s *sqlStore) ListBooksForCollection(ctx context.Context, collectionID int, opts ListOptions) ([]book.Book, int, error) {
+	if err := s.exists(ctx, "collection", collectionID); err != nil {
+		return nil, 0, err
+	}
+	q := newSelect(bookColumns, "book JOIN book_collection AS bc ON bc.book_id = book.id").
+		Where("bc.collection_id = ?", collectionID)
+	return s.listBooks(ctx, q, opts)
+}
+
+func (s *sqlStore) ListCollectionsForBook(ctx context.Context, bookID int) ([]collection.Collection, error) {
+	if err := s.exists(ctx, "book", bookID); err != nil {
+		return nil, err
+	}
+	q := newSelect(collectionColumns, "collection JOIN book_collection AS bc ON bc.collection_id = collection.id").
+		Where("bc.book_id = ?", bookID).
+		OrderBy(nil, collectionSortColumns, "collection.id")
+	return s.queryCollections(ctx, q)
+}
+
+func (s *sqlStore) AddBookToCollection(ctx context.Context, bookID int, collectionID int) error {
+	_, err := s.exec(ctx, "INSERT INTO book_collection (book_id, collection_id) VALUES (?, ?)",
+		bookID, collectionID)
+	return err
+}
+
+func (s *sqlStore) RemoveBookFromCollection(ctx context.Context, bookID int, collectionID int) error {
+	_, err := s.exec(ctx, "DELETE FROM book_collection WHERE book_id=? AND collection_id=?",
+		bookID, collectionID)
+	return err
+}
+
+func (s *sqlStore) ListKeys(ctx context.Context) ([]auth.Key, error) {
+	return s.queryKeys(ctx, newSelect(keyColumns, "api_key").OrderBy(nil, nil, "api_key.id"))
+}
+
+func (s *sqlStore) GetKeyByHash(ctx context.Context, hash string) (auth.Key, error) {
+	keys, err := s.queryKeys(ctx, newSelect(keyColumns, "api_key").Where("api_key.key_hash = ?", hash))
+	if err != nil {
+		return auth.Key{}, err
+	}
+	if len(keys) == 0 {
+		return auth.Key{}, ErrNotFound
+	}
+	return keys[0], nil
+}
+
+func (s *sqlStore) AddKey(ctx context.Context, k auth.Key) (int, error) {
+	res, err := s.exec(ctx, "INSERT INTO api_key (name, role, key_hash, created_at) VALUES (?, ?, ?, ?)",
+		k.Name, string(k.Role), k.Hash, k.Created)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *sqlStore) RevokeKey(ctx context.Context, id int) error {
+	_, err := s.exec(ctx, "DELETE FROM api_key WHERE id=?", id)
+	return err
+}
+
+// sqlImport adds books within a transaction, which holds one of the
+// connections of the pool until the import is committed or rolled back.
+type sqlImport struct {
+	tx           *sql.Tx
+	collectionID int
+}
+
+func (s *sqlStore) BeginImport(ctx context.Context, collectionID int) (BookImport, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if collectionID > 0 {
+		n, err := count(ctx, tx, newSelect("collection.id", "collection").Where("collection.id = ?", collectionID))
+		if err == nil && n == 0 {
+			err = ErrNotFound
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return &sqlImport{tx: tx, collectionID: collectionID}, nil
+}
+
+func (i *sqlImport) AddBook(ctx context.Context, b book.Book) (int, error) {
+	id, err := addBook(ctx, i.tx, b)
+	if err != nil {
+		return 0, err
+	}
+	if i.collectionID > 0 {
+		_, err = exec(ctx, i.tx, "INSERT INTO book_collection (book_id, collection_id) VALUES (?, ?)",
+			id, i.collectionID)
+	}
+	return id, err
+}
+
+func (i *sqlImport) Commit() error {
+	return i.tx.Commit()
+}
+
+func (i *sqlImport) Rollback() error {
+	return i.tx.Rollback()
+}
+
+// listBooks narrows the books selected by q down by the filter, sort and page
+// of opts.
+func (s *sqlStore) listBooks(ctx context.Context, q *selectQuery, opts ListOptions) ([]book.Book, int, error) {
+	if opts.Filter != nil {
+		where, args, err := filter.ToSQL(opts.Filter, bookFilterColumns)
+		if err != nil {
+			return nil, 0, err
+		}
+		q.Where(where, args...)
+	}
+	total, err := s.count(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	q.OrderBy(opts.Sort, bookFilterColumns, "book.id").Page(opts.Limit, opts.Offset)
+	books, err := s.queryBooks(ctx, q)
+	return books, total, err
+}
+
+// exec runs a statement that must affect at least one row, so that writes to
+// missing records return ErrNotFound. Constraint violations are translated by
+// constraintError.
+func (s *sqlStore) exec(ctx context.Context, stmt string, args ...interface{}) (sql.Result, error) {
+	return exec(ctx, s.db, stmt, args...)
+}
+
+func exec(ctx context.Context, c conn, stmt string, args ...interface{}) (sql.Result, error) {
+	if err := checkSQL(stmt, args); err != nil {
+		return nil, err
+	}
+	res, err := c.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, constraintError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, ErrNotFound
+	}
+	return res, nil
+}
+
+// versioned runs a write on the record with the given id, which must end in
+// its WHERE clause. When version is positive the write only applies to that
+// version, and a write that affects no rows is told apart as ErrNotFound or
+// ErrVersionMismatch.
+func (s *sqlStore) versioned(ctx context.Context, table string, id int, version int, stmt string, args ...interface{}) error {
+	if version <= 0 {
+		_, err := s.exec(ctx, stmt, args...)
+		return err
+	}
+	_, err := s.exec(ctx, stmt+" AND version=?", append(args, version)...)
+	if err != ErrNotFound {
+		return err
+	}
+	if err := s.exists(ctx, table, id); err != nil {
+		return err
+	}
+	return ErrVersionMismatch
+}
+
+// constraintError maps unique violations to ErrConflict and foreign key
+// violations, which refer to a missing record, to ErrNotFound.
+func constraintError(err error) error {
+	switch e := err.(type) {
+	case *mysql.MySQLError:
+		switch e.Number {
+		case 1062:
+			return ErrConflict
+		case 1452:
+			return ErrNotFound
+		}
+	case sqlite3.Error:
+		switch e.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return ErrConflict
+		case sqlite3.ErrConstraintForeignKey:
+			return ErrNotFound
+		}
+	}
+	return err
+}
+
+// exists returns ErrNotFound unless the table has a row with the given id.
+func (s *sqlStore) exists(ctx context.Context, table string, id int) error {
+	n, err := s.count(ctx, newSelect(table+".id", table).Where(table+".id = ?", id))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) count(ctx context.Context, q *selectQuery) (int, error) {
+	return count(ctx, s.db, q)
+}
+
+func count(ctx context.Context, c conn, q *selectQuery) (int, error) {
+	stmt, args, err := q.CountSQL()
+	if err != nil {
+		return 0, err
+	}
+	var total int
+	err = c.QueryRowContext(ctx, stmt, args...).Scan(&total)
+	return total, err
+}
+
+func (s *sqlStore) query(ctx context.Context, q *selectQuery) (*sql.Rows, error) {
+	stmt, args, err := q.SQL()
+	if err != nil {
+		return nil, err
+	}
+	return s.db.QueryContext(ctx, stmt, args...)
+}
+
+func (s *sqlStore) queryBooks(ctx context.Context, q *selectQuery) ([]book.Book, error) {
+	rows, err := s.query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []book.Book{}
+	for rows.Next() {
+		var b book.Book
+		err := rows.Scan(&b.Id, &b.Title, &b.Author, &b.Published, &b.Edition, &b.Description, &b.Genre,
+			&b.Version)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, b)
+	}
+	return books, rows.Err()
+}
+
+func (s *sqlStore) queryCollections(ctx context.Context, q *selectQuery) ([]collection.Collection, error) {
+	rows, err := s.query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []collection.Collection{}
+	for rows.Next() {
+		var c collection.Collection
+		if err := rows.Scan(&c.ID, &c.Collection, &c.Version); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+func (s *sqlStore) queryKeys(ctx context.Context, q *selectQuery) ([]auth.Key, error) {
+	rows, err := s.query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []auth.Key{}
+	for rows.Next() {
+		var k auth.Key
+		if err := rows.Scan(&k.ID, &k.Name, &k.Role, &k.Hash, &k.Created); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/collection"
+	"github.com/masnax/canonical-bookmanager/config"
+	"github.com/masnax/canonical-bookmanager/db"
+	"github.com/masnax/canonical-bookmanager/filter"
+	"github.com/masnax/canonical-bookmanager/migrate"
+	"github.com/masnax/canonical-bookmanager/query"
+)
+
+var (
+	// ErrNotFound is returned when a record, or a record it refers to, does not exist.
+	ErrNotFound = errors.New("record not found")
+	// ErrConflict is returned when a write would duplicate a unique value.
+	ErrConflict = errors.New("record already exists")
+	// ErrVersionMismatch is returned when a write is made against a version of
+	// a record that has since been updated.
+	ErrVersionMismatch = errors.New("record version does not match")
+)
+
+// ListOptions narrows down the rows returned by a listing. Limit and Offset
+// only apply when Limit is positive, Filter only applies to books and Name
+// only to collections. Sort names fields of the listed type, ties are broken
+// by id.
+type ListOptions struct {
+	Filter filter.Expr
+	Name   string
+	Sort   query.Sort
+	Limit  int
+	Offset int
+}
+
+// Listings return the requested page of rows along with the total number of
+// rows matching the options. Every method takes the context of the request it
+// serves, and the SQL store gives up on its queries once the context is done.
+//
+// Records start at version 1 and every update increments the version. Updates
+// and deletes given a positive version, the Version of the record passed in
+// or the version argument, only apply to that version of the record and
+// return ErrVersionMismatch otherwise. A version of 0 applies to any version.
+type BookStore interface {
+	ListBooks(ctx context.Context, opts ListOptions) ([]book.Book, int, error)
+	GetBook(ctx context.Context, id int) (book.Book, error)
+	AddBook(ctx context.Context, b book.Book) (int, error)
+	UpdateBook(ctx context.Context, id int, b book.Book) error
+	DeleteBook(ctx context.Context, id int, version int) error
+}
+
+type CollectionStore interface {
+	ListCollections(ctx context.Context, opts ListOptions) ([]collection.BookCollection, int, error)
+	GetCollection(ctx context.Context, id int) (collection.Collection, error)
+	AddCollection(ctx context.Context, c collection.Collection) (int, error)
+	UpdateCollection(ctx context.Context, id int, c collection.Collection) error
+	DeleteCollection(ctx context.Context, id int, version int) error
+	ListBooksForCollection(ctx context.Context, collectionID int, opts ListOptions) ([]book.Book, int, error)
+	ListCollectionsForBook(ctx context.Context, bookID int) ([]collection.Collection, error)
+	AddBookToCollection(ctx context.Context, bookID int, collectionID int) error
+	RemoveBookFromCollection(ctx context.Context, bookID int, collectionID int) error
+}
+
+// KeyStore holds API keys, which are looked up by the hash of their token.
+// Names are unique. Revoked keys are deleted.
+type KeyStore interface {
+	ListKeys(ctx context.Context) ([]auth.Key, error)
+	GetKeyByHash(ctx context.Context, hash string) (auth.Key, error)
+	AddKey(ctx context.Context, k auth.Key) (int, error)
+	RevokeKey(ctx context.Context, id int) error
+}
+
+// ImportStore adds books in bulk. The books added through a BookImport, and
+// their membership of its collection if it was given one, are only seen by
+// other requests once the import is committed, and are dropped if it is
+// rolled back. BeginImport returns ErrNotFound for a missing collection, a
+// collectionID of 0 adds the books to no collection.
+type ImportStore interface {
+	BeginImport(ctx context.Context, collectionID int) (BookImport, error)
+}
+
+// BookImport is an import in progress, which must be either committed or
+// rolled back. The ids it returns only refer to books once it is committed.
+type BookImport interface {
+	AddBook(ctx context.Context, b book.Book) (int, error)
+	Commit() error
+	Rollback() error
+}
+
+type Store interface {
+	BookStore
+	CollectionStore
+	KeyStore
+	ImportStore
+	// Ping reports whether the store can serve requests.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Open returns the store for the configured driver. The "memory" driver
+// ignores the rest of the configuration, every other driver is handed to
+// database/sql and has its pending migrations applied if AutoMigrate is set.
+func Open(cfg config.Database) (Store, error) {
+	switch cfg.Driver {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "mysql", "sqlite3":
+		database, err := db.Open(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.AutoMigrate {
+			if _, err := migrate.Up(database, cfg.Driver); err != nil {
+				database.Close()
+				return nil, err
+			}
+		}
+		return NewSQLStore(database), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("unsupported store driver: %s", cfg.Driver))
+	}
+}
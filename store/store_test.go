@@ -0,0 +1,619 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/masnax/canonical-bookmanager/auth"
+	"github.com/masnax/canonical-bookmanager/book"
+	"github.com/masnax/canonical-bookmanager/collection"
+	"github.com/masnax/canonical-bookmanager/config"
+	"github.com/masnax/canonical-bookmanager/filter"
+	"github.com/masnax/canonical-bookmanager/query"
+)
+
+var ctx = context.Background()
+
+func testStores(t *testing.T) map[string]Store {
+	sqlite, err := Open(config.Database{Driver: "sqlite3", DSN: ":memory:", AutoMigrate: true})
+	if err != nil {
+		t.Fatalf("expected no error opening sqlite store, got [%v]", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return map[string]Store{
+		"memory":  NewMemoryStore(),
+		"sqlite3": sqlite,
+	}
+}
+
+func TestBooks(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			in := book.Book{Title: "Dune", Author: "Frank Herbert", Published: "1965-08-01",
+				Edition: 1, Description: "Text", Genre: "scifi"}
+			id, err := s.AddBook(ctx, in)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			in.Id = id
+			in.Version = 1
+			out, err := s.GetBook(ctx, id)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if out != in {
+				t.Fatalf("expected [%v], got [%v]", in, out)
+			}
+
+			in.Edition = 2
+			if err := s.UpdateBook(ctx, id, in); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			in.Version = 2
+			books, _, err := s.ListBooks(ctx, ListOptions{})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if len(books) != 1 || books[0] != in {
+				t.Fatalf("expected [%v], got [%v]", []book.Book{in}, books)
+			}
+
+			if err := s.DeleteBook(ctx, id, 0); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if _, err := s.GetBook(ctx, id); err != ErrNotFound {
+				t.Fatalf("expected [%v], got [%v]", ErrNotFound, err)
+			}
+			if err := s.UpdateBook(ctx, id, in); err != ErrNotFound {
+				t.Fatalf("expected [%v], got [%v]", ErrNotFound, err)
+			}
+			if err := s.DeleteBook(ctx, id, 0); err != ErrNotFound {
+				t.Fatalf("expected [%v], got [%v]", ErrNotFound, err)
+			}
+		})
+	}
+}
+
+func TestVersions(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			b := book.Book{Title: "Dune", Published: "1965-08-01", Edition: 1}
+			bookID, _ := s.AddBook(ctx, b)
+			collectionID, _ := s.AddCollection(ctx, collection.Collection{Collection: "scifi"})
+
+			b.Version = 1
+			if err := s.UpdateBook(ctx, bookID, b); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if err := s.UpdateBook(ctx, bookID, b); err != ErrVersionMismatch {
+				t.Fatalf("expected [%v] for a stale update, got [%v]", ErrVersionMismatch, err)
+			}
+			if err := s.DeleteBook(ctx, bookID, 1); err != ErrVersionMismatch {
+				t.Fatalf("expected [%v] for a stale delete, got [%v]", ErrVersionMismatch, err)
+			}
+			b.Version = 0
+			if err := s.UpdateBook(ctx, bookID, b); err != nil {
+				t.Fatalf("expected an unconditional update, got [%v]", err)
+			}
+			if out, _ := s.GetBook(ctx, bookID); out.Version != 3 {
+				t.Fatalf("expected version 3, got [%d]", out.Version)
+			}
+			if err := s.DeleteBook(ctx, bookID, 3); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if err := s.DeleteBook(ctx, bookID, 3); err != ErrNotFound {
+				t.Fatalf("expected [%v], got [%v]", ErrNotFound, err)
+			}
+
+			c := collection.Collection{Collection: "fiction", Version: 1}
+			if err := s.UpdateCollection(ctx, collectionID, c); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if err := s.UpdateCollection(ctx, collectionID, c); err != ErrVersionMismatch {
+				t.Fatalf("expected [%v] for a stale update, got [%v]", ErrVersionMismatch, err)
+			}
+			if err := s.DeleteCollection(ctx, collectionID, 1); err != ErrVersionMismatch {
+				t.Fatalf("expected [%v] for a stale delete, got [%v]", ErrVersionMismatch, err)
+			}
+			if out, _ := s.GetCollection(ctx, collectionID); out.Version != 2 || out.Collection != "fiction" {
+				t.Fatalf("expected version 2 of fiction, got [%v]", out)
+			}
+			if err := s.DeleteCollection(ctx, collectionID, 2); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+		})
+	}
+}
+
+// TestConcurrentAccess is meant to be run with -race. Writers increment the
+// edition of one book with versioned updates, retrying when they lose a race,
+// while others add books and list them.
+func TestConcurrentAccess(t *testing.T) {
+	stores := testStores(t)
+	file, err := Open(config.Database{Driver: "sqlite3", DSN: filepath.Join(t.TempDir(), "books.db"),
+		MaxOpenConns: 4, MaxIdleConns: 4, AutoMigrate: true})
+	if err != nil {
+		t.Fatalf("expected no error opening sqlite file store, got [%v]", err)
+	}
+	defer file.Close()
+	stores["sqlite3 file"] = file
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			id, _ := s.AddBook(ctx, book.Book{Title: "Dune", Published: "1965-08-01", Edition: 1})
+			const workers, increments = 8, 10
+			var wg sync.WaitGroup
+			errs := make(chan error, 3*workers)
+			for i := 0; i < workers; i++ {
+				wg.Add(3)
+				go func() {
+					defer wg.Done()
+					for n := 0; n < increments; {
+						b, err := s.GetBook(ctx, id)
+						if err != nil {
+							errs <- err
+							return
+						}
+						b.Edition++
+						err = s.UpdateBook(ctx, id, b)
+						if err == ErrVersionMismatch {
+							continue
+						}
+						if err != nil {
+							errs <- err
+							return
+						}
+						n++
+					}
+				}()
+				go func(i int) {
+					defer wg.Done()
+					b := book.Book{Title: fmt.Sprintf("Book %d", i), Published: "2000-01-01", Edition: 1}
+					if _, err := s.AddBook(ctx, b); err != nil {
+						errs <- err
+					}
+				}(i)
+				go func() {
+					defer wg.Done()
+					if _, _, err := s.ListBooks(ctx, ListOptions{Sort: query.Sort{{Field: "Edition"}}}); err != nil {
+						errs <- err
+					}
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+
+			b, err := s.GetBook(ctx, id)
+			if err != nil || b.Edition != 1+workers*increments {
+				t.Fatalf("expected edition %d, got [%v] [%v]", 1+workers*increments, b, err)
+			}
+			if _, total, _ := s.ListBooks(ctx, ListOptions{}); total != 1+workers {
+				t.Fatalf("expected %d books, got [%d]", 1+workers, total)
+			}
+		})
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	s := testStores(t)["sqlite3"]
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := s.ListBooks(cancelled, ListOptions{}); err != context.Canceled {
+		t.Fatalf("expected [%v], got [%v]", context.Canceled, err)
+	}
+	if _, err := s.AddBook(cancelled, book.Book{Title: "Dune"}); err != context.Canceled {
+		t.Fatalf("expected [%v], got [%v]", context.Canceled, err)
+	}
+}
+
+func TestCollections(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			bookIDs := []int{}
+			for i := 0; i < 3; i++ {
+				id, err := s.AddBook(ctx, book.Book{Title: fmt.Sprintf("Book %d", i), Published: "2000-01-01"})
+				if err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+				bookIDs = append(bookIDs, id)
+			}
+			small, err := s.AddCollection(ctx, collection.Collection{Collection: "small"})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			large, err := s.AddCollection(ctx, collection.Collection{Collection: "large"})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if _, err := s.AddCollection(ctx, collection.Collection{Collection: "large"}); err != ErrConflict {
+				t.Fatalf("expected [%v] for duplicate collection, got [%v]", ErrConflict, err)
+			}
+			if err := s.UpdateCollection(ctx, small, collection.Collection{Collection: "large"}); err != ErrConflict {
+				t.Fatalf("expected [%v] for duplicate collection, got [%v]", ErrConflict, err)
+			}
+
+			for _, id := range bookIDs {
+				if err := s.AddBookToCollection(ctx, id, large); err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+			}
+			if err := s.AddBookToCollection(ctx, bookIDs[0], small); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if err := s.AddBookToCollection(ctx, bookIDs[0]+100, small); err != ErrNotFound {
+				t.Fatalf("expected [%v] for unknown book, got [%v]", ErrNotFound, err)
+			}
+			if err := s.AddBookToCollection(ctx, bookIDs[0], small); err != ErrConflict {
+				t.Fatalf("expected [%v] for duplicate member, got [%v]", ErrConflict, err)
+			}
+
+			stats, _, err := s.ListCollections(ctx, ListOptions{})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			expected := []collection.BookCollection{
+				{ID: large, Collection: "large", Size: 3},
+				{ID: small, Collection: "small", Size: 1},
+			}
+			if fmt.Sprint(stats) != fmt.Sprint(expected) {
+				t.Fatalf("expected [%v], got [%v]", expected, stats)
+			}
+
+			named, _, err := s.ListCollections(ctx, ListOptions{Name: "small"})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if len(named) != 1 || named[0].ID != small || named[0].Size != 1 {
+				t.Fatalf("expected only collection %d, got [%v]", small, named)
+			}
+
+			books, _, err := s.ListBooksForCollection(ctx, large, ListOptions{})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if len(books) != 3 {
+				t.Fatalf("expected 3 books, got [%v]", books)
+			}
+
+			if err := s.DeleteBook(ctx, bookIDs[0], 0); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if _, err := s.ListCollectionsForBook(ctx, bookIDs[0]); err != ErrNotFound {
+				t.Fatalf("expected [%v] for deleted book, got [%v]", ErrNotFound, err)
+			}
+
+			if err := s.RemoveBookFromCollection(ctx, bookIDs[1], large); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if err := s.UpdateCollection(ctx, large, collection.Collection{Collection: "renamed"}); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			c, err := s.GetCollection(ctx, large)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if c.Collection != "renamed" {
+				t.Fatalf("expected renamed collection, got [%v]", c)
+			}
+			books, _, err = s.ListBooksForCollection(ctx, large, ListOptions{})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if len(books) != 1 || books[0].Id != bookIDs[2] {
+				t.Fatalf("expected only book %d, got [%v]", bookIDs[2], books)
+			}
+
+			if err := s.DeleteCollection(ctx, small, 0); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if _, err := s.GetCollection(ctx, small); err != ErrNotFound {
+				t.Fatalf("expected [%v], got [%v]", ErrNotFound, err)
+			}
+			if err := s.RemoveBookFromCollection(ctx, bookIDs[1], large); err != ErrNotFound {
+				t.Fatalf("expected [%v], got [%v]", ErrNotFound, err)
+			}
+		})
+	}
+}
+
+func TestListBooksFilter(t *testing.T) {
+	books := []book.Book{
+		{Title: "Dune", Author: "Frank Herbert", Published: "1965-08-01", Edition: 1, Genre: "scifi"},
+		{Title: "The Hobbit", Author: "J. R. R. Tolkien", Published: "1937-09-21", Edition: 4, Genre: "Fantasy"},
+		{Title: "Mistborn", Author: "Brandon Sanderson", Published: "2006-07-17", Edition: 1, Genre: "fantasy",
+			Description: "Heist"},
+	}
+	testCases := []struct {
+		formValue string
+		titles    string
+	}{
+		{formValue: "genre eq fantasy", titles: "[The Hobbit Mistborn]"},
+		{formValue: "genre eq fantasy and published ge 2000-01-01", titles: "[Mistborn]"},
+		{formValue: "edition gt 1 or author eq 'frank herbert'", titles: "[Dune The Hobbit]"},
+		{formValue: "not (genre eq fantasy)", titles: "[Dune]"},
+		{formValue: "description ne heist", titles: "[Dune The Hobbit]"},
+		{formValue: "id ge 1 and edition eq 1", titles: "[Dune Mistborn]"},
+		{formValue: "title eq \"x' OR 1=1 --\"", titles: "[]"},
+	}
+	for name, s := range testStores(t) {
+		for _, b := range books {
+			if _, err := s.AddBook(ctx, b); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+		}
+		for _, tc := range testCases {
+			t.Run(fmt.Sprintf("%s %s", name, tc.formValue), func(t *testing.T) {
+				expr, err := filter.Parse(tc.formValue)
+				if err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+				out, _, err := s.ListBooks(ctx, ListOptions{Filter: expr})
+				if err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+				titles := []string{}
+				for _, b := range out {
+					titles = append(titles, b.Title)
+				}
+				if fmt.Sprint(titles) != tc.titles {
+					t.Fatalf("expected %s, got %v", tc.titles, titles)
+				}
+			})
+		}
+	}
+}
+
+func TestListBooksPage(t *testing.T) {
+	testCases := []struct {
+		limit  int
+		offset int
+		ids    string
+	}{
+		{limit: 0, offset: 0, ids: "[2 4 6 8 10]"},
+		{limit: 2, offset: 0, ids: "[2 4]"},
+		{limit: 2, offset: 4, ids: "[10]"},
+		{limit: 2, offset: 9, ids: "[]"},
+	}
+	for name, s := range testStores(t) {
+		for i := 1; i <= 10; i++ {
+			if _, err := s.AddBook(ctx, book.Book{Title: "Book", Published: "2000-01-01", Edition: i}); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+		}
+		even, err := filter.Parse("not (edition eq 1 or edition eq 3 or edition eq 5 or edition eq 7 or edition eq 9)")
+		if err != nil {
+			t.Fatalf("expected no error, got [%v]", err)
+		}
+		for _, tc := range testCases {
+			t.Run(fmt.Sprintf("%s limit %d offset %d", name, tc.limit, tc.offset), func(t *testing.T) {
+				out, total, err := s.ListBooks(ctx, ListOptions{Filter: even, Limit: tc.limit, Offset: tc.offset})
+				if err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+				if total != 5 {
+					t.Fatalf("expected total of 5, got %d", total)
+				}
+				ids := []int{}
+				for _, b := range out {
+					ids = append(ids, b.Id)
+				}
+				if fmt.Sprint(ids) != tc.ids {
+					t.Fatalf("expected %s, got %v", tc.ids, ids)
+				}
+			})
+		}
+	}
+}
+
+func TestListSort(t *testing.T) {
+	testCases := []struct {
+		sort string
+		ids  string
+	}{
+		{sort: "", ids: "[1 2 3 4]"},
+		{sort: "author", ids: "[2 4 1 3]"},
+		{sort: "author,-published", ids: "[4 2 3 1]"},
+		{sort: "-edition,title", ids: "[3 1 4 2]"},
+	}
+	for name, s := range testStores(t) {
+		books := []book.Book{
+			{Title: "d", Author: "b", Published: "2001-01-01", Edition: 2},
+			{Title: "c", Author: "a", Published: "2002-01-01", Edition: 1},
+			{Title: "b", Author: "b", Published: "2003-01-01", Edition: 2},
+			{Title: "a", Author: "a", Published: "2004-01-01", Edition: 1},
+		}
+		for _, b := range books {
+			if _, err := s.AddBook(ctx, b); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+		}
+		for _, tc := range testCases {
+			t.Run(fmt.Sprintf("%s sort %q", name, tc.sort), func(t *testing.T) {
+				sort, err := query.ParseSort(tc.sort, query.Fields(book.Book{}))
+				if err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+				out, _, err := s.ListBooks(ctx, ListOptions{Sort: sort})
+				if err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+				ids := []int{}
+				for _, b := range out {
+					ids = append(ids, b.Id)
+				}
+				if fmt.Sprint(ids) != tc.ids {
+					t.Fatalf("expected %s, got %v", tc.ids, ids)
+				}
+			})
+		}
+
+		// collections default to the largest first
+		small, _ := s.AddCollection(ctx, collection.Collection{Collection: "small"})
+		large, _ := s.AddCollection(ctx, collection.Collection{Collection: "large"})
+		s.AddBookToCollection(ctx, 1, large)
+		s.AddBookToCollection(ctx, 2, large)
+		s.AddBookToCollection(ctx, 1, small)
+		for sortValue, expect := range map[string]string{"": "[2 1]", "collection": "[2 1]", "size,-id": "[1 2]"} {
+			sort, err := query.ParseSort(sortValue, query.Fields(collection.BookCollection{}))
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			out, _, err := s.ListCollections(ctx, ListOptions{Sort: sort})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			ids := []int{}
+			for _, c := range out {
+				ids = append(ids, c.ID)
+			}
+			if fmt.Sprint(ids) != expect {
+				t.Fatalf("%s: expected %s for sort %q, got %v", name, expect, sortValue, ids)
+			}
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			in := auth.Key{Name: "ci", Role: auth.RoleEditor, Hash: auth.Hash("token"), Created: "2021-01-01T00:00:00Z"}
+			id, err := s.AddKey(ctx, in)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			in.ID = id
+			if _, err := s.AddKey(ctx, auth.Key{Name: "ci", Role: auth.RoleReader, Hash: auth.Hash("other")}); err != ErrConflict {
+				t.Fatalf("expected [%v] for a taken name, got [%v]", ErrConflict, err)
+			}
+			out, err := s.GetKeyByHash(ctx, auth.Hash("token"))
+			if err != nil || out != in {
+				t.Fatalf("expected [%v], got [%v] [%v]", in, out, err)
+			}
+			keys, err := s.ListKeys(ctx)
+			if err != nil || len(keys) != 1 || keys[0] != in {
+				t.Fatalf("expected [%v], got [%v] [%v]", []auth.Key{in}, keys, err)
+			}
+
+			if err := s.RevokeKey(ctx, id); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if _, err := s.GetKeyByHash(ctx, auth.Hash("token")); err != ErrNotFound {
+				t.Fatalf("expected [%v] for a revoked key, got [%v]", ErrNotFound, err)
+			}
+			if err := s.RevokeKey(ctx, id); err != ErrNotFound {
+				t.Fatalf("expected [%v], got [%v]", ErrNotFound, err)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			col, err := s.AddCollection(ctx, collection.Collection{Collection: "imported"})
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if _, err := s.BeginImport(ctx, col+100); err != ErrNotFound {
+				t.Fatalf("expected [%v] for unknown collection, got [%v]", ErrNotFound, err)
+			}
+
+			imp, err := s.BeginImport(ctx, col)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if _, err := imp.AddBook(ctx, book.Book{Title: "Dropped", Published: "2000-01-01", Edition: 1}); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if err := imp.Rollback(); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if _, total, err := s.ListBooks(ctx, ListOptions{}); err != nil || total != 0 {
+				t.Fatalf("expected no books after a rollback, got [%d] [%v]", total, err)
+			}
+
+			imp, err = s.BeginImport(ctx, col)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			ids := []int{}
+			for i := 0; i < 3; i++ {
+				id, err := imp.AddBook(ctx, book.Book{Title: fmt.Sprintf("Book %d", i), Published: "2000-01-01", Edition: 1})
+				if err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+				ids = append(ids, id)
+			}
+			if err := imp.Commit(); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			books, _, err := s.ListBooksForCollection(ctx, col, ListOptions{})
+			if err != nil || len(books) != 3 {
+				t.Fatalf("expected 3 books in the collection, got [%v] [%v]", books, err)
+			}
+			for i, b := range books {
+				if b.Id != ids[i] || b.Title != fmt.Sprintf("Book %d", i) || b.Version != 1 {
+					t.Fatalf("expected book %d at version 1, got [%v]", ids[i], b)
+				}
+			}
+
+			imp, err = s.BeginImport(ctx, 0)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if _, err := imp.AddBook(ctx, book.Book{Title: "Loose", Published: "2000-01-01", Edition: 1}); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if err := imp.Commit(); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if _, total, err := s.ListBooks(ctx, ListOptions{}); err != nil || total != 4 {
+				t.Fatalf("expected 4 books, got [%d] [%v]", total, err)
+			}
+			if _, total, _ := s.ListBooksForCollection(ctx, col, ListOptions{}); total != 3 {
+				t.Fatalf("expected the collection to keep 3 books, got [%d]", total)
+			}
+		})
+	}
+}
+
+func TestImportConcurrentRollback(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			imp, err := s.BeginImport(ctx, 0)
+			if err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			if _, err := imp.AddBook(ctx, book.Book{Title: "Dune", Published: "1965-08-01", Edition: 1}); err != nil {
+				t.Fatalf("expected no error, got [%v]", err)
+			}
+			// the import may be rolled back from another goroutine than the one committing it
+			var wg sync.WaitGroup
+			var commitErr error
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				commitErr = imp.Commit()
+			}()
+			go func() {
+				defer wg.Done()
+				imp.Rollback()
+			}()
+			wg.Wait()
+
+			expected := 0
+			if commitErr == nil {
+				expected = 1
+			}
+			if _, total, err := s.ListBooks(ctx, ListOptions{}); err != nil || total != expected {
+				t.Fatalf("expected %d books after the commit returned [%v], got [%d] [%v]", expected, commitErr, total, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package validate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const DateLayout = "2006-01-02"
+
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Errors collects every failed check so they can be reported at once. The
+// checks other than Required pass on empty values, so that a missing value
+// is only reported once.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := []string{}
+	for _, f := range e {
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Err returns nil if every check passed.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Has reports whether a check on field failed.
+func (e Errors) Has(field string) bool {
+	for _, f := range e {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Errors) Add(field string, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *Errors) Required(field string, value string) {
+	if len(strings.TrimSpace(value)) == 0 {
+		e.Add(field, "is required")
+	}
+}
+
+// MaxLength limits the number of characters, as VARCHAR columns do.
+func (e *Errors) MaxLength(field string, value string, max int) {
+	if n := utf8.RuneCountInString(value); n > max {
+		e.Add(field, "must be at most %d characters, got %d", max, n)
+	}
+}
+
+// MaxBytes limits the encoded size, as TEXT columns do.
+func (e *Errors) MaxBytes(field string, value string, max int) {
+	if len(value) > max {
+		e.Add(field, "must be at most %d bytes, got %d", max, len(value))
+	}
+}
+
+func (e *Errors) Date(field string, value string) {
+	if len(value) == 0 {
+		return
+	}
+	if _, err := time.Parse(DateLayout, value); err != nil {
+		e.Add(field, "must be a date of the form YYYY-MM-DD, got %q", value)
+	}
+}
+
+func (e *Errors) Range(field string, value int, min int, max int) {
+	if value < min || value > max {
+		e.Add(field, "must be between %d and %d, got %d", min, max, value)
+	}
+}
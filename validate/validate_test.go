@@ -0,0 +1,70 @@
+package validate
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		check  func(e *Errors)
+		expect string
+	}{
+		{
+			desc:   "required",
+			check:  func(e *Errors) { e.Required("title", " ") },
+			expect: "title: is required",
+		},
+		{
+			desc:   "max length counts characters",
+			check:  func(e *Errors) { e.MaxLength("title", strings.Repeat("é", 3), 3) },
+			expect: "",
+		},
+		{
+			desc:   "max length",
+			check:  func(e *Errors) { e.MaxLength("title", "abcd", 3) },
+			expect: "title: must be at most 3 characters, got 4",
+		},
+		{
+			desc:   "max bytes",
+			check:  func(e *Errors) { e.MaxBytes("description", strings.Repeat("é", 2), 3) },
+			expect: "description: must be at most 3 bytes, got 4",
+		},
+		{
+			desc:   "empty date is left to required",
+			check:  func(e *Errors) { e.Date("published", "") },
+			expect: "",
+		},
+		{
+			desc:   "date",
+			check:  func(e *Errors) { e.Date("published", "2001-02-30") },
+			expect: `published: must be a date of the form YYYY-MM-DD, got "2001-02-30"`,
+		},
+		{
+			desc: "every error is kept",
+			check: func(e *Errors) {
+				e.Range("edition", 0, 1, 10)
+				e.Required("title", "")
+			},
+			expect: "edition: must be between 1 and 10, got 0; title: is required",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%s", tc.desc), func(t *testing.T) {
+			errs := Errors{}
+			tc.check(&errs)
+			err := errs.Err()
+			if len(tc.expect) == 0 {
+				if err != nil {
+					t.Fatalf("expected no error, got [%v]", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.expect {
+				t.Fatalf("expected %s, got [%v]", tc.expect, err)
+			}
+		})
+	}
+}